@@ -68,7 +68,7 @@ Examples:
 				if !os.IsNotExist(err) {
 					logging.GlobalLogger.Errorf("Error clearing environment variables: %s", err)
 					fmt.Printf("Error clearing environment variables: %s\n", err)
-					os.Exit(1)
+					exit(1)
 				} else {
 					fmt.Println("Environment variables state file was already clear.")
 				}
@@ -84,7 +84,7 @@ Examples:
 				if !os.IsNotExist(err) {
 					logging.GlobalLogger.Errorf("Error clearing working directory state: %s", err)
 					fmt.Printf("Error clearing working directory state: %s\n", err)
-					os.Exit(1)
+					exit(1)
 				} else {
 					fmt.Println("Working directory state file was already clear.")
 				}
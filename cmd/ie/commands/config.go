@@ -0,0 +1,164 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/config"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// Register the command with our command runner.
+func init() {
+	rootCommand.AddCommand(configCommand)
+	configCommand.AddCommand(configViewCommand)
+
+	// String flags
+	configViewCommand.PersistentFlags().
+		String("output", "", "Renders the configuration in a machine readable format instead of styled text. Valid options are 'json' and 'yaml'.")
+}
+
+// The configuration of the current run, along with the flags that override
+// it.
+var activeConfig *config.Config = nil
+
+// Loads the configuration of a command and uses it as the defaults of its
+// flags. The document is the first argument of the command, whose project
+// configuration file is used.
+func applyConfig(cmd *cobra.Command, args []string) error {
+	document := ""
+	if len(args) > 0 {
+		document = args[0]
+	}
+
+	profile, _ := cmd.Flags().GetString("profile")
+	loaded, err := config.Load(document, profile)
+	if err != nil {
+		return err
+	}
+
+	for _, setting := range config.Settings {
+		flag := cmd.Flags().Lookup(setting)
+		if flag == nil {
+			continue
+		}
+
+		if flag.Changed {
+			loaded.Settings[setting] = config.Value{Value: flag.Value.String(), Source: config.SourceFlag}
+			continue
+		}
+
+		if value, ok := loaded.Settings[setting]; ok {
+			if err := flag.Value.Set(value.Value); err != nil {
+				return fmt.Errorf("invalid %s %q from %s: %w", setting, value.Value, value.Source, err)
+			}
+		}
+	}
+
+	// Variables set with --var win over the ones from the configuration. The
+	// rest of the configuration variables are given to the scenario
+	// separately, see configVariables.
+	if cmd.Flags().Lookup("var") != nil {
+		vars, _ := cmd.Flags().GetStringArray("var")
+		for _, environmentVariable := range vars {
+			keyValuePair := strings.SplitN(environmentVariable, "=", 2)
+			if len(keyValuePair) == 2 {
+				loaded.Vars[keyValuePair[0]] = config.Value{Value: keyValuePair[1], Source: config.SourceFlag}
+			}
+		}
+	}
+
+	activeConfig = loaded
+	return nil
+}
+
+// Gets the variables from the configuration of the current run that aren't
+// set with --var.
+func configVariables() map[string]string {
+	if activeConfig == nil {
+		return nil
+	}
+	return activeConfig.Variables()
+}
+
+var configCommand = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the defaults that IE loads from configuration files.",
+}
+
+var configViewCommand = &cobra.Command{
+	Use:   "view [markdown file]",
+	Short: "Show the defaults for a document and where each of them comes from.",
+	Long: fmt.Sprintf(
+		"Show the defaults for a document and where each of them comes from. Defaults are loaded from %s, from the closest %s to the document and from IE_* environment variables. Flags take precedence over environment variables, which take precedence over the project configuration, which takes precedence over the user configuration.",
+		config.UserFile(),
+		config.ProjectFileName,
+	),
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if err := validateOutputFormat(outputFormat); err != nil {
+			logging.GlobalLogger.Errorf("Error: %s", err)
+			fmt.Printf("Error: %s\n", err)
+			exit(1)
+		}
+
+		if outputFormat != "" {
+			output, err := renderStructuredOutput(outputFormat, activeConfig)
+			if err != nil {
+				logging.GlobalLogger.Errorf("Error rendering the configuration: %s", err)
+				fmt.Printf("Error rendering the configuration: %s", err)
+				exit(1)
+			}
+			fmt.Print(output)
+			return
+		}
+
+		if activeConfig.Profile != "" {
+			fmt.Printf("profile: %s\n", activeConfig.Profile)
+		}
+
+		fmt.Println(ui.StepTitleStyle.Render("Files"))
+		if len(activeConfig.Files) == 0 {
+			fmt.Println(ui.VerboseStyle.Render("  none"))
+		}
+		for _, file := range activeConfig.Files {
+			fmt.Printf("  %s\n", file)
+		}
+
+		fmt.Println(ui.StepTitleStyle.Render("Settings"))
+		for _, setting := range config.Settings {
+			if value, ok := activeConfig.Settings[setting]; ok {
+				printConfigValue(setting, value)
+			}
+		}
+
+		fmt.Println(ui.StepTitleStyle.Render("Variables"))
+		var names []string
+		for name := range activeConfig.Vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			printConfigValue(name, activeConfig.Vars[name])
+		}
+
+		fmt.Println(ui.VerboseStyle.Render("\nPrecedence: flags > environment variables > project > user"))
+	},
+}
+
+func printConfigValue(name string, value config.Value) {
+	source := string(value.Source)
+	if value.File != "" {
+		source = fmt.Sprintf("%s (%s)", source, value.File)
+	}
+	if value.Profile != "" {
+		source = fmt.Sprintf("%s, profile %s", source, value.Profile)
+	}
+
+	fmt.Printf("  %s=%s\n", name, value.Value)
+	printVariableDetail("  source", source)
+}
@@ -2,7 +2,6 @@ package commands
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/Azure/InnovationEngine/internal/engine"
@@ -20,18 +19,24 @@ func init() {
 		Bool("verbose", false, "Enable verbose logging & standard output.")
 	executeCommand.PersistentFlags().
 		Bool("do-not-delete", false, "Do not delete the Azure resources created by the Azure CLI commands executed.")
+	executeCommand.PersistentFlags().
+		Bool("preflight", true, "Checks the syntax of every shell code block before any of them are executed. Use --preflight=false to skip the check.")
 
 	// String flags
 	executeCommand.PersistentFlags().
 		String("correlation-id", "", "Adds a correlation ID to the user agent used by a scenarios azure-cli commands.")
 	executeCommand.PersistentFlags().
 		String("subscription", "", "Sets the subscription ID used by a scenarios azure-cli commands. Will rely on the default subscription if not set.")
+	executeCommand.PersistentFlags().
+		String("output", "", "Replaces the UI with a stream of events written to stdout as JSON lines. The only valid option is 'jsonl'.")
 	executeCommand.PersistentFlags().
 		String("working-directory", ".", "Sets the working directory for innovation engine to operate out of. Restores the current working directory when finished.")
 
 	// StringArray flags
 	executeCommand.PersistentFlags().
 		StringArray("var", []string{}, "Sets an environment variable for the scenario. Format: --var <key>=<value>")
+	executeCommand.PersistentFlags().
+		String("var-profile", "", "Selects the section of the INI file next to the scenario that is layered on top of its [default] section. Format: --var-profile <section>")
 }
 
 var executeCommand = &cobra.Command{
@@ -43,11 +48,19 @@ var executeCommand = &cobra.Command{
 		if markdownFile == "" {
 			logging.GlobalLogger.Errorf("Error: No markdown file specified.")
 			cmd.Help()
-			os.Exit(1)
+			exit(1)
+		}
+
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if err := validateEventOutputFormat(outputFormat); err != nil {
+			logging.GlobalLogger.Errorf("Error: %s", err)
+			fmt.Printf("Error: %s\n", err)
+			exit(1)
 		}
 
 		verbose, _ := cmd.Flags().GetBool("verbose")
 		doNotDelete, _ := cmd.Flags().GetBool("do-not-delete")
+		preflight, _ := cmd.Flags().GetBool("preflight")
 
 		subscription, _ := cmd.Flags().GetString("subscription")
 		correlationId, _ := cmd.Flags().GetString("correlation-id")
@@ -55,6 +68,7 @@ var executeCommand = &cobra.Command{
 		workingDirectory, _ := cmd.Flags().GetString("working-directory")
 
 		environmentVariables, _ := cmd.Flags().GetStringArray("var")
+		varProfile, _ := cmd.Flags().GetString("var-profile")
 		features, _ := cmd.Flags().GetStringArray("feature")
 
 		// Known features
@@ -69,9 +83,9 @@ var executeCommand = &cobra.Command{
 					"Error: Invalid environment variable format: %s",
 					environmentVariable,
 				)
-				fmt.Printf("Error: Invalid environment variable format: %s", environmentVariable)
+				printError(outputFormat, "Error: Invalid environment variable format: %s", environmentVariable)
 				cmd.Help()
-				os.Exit(1)
+				exit(1)
 			}
 
 			cliEnvironmentVariables[keyValuePair[0]] = keyValuePair[1]
@@ -86,23 +100,25 @@ var executeCommand = &cobra.Command{
 					"Error: Invalid feature: %s",
 					feature,
 				)
-				fmt.Printf("Error: Invalid feature: %s\n", feature)
+				printError(outputFormat, "Error: Invalid feature: %s\n", feature)
 				cmd.Help()
-				os.Exit(1)
+				exit(1)
 			}
 		}
 
 		// Parse the markdown file and create a scenario
 		scenario, err := common.CreateScenarioFromMarkdown(
 			markdownFile,
-			[]string{"bash", "azurecli", "azurecli-interactive", "terraform"},
 			cliEnvironmentVariables,
+			configVariables(),
+			varProfile,
 		)
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error creating scenario: %s", err)
-			fmt.Printf("Error creating scenario: %s", err)
-			os.Exit(1)
+			printError(outputFormat, "Error creating scenario: %s", err)
+			exit(1)
 		}
+		printUnmatchedOverrides(outputFormat, scenario)
 
 		innovationEngine, err := engine.NewEngine(engine.EngineConfiguration{
 			Verbose:          verbose,
@@ -112,19 +128,21 @@ var executeCommand = &cobra.Command{
 			Environment:      environment,
 			WorkingDirectory: workingDirectory,
 			RenderValues:     renderValues,
+			Preflight:        preflight,
+			EventStream:      outputFormat == outputFormatJsonl,
 		})
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error creating engine: %s", err)
-			fmt.Printf("Error creating engine: %s", err)
-			os.Exit(1)
+			printError(outputFormat, "Error creating engine: %s", err)
+			exit(1)
 		}
 
 		// Execute the scenario
 		err = innovationEngine.ExecuteScenario(scenario)
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error executing scenario: %s", err)
-			fmt.Printf("Error executing scenario: %s\n", err)
-			os.Exit(1)
+			printError(outputFormat, "Error executing scenario: %s\n", err)
+			exit(1)
 		}
 	},
 }
@@ -2,7 +2,6 @@ package commands
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/Azure/InnovationEngine/internal/engine/common"
@@ -22,24 +21,37 @@ func init() {
 		String("subscription", "", "Sets the subscription ID used by a scenarios azure-cli commands. Will rely on the default subscription if not set.")
 	inspectCommand.PersistentFlags().
 		String("working-directory", ".", "Sets the working directory for innovation engine to operate out of. Restores the current working directory when finished.")
+	inspectCommand.PersistentFlags().
+		String("output", "", "Renders the resolved scenario in a machine readable format instead of styled text. Valid options are 'json' and 'yaml'.")
 
 	// StringArray flags
 	inspectCommand.PersistentFlags().
 		StringArray("var", []string{}, "Sets an environment variable for the scenario. Format: --var <key>=<value>")
+	inspectCommand.PersistentFlags().
+		String("var-profile", "", "Selects the section of the INI file next to the scenario that is layered on top of its [default] section. Format: --var-profile <section>")
 }
 
 var inspectCommand = &cobra.Command{
 	Use:   "inspect",
 	Short: "Execute a document in inspect mode.",
+	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		markdownFile := args[0]
 		if markdownFile == "" {
 			logging.GlobalLogger.Errorf("Error: No markdown file specified.")
 			cmd.Help()
-			os.Exit(1)
+			exit(1)
+		}
+
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if err := validateOutputFormat(outputFormat); err != nil {
+			logging.GlobalLogger.Errorf("Error: %s", err)
+			fmt.Printf("Error: %s\n", err)
+			exit(1)
 		}
 
 		environmentVariables, _ := cmd.Flags().GetStringArray("var")
+		varProfile, _ := cmd.Flags().GetString("var-profile")
 		// features, _ := cmd.Flags().GetStringArray("feature")
 
 		// Parse the environment variables from the command line into a map
@@ -53,7 +65,7 @@ var inspectCommand = &cobra.Command{
 				)
 				fmt.Printf("Error: Invalid environment variable format: %s", environmentVariable)
 				cmd.Help()
-				os.Exit(1)
+				exit(1)
 			}
 
 			cliEnvironmentVariables[keyValuePair[0]] = keyValuePair[1]
@@ -61,19 +73,32 @@ var inspectCommand = &cobra.Command{
 		// Parse the markdown file and create a scenario
 		scenario, err := common.CreateScenarioFromMarkdown(
 			markdownFile,
-			[]string{"bash", "azurecli", "azurecli-inspect", "terraform"},
 			cliEnvironmentVariables,
+			configVariables(),
+			varProfile,
 		)
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error creating scenario: %s", err)
 			fmt.Printf("Error creating scenario: %s", err)
-			os.Exit(1)
+			exit(1)
 		}
+		printUnmatchedOverrides(outputFormat, scenario)
 
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error creating engine: %s", err)
 			fmt.Printf("Error creating engine: %s", err)
-			os.Exit(1)
+			exit(1)
+		}
+
+		if outputFormat != "" {
+			output, err := renderStructuredOutput(outputFormat, scenario.Describe())
+			if err != nil {
+				logging.GlobalLogger.Errorf("Error rendering the scenario: %s", err)
+				fmt.Printf("Error rendering the scenario: %s", err)
+				exit(1)
+			}
+			fmt.Print(output)
+			return
 		}
 
 		fmt.Println(ui.ScenarioTitleStyle.Render(scenario.Name))
@@ -91,6 +116,13 @@ var inspectCommand = &cobra.Command{
 						),
 					),
 				)
+				if codeBlock.File != nil {
+					fmt.Println(
+						ui.VerboseStyle.Render(
+							fmt.Sprintf("      Written to %s", codeBlock.File.Path),
+						),
+					)
+				}
 				fmt.Print(
 					ui.IndentMultiLineCommand(
 						fmt.Sprintf(
@@ -2,7 +2,6 @@ package commands
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/Azure/InnovationEngine/internal/engine"
@@ -26,6 +25,8 @@ func init() {
 	// StringArray flags
 	interactiveCommand.PersistentFlags().
 		StringArray("var", []string{}, "Sets an environment variable for the scenario. Format: --var <key>=<value>")
+	interactiveCommand.PersistentFlags().
+		String("var-profile", "", "Selects the section of the INI file next to the scenario that is layered on top of its [default] section. Format: --var-profile <section>")
 }
 
 var interactiveCommand = &cobra.Command{
@@ -36,7 +37,7 @@ var interactiveCommand = &cobra.Command{
 		if markdownFile == "" {
 			logging.GlobalLogger.Errorf("Error: No markdown file specified.")
 			cmd.Help()
-			os.Exit(1)
+			exit(1)
 		}
 
 		verbose, _ := cmd.Flags().GetBool("verbose")
@@ -48,6 +49,7 @@ var interactiveCommand = &cobra.Command{
 		workingDirectory, _ := cmd.Flags().GetString("working-directory")
 
 		environmentVariables, _ := cmd.Flags().GetStringArray("var")
+		varProfile, _ := cmd.Flags().GetString("var-profile")
 		// features, _ := cmd.Flags().GetStringArray("feature")
 
 		// Known features
@@ -64,7 +66,7 @@ var interactiveCommand = &cobra.Command{
 				)
 				fmt.Printf("Error: Invalid environment variable format: %s", environmentVariable)
 				cmd.Help()
-				os.Exit(1)
+				exit(1)
 			}
 
 			cliEnvironmentVariables[keyValuePair[0]] = keyValuePair[1]
@@ -72,14 +74,16 @@ var interactiveCommand = &cobra.Command{
 		// Parse the markdown file and create a scenario
 		scenario, err := common.CreateScenarioFromMarkdown(
 			markdownFile,
-			[]string{"bash", "azurecli", "azurecli-interactive", "terraform"},
 			cliEnvironmentVariables,
+			configVariables(),
+			varProfile,
 		)
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error creating scenario: %s", err)
 			fmt.Printf("Error creating scenario: %s", err)
-			os.Exit(1)
+			exit(1)
 		}
+		printUnmatchedOverrides("", scenario)
 
 		innovationEngine, err := engine.NewEngine(engine.EngineConfiguration{
 			Verbose:          verbose,
@@ -93,7 +97,7 @@ var interactiveCommand = &cobra.Command{
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error creating engine: %s", err)
 			fmt.Printf("Error creating engine: %s", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		// Execute the scenario
@@ -101,7 +105,7 @@ var interactiveCommand = &cobra.Command{
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error executing scenario: %s", err)
 			fmt.Printf("Error executing scenario: %s", err)
-			os.Exit(1)
+			exit(1)
 		}
 	},
 }
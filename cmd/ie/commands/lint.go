@@ -0,0 +1,74 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Azure/InnovationEngine/internal/lint"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// Register the command with our command runner.
+func init() {
+	rootCommand.AddCommand(lintCommand)
+
+	// String flags
+	lintCommand.PersistentFlags().
+		String("output", "", "Renders the diagnostics in a machine readable format instead of text. Valid options are 'json' and 'yaml'.")
+}
+
+var lintCommand = &cobra.Command{
+	Use:   "lint <files...>",
+	Short: "Check documents for mistakes without executing them.",
+	Long: "Check documents for mistakes without executing them. Exits with a non-zero " +
+		"status code when an error is found, warnings and infos are only reported.",
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if err := validateOutputFormat(outputFormat); err != nil {
+			logging.GlobalLogger.Errorf("Error: %s", err)
+			fmt.Printf("Error: %s\n", err)
+			exit(1)
+		}
+
+		diagnostics := []lint.Diagnostic{}
+		failed := false
+		for _, path := range args {
+			fileDiagnostics, err := lint.LintFile(path)
+			if err != nil {
+				logging.GlobalLogger.Errorf("Error linting %s: %s", path, err)
+				fmt.Fprintf(os.Stderr, "Error linting %s: %s\n", path, err)
+				failed = true
+				continue
+			}
+			diagnostics = append(diagnostics, fileDiagnostics...)
+		}
+
+		if outputFormat != "" {
+			output, err := renderStructuredOutput(outputFormat, diagnostics)
+			if err != nil {
+				logging.GlobalLogger.Errorf("Error rendering the diagnostics: %s", err)
+				fmt.Printf("Error rendering the diagnostics: %s", err)
+				exit(1)
+			}
+			fmt.Print(output)
+		} else {
+			for _, diagnostic := range diagnostics {
+				switch diagnostic.Severity {
+				case lint.SeverityError:
+					fmt.Println(ui.ErrorMessageStyle.Render(diagnostic.String()))
+				case lint.SeverityWarning:
+					fmt.Println(diagnostic.String())
+				default:
+					fmt.Println(ui.VerboseStyle.Render(diagnostic.String()))
+				}
+			}
+		}
+
+		if failed || lint.HasErrors(diagnostics) {
+			exit(1)
+		}
+	},
+}
@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/lib"
+)
+
+// The formats that machine readable output can be rendered in.
+const (
+	outputFormatJson = "json"
+	outputFormatYaml = "yaml"
+)
+
+// The format that replaces the UI of a command that runs a scenario with a
+// stream of events.
+const outputFormatJsonl = "jsonl"
+
+// Checks that an --output flag holds a supported format. An empty format
+// selects the human readable output of the command.
+func validateOutputFormat(format string) error {
+	switch format {
+	case "", outputFormatJson, outputFormatYaml:
+		return nil
+	default:
+		return fmt.Errorf(
+			"invalid output format '%s', valid options are '%s' and '%s'",
+			format,
+			outputFormatJson,
+			outputFormatYaml,
+		)
+	}
+}
+
+// Checks that the --output flag of a command that runs a scenario holds a
+// supported format. An empty format selects the UI of the command.
+func validateEventOutputFormat(format string) error {
+	switch format {
+	case "", outputFormatJsonl:
+		return nil
+	default:
+		return fmt.Errorf("invalid output format '%s', the only valid option is '%s'", format, outputFormatJsonl)
+	}
+}
+
+// Prints an error for the user. When the output is machine readable, errors go
+// to stderr so that stdout only holds the output.
+func printError(outputFormat string, format string, args ...interface{}) {
+	if outputFormat != "" {
+		fmt.Fprintln(os.Stderr, strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"))
+		return
+	}
+	fmt.Printf(format, args...)
+}
+
+// Warns about the --var overrides that aren't assigned by any code block of
+// the scenario, which are exported before its first step.
+func printUnmatchedOverrides(outputFormat string, scenario *common.Scenario) {
+	for _, name := range scenario.UnmatchedOverrides {
+		printError(
+			outputFormat,
+			"Warning: --var %s doesn't match any assignment of the scenario, it is exported before the first step.\n",
+			name,
+		)
+	}
+}
+
+// Renders a value as JSON or YAML. The YAML rendering is derived from the JSON
+// rendering so that both use the same field names.
+func renderStructuredOutput(format string, value interface{}) (string, error) {
+	rendered, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if format == outputFormatYaml {
+		rendered, err = lib.JsonToYaml(rendered)
+		if err != nil {
+			return "", err
+		}
+		return string(rendered), nil
+	}
+
+	return string(rendered) + "\n", nil
+}
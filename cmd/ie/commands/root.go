@@ -6,6 +6,7 @@ import (
 
 	"github.com/Azure/InnovationEngine/internal/engine/environments"
 	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/tracing"
 	"github.com/spf13/cobra"
 )
 
@@ -15,27 +16,77 @@ var rootCommand = &cobra.Command{
 	Use:   "ie",
 	Short: "The innovation engine.",
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Load the defaults of the flags from the configuration files
+		if err := applyConfig(cmd, args); err != nil {
+			fmt.Printf("Error loading the configuration: %s\n", err)
+			exit(1)
+		}
+
 		logLevel, err := cmd.Flags().GetString("log-level")
 		if err != nil {
 			fmt.Printf("Error getting log level: %s", err)
-			os.Exit(1)
+			exit(1)
+		}
+		logFile, _ := cmd.Flags().GetString("log-file")
+		logFormat, _ := cmd.Flags().GetString("log-format")
+		err = logging.Init(logging.Configuration{
+			Level:  logging.LevelFromString(logLevel),
+			Format: logging.Format(logFormat),
+			File:   logFile,
+		})
+		if err != nil {
+			fmt.Printf("Error setting up the logs: %s\n", err)
+			exit(1)
 		}
-		logging.Init(logging.LevelFromString(logLevel))
 
 		// Check environment
 		environment, err := cmd.Flags().GetString("environment")
 		if err != nil {
 			fmt.Printf("Error getting environment: %s", err)
 			logging.GlobalLogger.Errorf("Error getting environment: %s", err)
-			os.Exit(1)
+			exit(1)
 		}
 
 		if !environments.IsValidEnvironment(environment) {
 			fmt.Printf("Invalid environment: %s", environment)
 			logging.GlobalLogger.Errorf("Invalid environment: %s", err)
-			os.Exit(1)
+			exit(1)
+		}
+
+		// Set up the status reporters
+		reporterDescriptions, _ := cmd.Flags().GetStringArray("status-reporter")
+		var reporters []environments.StatusReporter
+		for _, description := range reporterDescriptions {
+			reporter, err := environments.ParseStatusReporter(description)
+			if err != nil {
+				fmt.Printf("Error setting up the status reporter: %s\n", err)
+				logging.GlobalLogger.Errorf("Error setting up the status reporter: %s", err)
+				exit(1)
+			}
+			reporters = append(reporters, reporter)
+		}
+		environments.SetStatusReporters(reporters)
+
+		// Set up the export of traces
+		otelEndpoint, _ := cmd.Flags().GetString("otel-endpoint")
+		if err := tracing.Init(otelEndpoint); err != nil {
+			fmt.Printf("Error setting up the trace export: %s\n", err)
+			logging.GlobalLogger.Errorf("Error setting up the trace export: %s", err)
+			exit(1)
 		}
 	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		environments.CloseStatusReporters()
+		tracing.Shutdown()
+	},
+}
+
+// Closes the status reporters and flushes the traces before exiting, as
+// PersistentPostRun is skipped when a command exits early.
+func exit(code int) {
+	environments.CloseStatusReporters()
+	tracing.Shutdown()
+	os.Exit(code)
 }
 
 // Entrypoint into the Innovation Engine CLI.
@@ -44,7 +95,19 @@ func ExecuteCLI() {
 		String(
 			"log-level",
 			string(logging.Debug),
-			"Configure the log level for statements written to ie.log. Valid options are 'trace', 'debug', 'info', 'warn', 'error', 'fatal'",
+			"Configure the log level for statements written to the log file. Valid options are 'trace', 'debug', 'info', 'warn', 'error', 'fatal'",
+		)
+	rootCommand.PersistentFlags().
+		String(
+			"log-file",
+			"",
+			"The file that logs are appended to. By default, each run logs to a file named after its run ID in $XDG_STATE_HOME/ie/logs, or ~/.local/state/ie/logs.",
+		)
+	rootCommand.PersistentFlags().
+		String(
+			"log-format",
+			string(logging.FormatText),
+			"The format of the log entries. Valid options are 'text' and 'json'.",
 		)
 	rootCommand.PersistentFlags().
 		String(
@@ -53,6 +116,27 @@ func ExecuteCLI() {
 			"The environment that the CLI is running in. Valid options are 'local', 'github-action'. For running ie in your standard terminal, local will work just fine. If using IE inside a github action, use github-action.",
 		)
 
+	rootCommand.PersistentFlags().
+		StringArray(
+			"status-reporter",
+			[]string{},
+			"Reports the status of the deployment every time it changes. Valid options are 'portal', 'jsonl:<file>', 'socket:<unix socket>' and 'webhook:<url>'. Can be repeated. Format: --status-reporter <kind>:<target>",
+		)
+
+	rootCommand.PersistentFlags().
+		String(
+			"otel-endpoint",
+			"",
+			"Exports a trace of each scenario to the OTLP collector listening for HTTP at this URL, I.E. http://localhost:4318. Traces aren't exported by default.",
+		)
+
+	rootCommand.PersistentFlags().
+		String(
+			"profile",
+			"",
+			"Selects a profile of the configuration files (~/.config/ie/config.yaml and .ie.yaml) to use as defaults. Defaults to $IE_PROFILE.",
+		)
+
 	rootCommand.PersistentFlags().
 		StringArray(
 			"feature",
@@ -63,6 +147,6 @@ func ExecuteCLI() {
 	if err := rootCommand.Execute(); err != nil {
 		fmt.Println(err)
 		logging.GlobalLogger.Errorf("Failed to execute ie: %s", err)
-		os.Exit(1)
+		exit(1)
 	}
 }
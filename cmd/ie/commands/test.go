@@ -2,7 +2,6 @@ package commands
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/Azure/InnovationEngine/internal/engine"
@@ -20,11 +19,17 @@ func init() {
 		String("subscription", "", "Sets the subscription ID used by a scenarios azure-cli commands. Will rely on the default subscription if not set.")
 	testCommand.PersistentFlags().
 		String("working-directory", ".", "Sets the working directory for innovation engine to operate out of. Restores the current working directory when finished.")
+	testCommand.PersistentFlags().
+		Bool("preflight", false, "Checks the syntax of every shell code block before any of them are executed.")
+	testCommand.PersistentFlags().
+		String("output", "", "Replaces the UI with a stream of events written to stdout as JSON lines. The only valid option is 'jsonl'.")
 	testCommand.PersistentFlags().
 		String("report", "", "The path to generate a report of the scenario execution. The contents of the report are in JSON and will only be generated when this flag is set.")
 
 	testCommand.PersistentFlags().
 		StringArray("var", []string{}, "Sets an environment variable for the scenario. Format: --var <key>=<value>")
+	testCommand.PersistentFlags().
+		String("var-profile", "", "Selects the section of the INI file next to the scenario that is layered on top of its [default] section. Format: --var-profile <section>")
 }
 
 var testCommand = &cobra.Command{
@@ -38,13 +43,22 @@ var testCommand = &cobra.Command{
 			return
 		}
 
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if err := validateEventOutputFormat(outputFormat); err != nil {
+			logging.GlobalLogger.Errorf("Error: %s", err)
+			fmt.Printf("Error: %s\n", err)
+			exit(1)
+		}
+
 		verbose, _ := cmd.Flags().GetBool("verbose")
 		subscription, _ := cmd.Flags().GetString("subscription")
 		workingDirectory, _ := cmd.Flags().GetString("working-directory")
 		environment, _ := cmd.Flags().GetString("environment")
 		generateReport, _ := cmd.Flags().GetString("report")
+		preflight, _ := cmd.Flags().GetBool("preflight")
 
 		environmentVariables, _ := cmd.Flags().GetStringArray("var")
+		varProfile, _ := cmd.Flags().GetString("var-profile")
 
 		// Parse the environment variables from the command line into a map
 		cliEnvironmentVariables := make(map[string]string)
@@ -55,9 +69,9 @@ var testCommand = &cobra.Command{
 					"Error: Invalid environment variable format: %s",
 					environmentVariable,
 				)
-				fmt.Printf("Error: Invalid environment variable format: %s", environmentVariable)
+				printError(outputFormat, "Error: Invalid environment variable format: %s", environmentVariable)
 				cmd.Help()
-				os.Exit(1)
+				exit(1)
 			}
 
 			cliEnvironmentVariables[keyValuePair[0]] = keyValuePair[1]
@@ -71,29 +85,33 @@ var testCommand = &cobra.Command{
 			WorkingDirectory: workingDirectory,
 			Environment:      environment,
 			ReportFile:       generateReport,
+			Preflight:        preflight,
+			EventStream:      outputFormat == outputFormatJsonl,
 		})
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error creating engine %s", err)
-			fmt.Printf("Error creating engine %s", err)
-			os.Exit(1)
+			printError(outputFormat, "Error creating engine %s", err)
+			exit(1)
 		}
 
 		scenario, err := common.CreateScenarioFromMarkdown(
 			markdownFile,
-			[]string{"bash", "azurecli", "azurecli-interactive", "terraform"},
 			cliEnvironmentVariables,
+			configVariables(),
+			varProfile,
 		)
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error creating scenario %s", err)
-			fmt.Printf("Error creating engine %s", err)
-			os.Exit(1)
+			printError(outputFormat, "Error creating engine %s", err)
+			exit(1)
 		}
+		printUnmatchedOverrides(outputFormat, scenario)
 
 		err = innovationEngine.TestScenario(scenario)
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error testing scenario: %s", err)
-			fmt.Printf("Scenario did not finish successfully.")
-			os.Exit(1)
+			printError(outputFormat, "Scenario did not finish successfully.")
+			exit(1)
 		}
 	},
 }
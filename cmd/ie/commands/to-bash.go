@@ -28,6 +28,7 @@ var toBashCommand = &cobra.Command{
 
 		environment, _ := cmd.Flags().GetString("environment")
 		environmentVariables, _ := cmd.Flags().GetStringArray("var")
+		varProfile, _ := cmd.Flags().GetString("var-profile")
 
 		// Parse the environment variables
 		cliEnvironmentVariables := make(map[string]string)
@@ -52,8 +53,10 @@ var toBashCommand = &cobra.Command{
 		// Parse the markdown file and create a scenario
 		scenario, err := common.CreateScenarioFromMarkdown(
 			markdownFile,
-			[]string{"bash", "azurecli", "azurecli-interactive", "terraform"},
-			cliEnvironmentVariables)
+			cliEnvironmentVariables,
+			configVariables(),
+			varProfile,
+		)
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error creating scenario: %s", err)
 			fmt.Printf("Error creating scenario: %s", err)
@@ -84,4 +87,6 @@ func init() {
 	rootCommand.AddCommand(toBashCommand)
 	toBashCommand.PersistentFlags().
 		StringArray("var", []string{}, "Sets an environment variable for the scenario. Format: --var <key>=<value>")
+	toBashCommand.PersistentFlags().
+		String("var-profile", "", "Selects the section of the INI file next to the scenario that is layered on top of its [default] section. Format: --var-profile <section>")
 }
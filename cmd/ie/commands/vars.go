@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+// Register the command with our command runner.
+func init() {
+	rootCommand.AddCommand(varsCommand)
+
+	// String flags
+	varsCommand.PersistentFlags().
+		String("output", "", "Renders the variables in a machine readable format instead of styled text. Valid options are 'json' and 'yaml'.")
+
+	// StringArray flags
+	varsCommand.PersistentFlags().
+		StringArray("var", []string{}, "Sets an environment variable for the scenario. Format: --var <key>=<value>")
+	varsCommand.PersistentFlags().
+		String("var-profile", "", "Selects the section of the INI file next to the scenario that is layered on top of its [default] section. Format: --var-profile <section>")
+}
+
+var varsCommand = &cobra.Command{
+	Use:   "vars",
+	Short: "List the variables of a document and where their values come from.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		markdownFile := args[0]
+
+		outputFormat, _ := cmd.Flags().GetString("output")
+		if err := validateOutputFormat(outputFormat); err != nil {
+			logging.GlobalLogger.Errorf("Error: %s", err)
+			fmt.Printf("Error: %s\n", err)
+			exit(1)
+		}
+
+		environmentVariables, _ := cmd.Flags().GetStringArray("var")
+		varProfile, _ := cmd.Flags().GetString("var-profile")
+
+		// Parse the environment variables from the command line into a map
+		cliEnvironmentVariables := make(map[string]string)
+		for _, environmentVariable := range environmentVariables {
+			keyValuePair := strings.SplitN(environmentVariable, "=", 2)
+			if len(keyValuePair) != 2 {
+				logging.GlobalLogger.Errorf(
+					"Error: Invalid environment variable format: %s",
+					environmentVariable,
+				)
+				fmt.Printf("Error: Invalid environment variable format: %s", environmentVariable)
+				cmd.Help()
+				exit(1)
+			}
+
+			cliEnvironmentVariables[keyValuePair[0]] = keyValuePair[1]
+		}
+
+		scenario, err := common.CreateScenarioFromMarkdown(
+			markdownFile,
+			cliEnvironmentVariables,
+			configVariables(),
+			varProfile,
+		)
+		if err != nil {
+			logging.GlobalLogger.Errorf("Error creating scenario: %s", err)
+			fmt.Printf("Error creating scenario: %s", err)
+			exit(1)
+		}
+		printUnmatchedOverrides(outputFormat, scenario)
+
+		variables := common.AnalyzeScenarioVariables(scenario)
+
+		if outputFormat != "" {
+			output, err := renderStructuredOutput(outputFormat, variables)
+			if err != nil {
+				logging.GlobalLogger.Errorf("Error rendering the variables: %s", err)
+				fmt.Printf("Error rendering the variables: %s", err)
+				exit(1)
+			}
+			fmt.Print(output)
+			return
+		}
+
+		fmt.Println(ui.ScenarioTitleStyle.Render(scenario.Name))
+		for _, variable := range variables {
+			fmt.Printf("%s=%s\n", variable.Name, variable.Value)
+
+			source := string(variable.Source)
+			if variable.Section != "" {
+				source = fmt.Sprintf("%s [%s]", source, variable.Section)
+			}
+			if variable.File != "" {
+				source = fmt.Sprintf("%s (%s:%d)", source, variable.File, variable.Line)
+			}
+			printVariableDetail("source", source)
+			printVariableDetail("written by", joinVariableReferences(variable.WrittenBy))
+			printVariableDetail("read by", joinVariableReferences(variable.ReadBy))
+
+			if len(variable.UsedBeforeDefined) > 0 {
+				fmt.Println(ui.ErrorMessageStyle.Render(
+					fmt.Sprintf("  used before defined: %s", joinVariableReferences(variable.UsedBeforeDefined)),
+				))
+			}
+		}
+	},
+}
+
+func printVariableDetail(label string, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Println(ui.VerboseStyle.Render(fmt.Sprintf("  %s: %s", label, value)))
+}
+
+func joinVariableReferences(references []common.VariableReference) string {
+	var rendered []string
+	for _, reference := range references {
+		rendered = append(rendered, reference.String())
+	}
+	return strings.Join(rendered, ", ")
+}
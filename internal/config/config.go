@@ -0,0 +1,265 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The name of the project configuration file, which is searched for in the
+// directory of a document and its parents.
+const ProjectFileName = ".ie.yaml"
+
+// The environment variable that selects a profile when --profile isn't used.
+const ProfileVariable = "IE_PROFILE"
+
+// Where the value of a setting came from. Each source overrides the ones
+// before it: flags > environment variables > project > user.
+type Source string
+
+const (
+	SourceUser        Source = "user"
+	SourceProject     Source = "project"
+	SourceEnvironment Source = "env"
+	SourceFlag        Source = "flag"
+)
+
+// The settings that can be given defaults, named after the flags they are
+// defaults for.
+const (
+	SettingSubscription     = "subscription"
+	SettingEnvironment      = "environment"
+	SettingWorkingDirectory = "working-directory"
+	SettingLogLevel         = "log-level"
+)
+
+var Settings = []string{
+	SettingSubscription,
+	SettingEnvironment,
+	SettingWorkingDirectory,
+	SettingLogLevel,
+}
+
+// Defaults for the flags of IE. Variables are added to the ones set with
+// --var.
+type Profile struct {
+	Subscription     string            `yaml:"subscription"`
+	Environment      string            `yaml:"environment"`
+	WorkingDirectory string            `yaml:"working-directory"`
+	LogLevel         string            `yaml:"log-level"`
+	Vars             map[string]string `yaml:"vars"`
+}
+
+func (profile Profile) settings() map[string]string {
+	return map[string]string{
+		SettingSubscription:     profile.Subscription,
+		SettingEnvironment:      profile.Environment,
+		SettingWorkingDirectory: profile.WorkingDirectory,
+		SettingLogLevel:         profile.LogLevel,
+	}
+}
+
+// A configuration file. The settings at the top level are the defaults, and
+// the named profiles are layered on top of them when selected with --profile.
+type File struct {
+	Profile  `yaml:",inline"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// The value of a setting or variable along with where it came from.
+type Value struct {
+	Value  string `json:"value"`
+	Source Source `json:"source"`
+	// The file that set the value, empty for environment variables and flags.
+	File string `json:"file,omitempty"`
+	// The profile of the file that set the value, empty for its defaults.
+	Profile string `json:"profile,omitempty"`
+}
+
+// The defaults of a run, merged from every configuration file and
+// environment variable.
+type Config struct {
+	Profile  string           `json:"profile,omitempty"`
+	Files    []string         `json:"files"`
+	Settings map[string]Value `json:"settings"`
+	Vars     map[string]Value `json:"vars"`
+}
+
+// Gets the path of the user configuration file, which is within
+// $XDG_CONFIG_HOME, or ~/.config when it isn't set.
+func UserFile() string {
+	configDirectory := os.Getenv("XDG_CONFIG_HOME")
+	if configDirectory == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configDirectory = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configDirectory, "ie", "config.yaml")
+}
+
+// Finds the project configuration file of a document, which is the closest
+// .ie.yaml in the directory of the document or its parents. Documents
+// downloaded from a URL use the current directory. It is empty when there is
+// none.
+func FindProjectFile(document string) string {
+	directory, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	if document != "" && !strings.HasPrefix(document, "http://") && !strings.HasPrefix(document, "https://") {
+		path, err := filepath.Abs(document)
+		if err != nil {
+			return ""
+		}
+		directory = filepath.Dir(path)
+	}
+
+	for {
+		path := filepath.Join(directory, ProjectFileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+
+		parent := filepath.Dir(directory)
+		if parent == directory {
+			return ""
+		}
+		directory = parent
+	}
+}
+
+// Reads a configuration file. Unknown keys are rejected so that typos don't go
+// unnoticed.
+func LoadFile(path string) (*File, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &File{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+
+	return file, nil
+}
+
+// Gets the environment variable that sets a setting, I.E. IE_LOG_LEVEL for
+// log-level.
+func EnvironmentVariable(setting string) string {
+	return "IE_" + strings.ToUpper(strings.ReplaceAll(setting, "-", "_"))
+}
+
+// Layers the settings of a profile on top of the configuration.
+func (config *Config) apply(profile Profile, source Source, path string, profileName string) {
+	for setting, value := range profile.settings() {
+		if value == "" {
+			continue
+		}
+
+		// Relative working directories are relative to the file that sets
+		// them rather than to wherever IE is launched from.
+		if setting == SettingWorkingDirectory && path != "" && !filepath.IsAbs(value) {
+			value = filepath.Join(filepath.Dir(path), value)
+		}
+
+		config.Settings[setting] = Value{Value: value, Source: source, File: path, Profile: profileName}
+	}
+
+	for name, value := range profile.Vars {
+		config.Vars[name] = Value{Value: value, Source: source, File: path, Profile: profileName}
+	}
+}
+
+// Layers a configuration file on top of the configuration, along with the
+// selected profile when the file defines it. Files that don't exist are
+// skipped. It reports whether the file defines the profile.
+func (config *Config) applyFile(path string, source Source) (bool, error) {
+	if path == "" {
+		return false, nil
+	}
+
+	file, err := LoadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	config.Files = append(config.Files, path)
+	config.apply(file.Profile, source, path, "")
+
+	profile, ok := file.Profiles[config.Profile]
+	if config.Profile == "" || !ok {
+		return false, nil
+	}
+	config.apply(profile, source, path, config.Profile)
+	return true, nil
+}
+
+// Loads the defaults for a document from the user configuration file, the
+// project configuration file and the IE_* environment variables, in that
+// order of precedence. The profile selects a profile of the files, and
+// defaults to IE_PROFILE.
+func Load(document string, profile string) (*Config, error) {
+	if profile == "" {
+		profile = os.Getenv(ProfileVariable)
+	}
+
+	config := &Config{
+		Profile:  profile,
+		Files:    []string{},
+		Settings: make(map[string]Value),
+		Vars:     make(map[string]Value),
+	}
+
+	foundProfile := false
+	for _, file := range []struct {
+		path   string
+		source Source
+	}{
+		{UserFile(), SourceUser},
+		{FindProjectFile(document), SourceProject},
+	} {
+		found, err := config.applyFile(file.path, file.source)
+		if err != nil {
+			return nil, err
+		}
+		foundProfile = foundProfile || found
+	}
+
+	if profile != "" && !foundProfile {
+		return nil, fmt.Errorf("the profile %q isn't defined by any configuration file", profile)
+	}
+
+	for _, setting := range Settings {
+		if value, ok := os.LookupEnv(EnvironmentVariable(setting)); ok && value != "" {
+			config.Settings[setting] = Value{Value: value, Source: SourceEnvironment}
+		}
+	}
+
+	return config, nil
+}
+
+// Gets the variables loaded from the configuration files, leaving out the
+// ones set with --var.
+func (config *Config) Variables() map[string]string {
+	variables := make(map[string]string)
+	for name, value := range config.Vars {
+		if value.Source != SourceFlag {
+			variables[name] = value.Value
+		}
+	}
+	return variables
+}
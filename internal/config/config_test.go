@@ -0,0 +1,156 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Sets up a user configuration file and a project configuration file next to
+// a document, returning the path of the document.
+func setupFiles(t *testing.T, user string, project string) string {
+	configDirectory := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDirectory)
+	t.Setenv(ProfileVariable, "")
+	for _, setting := range Settings {
+		t.Setenv(EnvironmentVariable(setting), "")
+	}
+
+	if user != "" {
+		os.MkdirAll(filepath.Join(configDirectory, "ie"), 0755)
+		os.WriteFile(filepath.Join(configDirectory, "ie", "config.yaml"), []byte(user), 0644)
+	}
+
+	projectDirectory := t.TempDir()
+	if project != "" {
+		os.WriteFile(filepath.Join(projectDirectory, ProjectFileName), []byte(project), 0644)
+	}
+
+	documentDirectory := filepath.Join(projectDirectory, "docs")
+	os.MkdirAll(documentDirectory, 0755)
+	document := filepath.Join(documentDirectory, "README.md")
+	os.WriteFile(document, []byte("# Scenario\n"), 0644)
+	return document
+}
+
+func TestLoad(t *testing.T) {
+	user := `
+subscription: user-subscription
+log-level: info
+vars:
+  REGION: eastus
+  OWNER: me
+profiles:
+  ci:
+    environment: github-action
+`
+	project := `
+log-level: warn
+working-directory: workspace
+vars:
+  REGION: westus
+profiles:
+  ci:
+    vars:
+      REGION: centralus
+`
+
+	t.Run("Project files take precedence over user files", func(t *testing.T) {
+		document := setupFiles(t, user, project)
+		projectFile := filepath.Join(filepath.Dir(filepath.Dir(document)), ProjectFileName)
+
+		config, err := Load(document, "")
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{UserFile(), projectFile}, config.Files)
+		assert.Equal(t, Value{Value: "user-subscription", Source: SourceUser, File: UserFile()}, config.Settings[SettingSubscription])
+		assert.Equal(t, Value{Value: "warn", Source: SourceProject, File: projectFile}, config.Settings[SettingLogLevel])
+		assert.Equal(t, "westus", config.Vars["REGION"].Value)
+		assert.Equal(t, "me", config.Vars["OWNER"].Value)
+		assert.NotContains(t, config.Settings, SettingEnvironment)
+	})
+
+	t.Run("Environment variables take precedence over files", func(t *testing.T) {
+		document := setupFiles(t, user, project)
+		t.Setenv("IE_LOG_LEVEL", "error")
+
+		config, err := Load(document, "")
+
+		assert.NoError(t, err)
+		assert.Equal(t, Value{Value: "error", Source: SourceEnvironment}, config.Settings[SettingLogLevel])
+	})
+
+	t.Run("Profiles are layered on top of the defaults of each file", func(t *testing.T) {
+		document := setupFiles(t, user, project)
+
+		config, err := Load(document, "ci")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "ci", config.Profile)
+		assert.Equal(t, Value{Value: "github-action", Source: SourceUser, File: UserFile(), Profile: "ci"}, config.Settings[SettingEnvironment])
+		assert.Equal(t, "centralus", config.Vars["REGION"].Value)
+		assert.Equal(t, "ci", config.Vars["REGION"].Profile)
+	})
+
+	t.Run("Profiles default to IE_PROFILE", func(t *testing.T) {
+		document := setupFiles(t, user, project)
+		t.Setenv(ProfileVariable, "ci")
+
+		config, err := Load(document, "")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "ci", config.Profile)
+	})
+
+	t.Run("Unknown profiles are rejected", func(t *testing.T) {
+		document := setupFiles(t, user, project)
+
+		_, err := Load(document, "portal")
+
+		assert.ErrorContains(t, err, "portal")
+	})
+
+	t.Run("Unknown keys are rejected", func(t *testing.T) {
+		document := setupFiles(t, "subscriptoin: typo\n", "")
+
+		_, err := Load(document, "")
+
+		assert.ErrorContains(t, err, "subscriptoin")
+	})
+
+	t.Run("Relative working directories are relative to their file", func(t *testing.T) {
+		document := setupFiles(t, user, project)
+
+		config, err := Load(document, "")
+
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(filepath.Dir(filepath.Dir(document)), "workspace"), config.Settings[SettingWorkingDirectory].Value)
+	})
+
+	t.Run("Missing files are skipped", func(t *testing.T) {
+		document := setupFiles(t, "", "")
+
+		config, err := Load(document, "")
+
+		assert.NoError(t, err)
+		assert.Empty(t, config.Files)
+		assert.Empty(t, config.Settings)
+	})
+}
+
+func TestVariables(t *testing.T) {
+	config := &Config{Vars: map[string]Value{
+		"REGION": {Value: "westus", Source: SourceProject},
+		"NAME":   {Value: "a=b", Source: SourceUser},
+		"SIZE":   {Value: "large", Source: SourceFlag},
+	}}
+
+	assert.Equal(t, map[string]string{"NAME": "a=b", "REGION": "westus"}, config.Variables())
+}
+
+func TestEnvironmentVariable(t *testing.T) {
+	assert.Equal(t, "IE_WORKING_DIRECTORY", EnvironmentVariable(SettingWorkingDirectory))
+	assert.Equal(t, "IE_LOG_LEVEL", EnvironmentVariable(SettingLogLevel))
+}
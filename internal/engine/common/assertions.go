@@ -0,0 +1,173 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/Azure/InnovationEngine/internal/ui"
+)
+
+// The result of evaluating a single output assertion against the output of a
+// command.
+type AssertionResult struct {
+	Assertion string `json:"assertion"`
+	Passed    bool   `json:"passed"`
+	Message   string `json:"message"`
+	// The position of the assertion within the markdown file.
+	Position parsers.SourcePosition `json:"position"`
+}
+
+// The result of validating the output of a command against its expected output
+// and its assertions.
+type OutputValidation struct {
+	Comparison OutputComparison  `json:"comparison"`
+	Assertions []AssertionResult `json:"assertions"`
+}
+
+// Evaluates the assertions of a code block against the output of a command.
+// Every assertion is evaluated so that the results can be reported, and the
+// error returned describes all of the assertions that failed.
+func EvaluateAssertions(
+	assertions []parsers.OutputAssertion,
+	output shells.CommandOutput,
+	environmentVariables map[string]string,
+) ([]AssertionResult, error) {
+	output.StdOut = lib.NormalizeOutput(output.StdOut, lib.DefaultOutputNormalizers...)
+	output.StdErr = lib.NormalizeOutput(output.StdErr, lib.DefaultOutputNormalizers...)
+	placeholders := lib.NewPlaceholders(environmentVariables)
+
+	var results []AssertionResult
+	var failures []string
+
+	for _, assertion := range assertions {
+		result := evaluateAssertion(assertion, output, placeholders)
+		results = append(results, result)
+
+		if !result.Passed {
+			failure := fmt.Sprintf("  %s: %s", result.Assertion, result.Message)
+			if result.Position.StartLine != 0 {
+				failure = fmt.Sprintf("  %s: %s: %s", result.Position, result.Assertion, result.Message)
+			}
+			failures = append(failures, failure)
+		}
+	}
+
+	if len(failures) > 0 {
+		return results, errors.New(ui.ErrorMessageStyle.Render(
+			fmt.Sprintf(
+				"%d of %d assertions failed:\n%s",
+				len(failures),
+				len(assertions),
+				ui.VerboseStyle.Render(strings.Join(failures, "\n")),
+			),
+		))
+	}
+
+	return results, nil
+}
+
+func evaluateAssertion(
+	assertion parsers.OutputAssertion,
+	output shells.CommandOutput,
+	placeholders lib.Placeholders,
+) AssertionResult {
+	result := AssertionResult{Assertion: assertion.String(), Position: assertion.Position}
+
+	var subject string
+	switch assertion.Source {
+	case parsers.AssertionSourceStdout:
+		subject = output.StdOut
+	case parsers.AssertionSourceStderr:
+		subject = output.StdErr
+	case parsers.AssertionSourceJson:
+		value, err := lib.LookupJsonPath(output.StdOut, assertion.Path)
+		if err != nil {
+			result.Message = err.Error()
+			return result
+		}
+		subject = lib.RenderJsonValue(value)
+	case parsers.AssertionSourceStatus:
+		if output.StatusCode == 0 {
+			result.Message = "the code block did not return an HTTP response"
+			return result
+		}
+		subject = strconv.Itoa(output.StatusCode)
+	case parsers.AssertionSourceHeader:
+		values, ok := http.Header(output.Headers)[http.CanonicalHeaderKey(assertion.Path)]
+		if !ok {
+			result.Message = fmt.Sprintf("the response does not have the header %q", assertion.Path)
+			return result
+		}
+		subject = strings.Join(values, ", ")
+	default:
+		result.Message = fmt.Sprintf("unknown assertion source %q", assertion.Source)
+		return result
+	}
+
+	var matched bool
+	switch assertion.Operator {
+	case parsers.AssertionOperatorContains:
+		matched = strings.Contains(subject, assertion.Value)
+	case parsers.AssertionOperatorEquals:
+		if placeholders.Contains(assertion.Value) {
+			matched = placeholders.Matches(assertion.Value, subject)
+		} else {
+			matched = subject == assertion.Value
+		}
+	case parsers.AssertionOperatorMatches:
+		matched = assertion.Regex != nil && assertion.Regex.MatchString(subject)
+	default:
+		result.Message = fmt.Sprintf("unknown assertion operator %q", assertion.Operator)
+		return result
+	}
+
+	result.Passed = matched != assertion.Negated
+	if result.Passed {
+		result.Message = "passed"
+	} else {
+		result.Message = fmt.Sprintf("got %q", subject)
+	}
+
+	return result
+}
+
+// Validates the output of a command against the expected output block and the
+// assertions of the code block. Both checks are always performed so that their
+// results can be reported, and the first error encountered is returned.
+// The output is only compared when the code block has an expected output.
+func ValidateCommandOutput(
+	codeBlock parsers.CodeBlock,
+	output shells.CommandOutput,
+	environmentVariables map[string]string,
+) (OutputValidation, error) {
+	validation := OutputValidation{}
+
+	// Code blocks without an expected output have nothing to compare against.
+	var comparisonErr error
+	if HasExpectedOutput(codeBlock.ExpectedOutput) {
+		validation.Comparison, comparisonErr = CompareCommandOutputs(
+			output.StdOut,
+			codeBlock.ExpectedOutput,
+			environmentVariables,
+		)
+	}
+
+	assertions, assertionErr := EvaluateAssertions(
+		codeBlock.Assertions,
+		output,
+		environmentVariables,
+	)
+	validation.Assertions = assertions
+
+	if comparisonErr != nil {
+		return validation, comparisonErr
+	}
+
+	return validation, assertionErr
+}
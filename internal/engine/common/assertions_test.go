@@ -0,0 +1,107 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/stretchr/testify/assert"
+)
+
+func mustParseAssertions(t *testing.T, lines ...string) []parsers.OutputAssertion {
+	var assertions []parsers.OutputAssertion
+	for _, line := range lines {
+		assertion, err := parsers.ParseOutputAssertion(line)
+		assert.NoError(t, err)
+		assertions = append(assertions, assertion)
+	}
+	return assertions
+}
+
+func TestEvaluateAssertions(t *testing.T) {
+	stdout := `{"name": "rg-42", "properties": {"provisioningState": "Succeeded", "count": 3}}`
+
+	t.Run("All assertions pass", func(t *testing.T) {
+		results, err := EvaluateAssertions(
+			mustParseAssertions(t,
+				`stdout contains rg-42`,
+				`stderr not matches "(?i)error"`,
+				`json .properties.provisioningState equals Succeeded`,
+				`json .properties.count equals 3`,
+				`json .name equals <VAR:MY_RESOURCE_GROUP>`,
+			),
+			shells.CommandOutput{StdOut: stdout, StdErr: "warning: something\n"},
+			map[string]string{"MY_RESOURCE_GROUP": "rg-42"},
+		)
+
+		assert.NoError(t, err)
+		assert.Len(t, results, 5)
+		for _, result := range results {
+			assert.True(t, result.Passed, result.Assertion)
+		}
+	})
+
+	t.Run("Failures are reported for each assertion", func(t *testing.T) {
+		results, err := EvaluateAssertions(
+			mustParseAssertions(t,
+				`stdout contains rg-42`,
+				`json .properties.provisioningState not equals Succeeded`,
+				`json .properties.missing equals value`,
+			),
+			shells.CommandOutput{StdOut: stdout},
+			nil,
+		)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "2 of 3 assertions failed")
+		assert.True(t, results[0].Passed)
+		assert.False(t, results[1].Passed)
+		assert.Equal(t, `got "Succeeded"`, results[1].Message)
+		assert.False(t, results[2].Passed)
+		assert.Contains(t, results[2].Message, "does not exist")
+	})
+}
+
+func TestValidateCommandOutput(t *testing.T) {
+	codeBlock := parsers.CodeBlock{
+		Content:    "echo hello",
+		Assertions: mustParseAssertions(t, `stdout not contains goodbye`),
+	}
+
+	t.Run("Assertions without an expected output", func(t *testing.T) {
+		validation, err := ValidateCommandOutput(
+			codeBlock,
+			shells.CommandOutput{StdOut: "hello\n"},
+			nil,
+		)
+
+		assert.NoError(t, err)
+		assert.Len(t, validation.Assertions, 1)
+		assert.True(t, validation.Assertions[0].Passed)
+	})
+
+	t.Run("Blocks without an expected output aren't compared", func(t *testing.T) {
+		for _, algorithm := range []string{"exact", "structural"} {
+			block := parsers.CodeBlock{
+				Content:        "echo hello",
+				ExpectedOutput: parsers.ExpectedOutputBlock{SimilarityAlgorithm: algorithm},
+			}
+
+			validation, err := ValidateCommandOutput(block, shells.CommandOutput{StdOut: "hello\n"}, nil)
+
+			assert.NoError(t, err, algorithm)
+			assert.Equal(t, OutputComparison{}, validation.Comparison)
+		}
+	})
+
+	t.Run("Failing assertions fail the validation", func(t *testing.T) {
+		validation, err := ValidateCommandOutput(
+			codeBlock,
+			shells.CommandOutput{StdOut: "hello goodbye\n"},
+			nil,
+		)
+
+		assert.Error(t, err)
+		assert.False(t, validation.Assertions[0].Passed)
+	})
+}
@@ -0,0 +1,183 @@
+package common
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+)
+
+// How often the readiness conditions of a background process are checked.
+const readinessPollInterval = 100 * time.Millisecond
+
+// The background processes started by the scenario being executed, which are
+// terminated when the scenario ends.
+var (
+	backgroundProcesses      []*shells.BackgroundCommand
+	backgroundProcessesMutex sync.Mutex
+)
+
+// The final state of a background process, recorded once it is terminated.
+type BackgroundProcessResult struct {
+	Command string `json:"command"`
+	Pid     int    `json:"pid"`
+	Logs    string `json:"logs"`
+	Error   string `json:"error"`
+}
+
+// Starts a code block marked with `ie:background` and waits until one of its
+// readiness conditions is met. The process keeps running until
+// StopBackgroundProcesses is called, and the output returned contains the logs
+// of the process up to the point it became ready.
+func StartBackgroundCodeBlock(
+	codeBlock parsers.CodeBlock,
+	env map[string]string,
+) (shells.CommandOutput, error) {
+	process, err := shells.StartBackgroundCommand(codeBlock.Content, shells.BashCommandConfiguration{
+		EnvironmentVariables: env,
+		InheritEnvironment:   true,
+		InteractiveCommand:   false,
+		WriteToHistory:       false,
+	})
+	if err != nil {
+		return shells.CommandOutput{}, err
+	}
+
+	backgroundProcessesMutex.Lock()
+	backgroundProcesses = append(backgroundProcesses, process)
+	backgroundProcessesMutex.Unlock()
+
+	logging.GlobalLogger.Infof("Started background process %d:\n %s", process.Pid(), codeBlock.Content)
+
+	condition := parsers.BackgroundProcess{Timeout: parsers.DefaultReadinessTimeout}
+	if codeBlock.Background != nil {
+		condition = *codeBlock.Background
+	}
+
+	err = waitForReadiness(process, condition, lib.GetCurrentEnvironment(env))
+	return shells.CommandOutput{StdOut: process.Logs()}, err
+}
+
+// Polls the readiness conditions of a background process until one of them is
+// met, the process fails, or the timeout is reached. The conditions are checked
+// before whether the process exited, as a command that ends with `&` exits as
+// soon as it has started its processes.
+func waitForReadiness(
+	process *shells.BackgroundCommand,
+	condition parsers.BackgroundProcess,
+	env map[string]string,
+) error {
+	readyFile := condition.ReadyFile
+	if readyFile != "" {
+		readyFile = resolveScenarioPath(readyFile, env)
+	}
+
+	hasCondition := condition.ReadyRegex != nil || condition.ReadyAddress != "" || readyFile != ""
+	deadline := time.Now().Add(condition.Timeout)
+
+	for {
+		if !hasCondition {
+			return nil
+		}
+
+		if condition.ReadyRegex != nil && condition.ReadyRegex.MatchString(process.Logs()) {
+			logging.GlobalLogger.Infof("Background process %d is ready, output matched %q", process.Pid(), condition.ReadyRegex)
+			return nil
+		}
+
+		if condition.ReadyAddress != "" {
+			connection, err := net.DialTimeout("tcp", condition.ReadyAddress, readinessPollInterval)
+			if err == nil {
+				connection.Close()
+				logging.GlobalLogger.Infof("Background process %d is ready, %s is accepting connections", process.Pid(), condition.ReadyAddress)
+				return nil
+			}
+		}
+
+		if readyFile != "" {
+			if _, err := os.Stat(readyFile); err == nil {
+				logging.GlobalLogger.Infof("Background process %d is ready, %s exists", process.Pid(), readyFile)
+				return nil
+			}
+		}
+
+		// A command that exits successfully may have left its processes
+		// running in the background, I.E. `npm start &`, so only a failure
+		// stops the wait early.
+		if exited, err := process.Exited(); exited && err != nil {
+			return fmt.Errorf(
+				"background process exited before it was ready (%v), logs:\n%s",
+				err,
+				process.Logs(),
+			)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf(
+				"background process was not ready after %s, logs:\n%s",
+				condition.Timeout,
+				process.Logs(),
+			)
+		}
+
+		time.Sleep(readinessPollInterval)
+	}
+}
+
+// Terminates every background process started by the scenario and returns
+// their final state.
+func StopBackgroundProcesses() []BackgroundProcessResult {
+	backgroundProcessesMutex.Lock()
+	processes := backgroundProcesses
+	backgroundProcesses = nil
+	backgroundProcessesMutex.Unlock()
+
+	var results []BackgroundProcessResult
+	for _, process := range processes {
+		result := BackgroundProcessResult{Command: process.Command, Pid: process.Pid()}
+
+		logging.GlobalLogger.Infof("Stopping background process %d", process.Pid())
+		if err := process.Stop(); err != nil {
+			logging.GlobalLogger.Errorf("Error stopping background process %d: %s", process.Pid(), err)
+			result.Error = err.Error()
+		}
+
+		result.Logs = process.Logs()
+		logging.GlobalLogger.Infof("Logs of background process %d:\n %s", process.Pid(), result.Logs)
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// What a scenario left behind when it was torn down.
+type ScenarioTeardown struct {
+	BackgroundProcesses []BackgroundProcessResult
+	Files               []MaterializedFile
+}
+
+// Releases everything a scenario left running once it ends: background
+// processes are terminated and executors that keep state between code blocks
+// are torn down. The resources and files created by the scenario are deleted
+// unless they should be preserved.
+func TeardownScenario(preserveResources bool) ScenarioTeardown {
+	finishCleanup := Trace.StartCleanup("Teardown")
+
+	teardown := ScenarioTeardown{BackgroundProcesses: StopBackgroundProcesses()}
+
+	err := shells.TeardownExecutors(shells.TeardownOptions{PreserveResources: preserveResources})
+	if err != nil {
+		logging.GlobalLogger.Errorf("Error tearing down executors: %s", err)
+	}
+
+	teardown.Files = RemoveMaterializedFiles(preserveResources)
+	finishCleanup(err)
+
+	return teardown
+}
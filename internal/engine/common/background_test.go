@@ -0,0 +1,106 @@
+package common
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartBackgroundCodeBlock(t *testing.T) {
+	backgroundCodeBlock := func(content string, arguments string) parsers.CodeBlock {
+		process, err := parsers.ParseBackgroundProcess(arguments)
+		assert.NoError(t, err)
+		return parsers.CodeBlock{Content: content, Background: &process}
+	}
+
+	t.Run("Ready when the output matches", func(t *testing.T) {
+		output, err := StartBackgroundCodeBlock(
+			backgroundCodeBlock(
+				"echo starting; sleep 0.2; echo 'Listening on 8080'; sleep 60",
+				`ready_regex="Listening on \d+" timeout=5s`,
+			),
+			nil,
+		)
+
+		assert.NoError(t, err)
+		assert.Contains(t, output.StdOut, "Listening on 8080")
+
+		results := StopBackgroundProcesses()
+		assert.Len(t, results, 1)
+		assert.Empty(t, results[0].Error)
+		assert.Equal(t, "starting\nListening on 8080\n", results[0].Logs)
+	})
+
+	t.Run("Ready when the port is open", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer listener.Close()
+
+		_, err = StartBackgroundCodeBlock(
+			backgroundCodeBlock("sleep 60", "ready_port="+listener.Addr().String()+" timeout=5s"),
+			nil,
+		)
+
+		assert.NoError(t, err)
+		assert.Len(t, StopBackgroundProcesses(), 1)
+	})
+
+	t.Run("Ready when the file exists", func(t *testing.T) {
+		readyFile := filepath.Join(t.TempDir(), "ready")
+
+		_, err := StartBackgroundCodeBlock(
+			backgroundCodeBlock(
+				"sleep 0.2; touch $READY_FILE; sleep 60",
+				"ready_file=$READY_FILE timeout=5s",
+			),
+			map[string]string{"READY_FILE": readyFile},
+		)
+
+		assert.NoError(t, err)
+		assert.Len(t, StopBackgroundProcesses(), 1)
+	})
+
+	t.Run("Ready when a command ending with & starts its process", func(t *testing.T) {
+		output, err := StartBackgroundCodeBlock(
+			backgroundCodeBlock(
+				"(sleep 0.2; echo 'Listening on 8080'; sleep 60) &",
+				`ready_regex="Listening on \d+" timeout=5s`,
+			),
+			nil,
+		)
+
+		assert.NoError(t, err)
+		assert.Contains(t, output.StdOut, "Listening on 8080")
+		assert.Len(t, StopBackgroundProcesses(), 1)
+	})
+
+	t.Run("Fails when the process exits early", func(t *testing.T) {
+		_, err := StartBackgroundCodeBlock(
+			backgroundCodeBlock("echo crashed; exit 1", `ready_regex="never"`),
+			nil,
+		)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "crashed")
+		StopBackgroundProcesses()
+	})
+
+	t.Run("Fails when the process is never ready", func(t *testing.T) {
+		start := time.Now()
+		_, err := StartBackgroundCodeBlock(
+			backgroundCodeBlock("sleep 60", `ready_regex="never" timeout=300ms`),
+			nil,
+		)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "was not ready")
+		assert.Less(t, time.Since(start), 5*time.Second)
+
+		results := StopBackgroundProcesses()
+		assert.Len(t, results, 1)
+	})
+}
@@ -5,15 +5,18 @@ import "github.com/Azure/InnovationEngine/internal/parsers"
 // State for the codeblock in interactive mode. Used to keep track of the
 // state of each codeblock.
 type StatefulCodeBlock struct {
-	CodeBlock       parsers.CodeBlock `json:"codeBlock"`
-	CodeBlockNumber int               `json:"codeBlockNumber"`
-	Error           error             `json:"error"`
-	StdErr          string            `json:"stdErr"`
-	StdOut          string            `json:"stdOut"`
-	StepName        string            `json:"stepName"`
-	StepNumber      int               `json:"stepNumber"`
-	Success         bool              `json:"success"`
-	SimilarityScore float64           `json:"similarityScore"`
+	CodeBlock           parsers.CodeBlock `json:"codeBlock"`
+	CodeBlockNumber     int               `json:"codeBlockNumber"`
+	Error               error             `json:"error"`
+	StdErr              string            `json:"stdErr"`
+	StdOut              string            `json:"stdOut"`
+	StepName            string            `json:"stepName"`
+	StepNumber          int               `json:"stepNumber"`
+	Success             bool              `json:"success"`
+	SimilarityScore     float64           `json:"similarityScore"`
+	SimilarityAlgorithm string            `json:"similarityAlgorithm"`
+	AssertionResults    []AssertionResult `json:"assertions"`
+	Wait                *WaitResult       `json:"wait,omitempty"`
 }
 
 // Checks if a codeblock was executed by looking at the
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/Azure/InnovationEngine/internal/engine/environments"
+	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
 	"github.com/Azure/InnovationEngine/internal/parsers"
 	"github.com/Azure/InnovationEngine/internal/shells"
@@ -12,17 +13,26 @@ import (
 
 // Emitted when a command has been executed successfully.
 type SuccessfulCommandMessage struct {
-	StdOut          string
-	StdErr          string
-	SimilarityScore float64
+	StdOut              string
+	StdErr              string
+	SimilarityScore     float64
+	SimilarityAlgorithm string
+	AssertionResults    []AssertionResult
+	Wait                *WaitResult
 }
 
 // Emitted when a command has failed to execute.
 type FailedCommandMessage struct {
-	StdOut          string
-	StdErr          string
-	Error           error
-	SimilarityScore float64
+	StdOut string
+	StdErr string
+	Error  error
+	// The exit code of the command, which is 0 when the command exited
+	// successfully but its output didn't match.
+	ExitCode            int
+	SimilarityScore     float64
+	SimilarityAlgorithm string
+	AssertionResults    []AssertionResult
+	Wait                *WaitResult
 }
 
 type ExitMessage struct {
@@ -35,6 +45,69 @@ func Exit(encounteredFailure bool) tea.Cmd {
 	}
 }
 
+// Prefixes an error caused by a code block with the position of the code block
+// within its markdown file, I.E. `docs/deploy.md:12: <error>`, so that the
+// failing code block can be found in long documents.
+func CodeBlockError(codeBlock parsers.CodeBlock, err error) error {
+	if err == nil || codeBlock.Position.StartLine == 0 {
+		return err
+	}
+	return fmt.Errorf("%s: %w", codeBlock.Position, err)
+}
+
+// Adds the traceparent of the code block that is executing to the variables
+// its commands are executed with, so that the commands can join the trace of
+// the scenario.
+func withTraceparent(env map[string]string) map[string]string {
+	traceparent := Trace.Traceparent()
+	if traceparent == "" {
+		return env
+	}
+
+	env = lib.CopyMap(env)
+	env[lib.TraceparentVariable] = traceparent
+	return env
+}
+
+// Executes a code block without any interaction and returns its output.
+// Code blocks with a file attribute are written to that file, background
+// processes are started and left running, and everything else is executed by
+// the executor registered for the language of the code block.
+func ExecuteCodeBlock(codeBlock parsers.CodeBlock, env map[string]string) (shells.CommandOutput, error) {
+	env = withTraceparent(env)
+
+	if codeBlock.File != nil {
+		return MaterializeCodeBlock(codeBlock, env)
+	}
+
+	if codeBlock.Background != nil {
+		return StartBackgroundCodeBlock(codeBlock, env)
+	}
+
+	// Code blocks without a language have always been executed with bash.
+	language := codeBlock.Language
+	if language == "" {
+		language = shells.DefaultExecutorLanguage
+	}
+
+	executor, err := shells.GetExecutor(language)
+	if err != nil {
+		return shells.CommandOutput{}, err
+	}
+
+	return executor.Execute(codeBlock.Content, shells.ExecutorConfiguration{
+		BashCommandConfiguration: shells.BashCommandConfiguration{
+			EnvironmentVariables: env,
+			InheritEnvironment:   true,
+			InteractiveCommand:   false,
+			WriteToHistory:       true,
+			StdOutWriter:         Events.OutputWriter(OutputStreamStdOut),
+			StdErrWriter:         Events.OutputWriter(OutputStreamStdErr),
+		},
+		Attributes: codeBlock.Attributes,
+	})
+}
+
 // Executes a bash command and returns a tea message with the output. This function
 // will be executed asycnhronously.
 func ExecuteCodeBlockAsync(codeBlock parsers.CodeBlock, env map[string]string) tea.Cmd {
@@ -42,59 +115,101 @@ func ExecuteCodeBlockAsync(codeBlock parsers.CodeBlock, env map[string]string) t
 		logging.GlobalLogger.Infof(
 			"Executing command asynchronously:\n %s", codeBlock.Content)
 
-		output, err := shells.ExecuteBashCommand(codeBlock.Content, shells.BashCommandConfiguration{
-			EnvironmentVariables: env,
-			InheritEnvironment:   true,
-			InteractiveCommand:   false,
-			WriteToHistory:       true,
-		})
+		execute := func() (shells.CommandOutput, error) {
+			return ExecuteCodeBlock(codeBlock, env)
+		}
+
+		if codeBlock.WaitUntil != nil {
+			return pollCodeBlockAsync(codeBlock, env, execute)
+		}
+
+		output, err := execute()
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error executing command:\n %s", err.Error())
 			return FailedCommandMessage{
 				StdOut:          output.StdOut,
 				StdErr:          output.StdErr,
-				Error:           err,
+				Error:           CodeBlockError(codeBlock, err),
+				ExitCode:        ExitCode(err),
 				SimilarityScore: 0,
 			}
 		}
 
-		// Check command output against the expected output.
-		actualOutput := output.StdOut
-		expectedOutput := codeBlock.ExpectedOutput.Content
-		expectedSimilarity := codeBlock.ExpectedOutput.ExpectedSimilarity
-		expectedRegex := codeBlock.ExpectedOutput.ExpectedRegex
-		expectedOutputLanguage := codeBlock.ExpectedOutput.Language
-
-		score, outputComparisonError := CompareCommandOutputs(
-			actualOutput,
-			expectedOutput,
-			expectedSimilarity,
-			expectedRegex,
-			expectedOutputLanguage,
+		// Check command output against the expected output and assertions.
+		validation, validationError := ValidateCommandOutput(
+			codeBlock,
+			output,
+			lib.GetCurrentEnvironment(env),
 		)
 
-		if outputComparisonError != nil {
+		if validationError != nil {
 			logging.GlobalLogger.Errorf(
-				"Error comparing command outputs: %s",
-				outputComparisonError.Error(),
+				"Error validating command outputs: %s",
+				validationError.Error(),
 			)
 
 			return FailedCommandMessage{
-				StdOut:          output.StdOut,
-				StdErr:          output.StdErr,
-				Error:           outputComparisonError,
-				SimilarityScore: score,
+				StdOut:              output.StdOut,
+				StdErr:              output.StdErr,
+				Error:               CodeBlockError(codeBlock, validationError),
+				SimilarityScore:     validation.Comparison.Score,
+				SimilarityAlgorithm: validation.Comparison.Algorithm,
+				AssertionResults:    validation.Assertions,
 			}
 
 		}
 
 		logging.GlobalLogger.Infof("Command output to stdout:\n %s", output.StdOut)
 		return SuccessfulCommandMessage{
-			StdOut:          output.StdOut,
-			StdErr:          output.StdErr,
-			SimilarityScore: score,
+			StdOut:              output.StdOut,
+			StdErr:              output.StdErr,
+			SimilarityScore:     validation.Comparison.Score,
+			SimilarityAlgorithm: validation.Comparison.Algorithm,
+			AssertionResults:    validation.Assertions,
+		}
+	}
+}
+
+// Polls a code block with a wait-until condition, sending the progress of
+// each unsuccessful poll to the running program.
+func pollCodeBlockAsync(
+	codeBlock parsers.CodeBlock,
+	env map[string]string,
+	execute func() (shells.CommandOutput, error),
+) tea.Msg {
+	output, wait, err := PollCodeBlock(codeBlock, execute, env, func(progress WaitProgressMessage) {
+		if Program != nil {
+			Program.Send(progress)
+		}
+	})
+
+	// Validate the last output again so that its score and assertions can be
+	// reported.
+	validation, _ := ValidateCommandOutput(codeBlock, output, lib.GetCurrentEnvironment(env))
+
+	if err != nil {
+		logging.GlobalLogger.Errorf("Error waiting for command:\n %s", err.Error())
+		return FailedCommandMessage{
+			StdOut:              output.StdOut,
+			StdErr:              output.StdErr,
+			Error:               CodeBlockError(codeBlock, err),
+			ExitCode:            ExitCode(err),
+			SimilarityScore:     validation.Comparison.Score,
+			SimilarityAlgorithm: validation.Comparison.Algorithm,
+			AssertionResults:    validation.Assertions,
+			Wait:                &wait,
 		}
 	}
+
+	logging.GlobalLogger.Infof("Command output to stdout:\n %s", output.StdOut)
+	return SuccessfulCommandMessage{
+		StdOut:              output.StdOut,
+		StdErr:              output.StdErr,
+		SimilarityScore:     validation.Comparison.Score,
+		SimilarityAlgorithm: validation.Comparison.Algorithm,
+		AssertionResults:    validation.Assertions,
+		Wait:                &wait,
+	}
 }
 
 // Executes a bash command syncrhonously. This function will block until the command
@@ -106,7 +221,7 @@ func ExecuteCodeBlockSync(codeBlock parsers.CodeBlock, env map[string]string) te
 	output, err := shells.ExecuteBashCommand(
 		codeBlock.Content,
 		shells.BashCommandConfiguration{
-			EnvironmentVariables: env,
+			EnvironmentVariables: withTraceparent(env),
 			InheritEnvironment:   true,
 			InteractiveCommand:   true,
 			WriteToHistory:       true,
@@ -117,9 +232,10 @@ func ExecuteCodeBlockSync(codeBlock parsers.CodeBlock, env map[string]string) te
 
 	if err != nil {
 		return FailedCommandMessage{
-			StdOut: output.StdOut,
-			StdErr: output.StdErr,
-			Error:  err,
+			StdOut:   output.StdOut,
+			StdErr:   output.StdErr,
+			Error:    CodeBlockError(codeBlock, err),
+			ExitCode: ExitCode(err),
 		}
 	}
 
@@ -141,8 +257,10 @@ func ClearScreen() tea.Cmd {
 }
 
 // Updates the azure status with the current state of the interactive mode
-// model.
+// model. The status is copied when the command is created, since the model
+// keeps changing it while the command runs.
 func UpdateAzureStatus(azureStatus environments.AzureDeploymentStatus, environment string) tea.Cmd {
+	azureStatus = azureStatus.Snapshot()
 	return func() tea.Msg {
 		logging.GlobalLogger.Tracef(
 			"Attempting to update the azure status: %+v",
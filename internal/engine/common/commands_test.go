@@ -0,0 +1,125 @@
+package common
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestExecuteCodeBlock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status": "healthy", "checks": {"database": "ok"}}`))
+	}))
+	defer server.Close()
+
+	codeBlock := parsers.CodeBlock{
+		Language:   "http",
+		Content:    "GET $ENDPOINT/health\nAccept: application/json\n",
+		Attributes: map[string]string{"timeout": "5s", "retries": "1"},
+		Assertions: mustParseAssertions(t,
+			`status equals 200`,
+			`header content-type contains json`,
+			`json $.checks.database equals ok`,
+		),
+		ExpectedOutput: parsers.ExpectedOutputBlock{
+			Language:           "json",
+			Content:            `{"status": "healthy", "checks": {"database": "<ANY>"}}`,
+			ExpectedSimilarity: 1.0,
+		},
+	}
+	env := map[string]string{"ENDPOINT": server.URL}
+
+	t.Run("Responses are validated", func(t *testing.T) {
+		output, err := ExecuteCodeBlock(codeBlock, env)
+		assert.NoError(t, err)
+
+		validation, err := ValidateCommandOutput(codeBlock, output, env)
+		assert.NoError(t, err)
+		assert.Equal(t, 1.0, validation.Comparison.Score)
+		assert.Len(t, validation.Assertions, 3)
+	})
+
+	t.Run("Unexpected status codes fail", func(t *testing.T) {
+		notFound := codeBlock
+		notFound.Content = "GET $ENDPOINT/health\n"
+		notFound.Assertions = mustParseAssertions(t, `status not equals 200`)
+
+		output, err := ExecuteCodeBlock(notFound, env)
+		assert.NoError(t, err)
+
+		_, err = ValidateCommandOutput(notFound, output, env)
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid attributes", func(t *testing.T) {
+		invalid := codeBlock
+		invalid.Attributes = map[string]string{"retries": "many"}
+
+		_, err := ExecuteCodeBlock(invalid, env)
+		assert.Error(t, err)
+	})
+}
+
+func TestCodeBlockError(t *testing.T) {
+	err := errors.New("exit status 1")
+
+	t.Run("Errors are prefixed with the position of the code block", func(t *testing.T) {
+		codeBlock := parsers.CodeBlock{
+			Position: parsers.SourcePosition{File: "docs/deploy.md", StartLine: 12, EndLine: 14},
+		}
+
+		wrapped := CodeBlockError(codeBlock, err)
+		assert.EqualError(t, wrapped, "docs/deploy.md:12: exit status 1")
+		assert.ErrorIs(t, wrapped, err)
+	})
+
+	t.Run("Code blocks without a position leave the error alone", func(t *testing.T) {
+		assert.Equal(t, err, CodeBlockError(parsers.CodeBlock{}, err))
+		assert.NoError(t, CodeBlockError(parsers.CodeBlock{}, nil))
+	})
+}
+
+func TestExecuteCodeBlockTraceparent(t *testing.T) {
+	tracing.SetSpanProcessor(tracetest.NewSpanRecorder())
+	defer tracing.Shutdown()
+	defer lib.DeleteEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+	defer lib.DeleteWorkingDirectoryStateFile(lib.DefaultWorkingDirectoryStateFile)
+
+	codeBlock := parsers.CodeBlock{Language: "bash", Content: "echo $TRACEPARENT"}
+
+	Trace = tracing.StartScenario("Scenario", "test", "", nil)
+	defer func() { Trace = nil }()
+
+	t.Run("Commands join the span of their code block", func(t *testing.T) {
+		Trace.StartBlock(0, "Step", 0, codeBlock)
+		traceparent := Trace.Traceparent()
+		output, err := ExecuteCodeBlock(codeBlock, map[string]string{})
+		Trace.FinishBlock(0, 0, 0, err)
+
+		assert.NoError(t, err)
+		assert.NotEmpty(t, traceparent)
+		assert.Equal(t, traceparent+"\n", output.StdOut)
+	})
+
+	t.Run("The traceparent isn't shared with the next code block", func(t *testing.T) {
+		env, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+		assert.NoError(t, err)
+		assert.NotContains(t, env, lib.TraceparentVariable)
+
+		Trace.StartBlock(0, "Step", 1, codeBlock)
+		traceparent := Trace.Traceparent()
+		output, err := ExecuteCodeBlock(codeBlock, map[string]string{})
+		Trace.FinishBlock(0, 0, 0, err)
+
+		assert.NoError(t, err)
+		assert.Equal(t, traceparent+"\n", output.StdOut)
+	})
+}
@@ -0,0 +1,417 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+)
+
+// The version of the schema of the events. It is incremented whenever a field
+// is removed or its meaning changes.
+const EventSchemaVersion = 1
+
+// The most output that a single block_output event carries. Longer output is
+// split across several events.
+const MaxEventChunkLength = 4096
+
+// The kinds of events emitted while a scenario runs.
+type EventType string
+
+const (
+	EventScenarioStarted  EventType = "scenario_started"
+	EventStepStarted      EventType = "step_started"
+	EventBlockStarted     EventType = "block_started"
+	EventBlockOutput      EventType = "block_output"
+	EventBlockFinished    EventType = "block_finished"
+	EventVariableChanged  EventType = "variable_changed"
+	EventScenarioFinished EventType = "scenario_finished"
+)
+
+// The streams that the output of a code block is written to.
+const (
+	OutputStreamStdOut = "stdout"
+	OutputStreamStdErr = "stderr"
+)
+
+// Something that happened while a scenario ran. Every event has a type and a
+// time, and the rest of the fields are only set for the types they are
+// documented for. docs/specs/events.md describes each type of event.
+type Event struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Type          EventType `json:"type"`
+	Time          time.Time `json:"time"`
+
+	// The name of the scenario and its number of steps, set by
+	// scenario_started.
+	Scenario string `json:"scenario,omitempty"`
+	Steps    *int   `json:"steps,omitempty"`
+
+	// The step and code block the event belongs to, numbered from zero.
+	Step      *int   `json:"step,omitempty"`
+	StepName  string `json:"stepName,omitempty"`
+	CodeBlock *int   `json:"codeBlock,omitempty"`
+
+	// The code block that started, set by block_started.
+	Language string                  `json:"language,omitempty"`
+	Content  string                  `json:"content,omitempty"`
+	Position *parsers.SourcePosition `json:"position,omitempty"`
+
+	// A chunk of output, set by block_output.
+	Stream string `json:"stream,omitempty"`
+	Data   string `json:"data,omitempty"`
+
+	// The result of a code block, set by block_finished. Success and Error
+	// are also set by scenario_finished.
+	Success             *bool    `json:"success,omitempty"`
+	ExitCode            *int     `json:"exitCode,omitempty"`
+	SimilarityScore     *float64 `json:"similarityScore,omitempty"`
+	SimilarityAlgorithm string   `json:"similarityAlgorithm,omitempty"`
+	DurationMs          *int64   `json:"durationMs,omitempty"`
+	Error               string   `json:"error,omitempty"`
+
+	// The variable that changed, set by variable_changed.
+	Name  string  `json:"name,omitempty"`
+	Value *string `json:"value,omitempty"`
+}
+
+// The result of executing a code block.
+type BlockResult struct {
+	StdOut              string
+	StdErr              string
+	ExitCode            int
+	Success             bool
+	SimilarityScore     float64
+	SimilarityAlgorithm string
+	// The number of times the code block was executed when it waits for a
+	// condition.
+	Polls int
+	Error error
+}
+
+// Gets the exit code of the process behind an error. It is 0 without an
+// error, and -1 when the error didn't come from a process exiting.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		return exitError.ExitCode()
+	}
+	return -1
+}
+
+// Variables that the shell changes on its own, which aren't reported by
+// variable_changed.
+var shellManagedVariables = map[string]bool{
+	"_":      true,
+	"OLDPWD": true,
+	"PWD":    true,
+	"SHLVL":  true,
+}
+
+// Emits the events of a scenario as it runs. Every event is written to the
+// writer as a line of JSON when there is one, and recorded so that it can be
+// added to the report. The output of code blocks is already part of the
+// report, so block_output events are only written.
+//
+// The methods of a nil event log do nothing, so that code blocks can be
+// executed without one.
+type EventLog struct {
+	mutex    sync.Mutex
+	writer   io.Writer
+	recorded []Event
+
+	// The code block that is executing.
+	step           int
+	codeBlock      int
+	blockStartedAt time.Time
+	// Whether the output of the code block was streamed as it was produced,
+	// along with the bytes of a character that was split between writes.
+	streamed bool
+	partial  map[string][]byte
+
+	// The variables as of the last code block.
+	environment map[string]string
+}
+
+func NewEventLog(writer io.Writer) *EventLog {
+	return &EventLog{
+		writer:      writer,
+		step:        -1,
+		codeBlock:   -1,
+		partial:     make(map[string][]byte),
+		environment: make(map[string]string),
+	}
+}
+
+func pointer[T any](value T) *T {
+	return &value
+}
+
+// Writes an event and records it. The mutex must be held.
+func (log *EventLog) emit(event Event) {
+	event.SchemaVersion = EventSchemaVersion
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	if event.Type != EventBlockOutput {
+		log.recorded = append(log.recorded, event)
+	}
+
+	if log.writer == nil {
+		return
+	}
+
+	// Commands are easier to read without their HTML characters escaped.
+	var line bytes.Buffer
+	encoder := json.NewEncoder(&line)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(event); err != nil {
+		logging.GlobalLogger.Errorf("Failed to marshal the %s event: %s", event.Type, err)
+		return
+	}
+
+	if _, err := log.writer.Write(line.Bytes()); err != nil {
+		logging.GlobalLogger.Errorf("Failed to write the %s event: %s", event.Type, err)
+	}
+}
+
+// Gets the events that were recorded, in the order they were emitted.
+func (log *EventLog) Recorded() []Event {
+	if log == nil {
+		return nil
+	}
+
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	return append([]Event{}, log.recorded...)
+}
+
+// Emits scenario_started. The environment is what the variables are compared
+// against when the first code block finishes.
+func (log *EventLog) ScenarioStarted(name string, steps int, environment map[string]string) {
+	if log == nil {
+		return
+	}
+
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	for key, value := range environment {
+		log.environment[key] = value
+	}
+	log.emit(Event{Type: EventScenarioStarted, Scenario: name, Steps: pointer(steps)})
+}
+
+// Emits block_started, preceded by step_started when the code block is the
+// first one of its step to start.
+func (log *EventLog) BlockStarted(step int, stepName string, codeBlock int, block parsers.CodeBlock) {
+	if log == nil {
+		return
+	}
+
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	if step != log.step {
+		log.emit(Event{Type: EventStepStarted, Step: pointer(step), StepName: stepName})
+	}
+
+	log.step = step
+	log.codeBlock = codeBlock
+	log.blockStartedAt = time.Now()
+	log.streamed = false
+	log.partial = make(map[string][]byte)
+
+	event := Event{
+		Type:      EventBlockStarted,
+		Step:      pointer(step),
+		StepName:  stepName,
+		CodeBlock: pointer(codeBlock),
+		Language:  block.Language,
+		Content:   block.Content,
+	}
+	if block.Position.StartLine != 0 {
+		event.Position = pointer(block.Position)
+	}
+	log.emit(event)
+}
+
+// Emits the output of the executing code block as block_output events of at
+// most MaxEventChunkLength bytes. The mutex must be held.
+func (log *EventLog) emitOutput(stream string, data []byte) {
+	for len(data) > 0 {
+		length := len(data)
+		if length > MaxEventChunkLength {
+			length = MaxEventChunkLength
+			for length > 0 && !utf8.RuneStart(data[length]) {
+				length--
+			}
+			if length == 0 {
+				length = MaxEventChunkLength
+			}
+		}
+
+		log.emit(Event{
+			Type:      EventBlockOutput,
+			Step:      pointer(log.step),
+			CodeBlock: pointer(log.codeBlock),
+			Stream:    stream,
+			Data:      string(data[:length]),
+		})
+		data = data[length:]
+	}
+}
+
+// Streams the output of the executing code block as it is written.
+type eventOutputWriter struct {
+	log    *EventLog
+	stream string
+}
+
+func (writer eventOutputWriter) Write(data []byte) (int, error) {
+	log := writer.log
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	log.streamed = true
+
+	// Hold back a character that was split between writes until the rest of
+	// it arrives.
+	pending := append(log.partial[writer.stream], data...)
+	complete := len(pending)
+	for start := len(pending) - 1; start >= 0 && start >= len(pending)-utf8.UTFMax; start-- {
+		if utf8.RuneStart(pending[start]) {
+			if !utf8.FullRune(pending[start:]) {
+				complete = start
+			}
+			break
+		}
+	}
+
+	log.emitOutput(writer.stream, pending[:complete])
+	log.partial[writer.stream] = append([]byte{}, pending[complete:]...)
+	return len(data), nil
+}
+
+// Gets a writer that streams the output of the executing code block to a
+// stream as block_output events. It is nil when the events aren't written
+// anywhere, since the output is only needed for streaming.
+func (log *EventLog) OutputWriter(stream string) io.Writer {
+	if log == nil || log.writer == nil {
+		return nil
+	}
+	return eventOutputWriter{log: log, stream: stream}
+}
+
+// Emits block_finished for the executing code block. Output that wasn't
+// streamed while the code block executed is emitted first.
+func (log *EventLog) BlockFinished(result BlockResult) {
+	if log == nil {
+		return
+	}
+
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	if log.streamed {
+		for _, stream := range []string{OutputStreamStdOut, OutputStreamStdErr} {
+			log.emitOutput(stream, log.partial[stream])
+		}
+	} else {
+		log.emitOutput(OutputStreamStdOut, []byte(result.StdOut))
+		log.emitOutput(OutputStreamStdErr, []byte(result.StdErr))
+	}
+	log.partial = make(map[string][]byte)
+
+	event := Event{
+		Type:                EventBlockFinished,
+		Step:                pointer(log.step),
+		CodeBlock:           pointer(log.codeBlock),
+		Success:             pointer(result.Success),
+		ExitCode:            pointer(result.ExitCode),
+		SimilarityScore:     pointer(result.SimilarityScore),
+		SimilarityAlgorithm: result.SimilarityAlgorithm,
+		DurationMs:          pointer(time.Since(log.blockStartedAt).Milliseconds()),
+	}
+	if result.Error != nil {
+		event.Error = result.Error.Error()
+	}
+	log.emit(event)
+}
+
+// Emits variable_changed for every variable that was set or changed since the
+// last time the variables were compared, in alphabetical order.
+func (log *EventLog) VariablesChanged(environment map[string]string) {
+	if log == nil {
+		return
+	}
+
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	var names []string
+	for name, value := range environment {
+		if shellManagedVariables[name] {
+			continue
+		}
+		if previous, ok := log.environment[name]; !ok || previous != value {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		log.environment[name] = environment[name]
+		log.emit(Event{
+			Type:      EventVariableChanged,
+			Step:      pointer(log.step),
+			CodeBlock: pointer(log.codeBlock),
+			Name:      name,
+			Value:     pointer(environment[name]),
+		})
+	}
+}
+
+// Emits scenario_finished with the error that stopped the scenario, if any.
+func (log *EventLog) ScenarioFinished(err error) {
+	if log == nil {
+		return
+	}
+
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	event := Event{Type: EventScenarioFinished, Success: pointer(err == nil)}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	log.emit(event)
+}
+
+// Records the start of a code block in the events and the trace of the
+// scenario.
+func CodeBlockStarted(step int, stepName string, codeBlock int, block parsers.CodeBlock) {
+	Events.BlockStarted(step, stepName, codeBlock, block)
+	Trace.StartBlock(step, stepName, codeBlock, block)
+}
+
+// Records the result of the executing code block in the events and the trace
+// of the scenario.
+func CodeBlockFinished(result BlockResult) {
+	Events.BlockFinished(result)
+	Trace.FinishBlock(result.ExitCode, result.SimilarityScore, result.Polls, result.Error)
+}
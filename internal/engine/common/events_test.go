@@ -0,0 +1,183 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+// Parses the events written to a buffer, one per line.
+func readEvents(t *testing.T, output *bytes.Buffer) []Event {
+	var events []Event
+	scanner := bufio.NewScanner(output)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	return events
+}
+
+func eventTypes(events []Event) []EventType {
+	var types []EventType
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestEventLog(t *testing.T) {
+	block := parsers.CodeBlock{
+		Language: "bash",
+		Content:  "echo hello",
+		Position: parsers.SourcePosition{File: "doc.md", StartLine: 3, EndLine: 5},
+	}
+
+	t.Run("The events of a scenario are written in order", func(t *testing.T) {
+		var output bytes.Buffer
+		log := NewEventLog(&output)
+
+		log.ScenarioStarted("Scenario", 2, map[string]string{"KEPT": "1"})
+		log.BlockStarted(0, "First", 0, block)
+		log.BlockFinished(BlockResult{StdOut: "hello\n", Success: true, SimilarityScore: 1})
+		log.BlockStarted(0, "First", 1, block)
+		log.BlockFinished(BlockResult{Success: true})
+		log.BlockStarted(1, "Second", 0, block)
+		log.BlockFinished(BlockResult{ExitCode: 2, Error: fmt.Errorf("exit status 2")})
+		log.ScenarioFinished(fmt.Errorf("exit status 2"))
+
+		events := readEvents(t, &output)
+		assert.Equal(t, []EventType{
+			EventScenarioStarted,
+			EventStepStarted,
+			EventBlockStarted,
+			EventBlockOutput,
+			EventBlockFinished,
+			EventBlockStarted,
+			EventBlockFinished,
+			EventStepStarted,
+			EventBlockStarted,
+			EventBlockFinished,
+			EventScenarioFinished,
+		}, eventTypes(events))
+
+		for _, event := range events {
+			assert.Equal(t, EventSchemaVersion, event.SchemaVersion)
+			assert.False(t, event.Time.IsZero())
+		}
+
+		assert.Equal(t, "Scenario", events[0].Scenario)
+		assert.Equal(t, 2, *events[0].Steps)
+		assert.Equal(t, &block.Position, events[2].Position)
+		assert.Equal(t, "hello\n", events[3].Data)
+		assert.Equal(t, OutputStreamStdOut, events[3].Stream)
+		assert.True(t, *events[4].Success)
+		assert.Equal(t, 0, *events[4].ExitCode)
+		assert.Equal(t, 1.0, *events[4].SimilarityScore)
+		assert.NotNil(t, events[4].DurationMs)
+		assert.Equal(t, 1, *events[8].Step)
+		assert.Equal(t, 2, *events[9].ExitCode)
+		assert.Equal(t, "exit status 2", events[9].Error)
+		assert.False(t, *events[10].Success)
+		assert.Equal(t, "exit status 2", events[10].Error)
+	})
+
+	t.Run("Output isn't recorded", func(t *testing.T) {
+		log := NewEventLog(nil)
+		log.BlockStarted(0, "First", 0, block)
+		log.BlockFinished(BlockResult{StdOut: "hello\n", Success: true})
+
+		assert.Equal(
+			t,
+			[]EventType{EventStepStarted, EventBlockStarted, EventBlockFinished},
+			eventTypes(log.Recorded()),
+		)
+		assert.Nil(t, log.OutputWriter(OutputStreamStdOut))
+	})
+
+	t.Run("Long output is split into chunks", func(t *testing.T) {
+		var output bytes.Buffer
+		log := NewEventLog(&output)
+		log.BlockStarted(0, "First", 0, block)
+		log.BlockFinished(BlockResult{StdOut: strings.Repeat("a", MaxEventChunkLength+10)})
+
+		events := readEvents(t, &output)
+		assert.Equal(t, MaxEventChunkLength, len(events[2].Data))
+		assert.Equal(t, 10, len(events[3].Data))
+	})
+
+	t.Run("Streamed output keeps characters split between writes", func(t *testing.T) {
+		var output bytes.Buffer
+		log := NewEventLog(&output)
+		log.BlockStarted(0, "First", 0, block)
+
+		writer := log.OutputWriter(OutputStreamStdErr)
+		character := []byte("é")
+		writer.Write(append([]byte("a"), character[0]))
+		writer.Write(append(character[1:], 'b'))
+		log.BlockFinished(BlockResult{StdErr: "aéb", Success: true})
+
+		events := readEvents(t, &output)
+		assert.Equal(t, []EventType{
+			EventStepStarted,
+			EventBlockStarted,
+			EventBlockOutput,
+			EventBlockOutput,
+			EventBlockFinished,
+		}, eventTypes(events))
+		assert.Equal(t, "a", events[2].Data)
+		assert.Equal(t, "éb", events[3].Data)
+		assert.Equal(t, OutputStreamStdErr, events[3].Stream)
+	})
+
+	t.Run("Only variables that changed are reported", func(t *testing.T) {
+		log := NewEventLog(nil)
+		log.ScenarioStarted("Scenario", 1, map[string]string{"KEPT": "1", "CHANGED": "1"})
+		log.BlockStarted(0, "First", 0, block)
+		log.BlockFinished(BlockResult{Success: true})
+		log.VariablesChanged(map[string]string{
+			"KEPT":    "1",
+			"CHANGED": "2",
+			"ADDED":   "",
+			"PWD":     "/tmp",
+			"_":       "/usr/bin/env",
+		})
+		log.VariablesChanged(map[string]string{"KEPT": "1", "CHANGED": "2", "ADDED": ""})
+
+		var changed []string
+		for _, event := range log.Recorded() {
+			if event.Type == EventVariableChanged {
+				changed = append(changed, event.Name+"="+*event.Value)
+			}
+		}
+		assert.Equal(t, []string{"ADDED=", "CHANGED=2"}, changed)
+	})
+
+	t.Run("A nil event log does nothing", func(t *testing.T) {
+		var log *EventLog
+		log.ScenarioStarted("Scenario", 1, nil)
+		log.BlockStarted(0, "First", 0, block)
+		log.BlockFinished(BlockResult{})
+		log.VariablesChanged(nil)
+		log.ScenarioFinished(nil)
+
+		assert.Nil(t, log.Recorded())
+		assert.Nil(t, log.OutputWriter(OutputStreamStdOut))
+	})
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, 0, ExitCode(nil))
+	assert.Equal(t, -1, ExitCode(fmt.Errorf("not a process")))
+
+	err := exec.Command("bash", "-c", "exit 3").Run()
+	assert.Equal(t, 3, ExitCode(fmt.Errorf("wrapped: %w", err)))
+}
@@ -0,0 +1,135 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+)
+
+// The state of a file written by a code block with the file attribute,
+// recorded when the scenario is torn down.
+type MaterializedFile struct {
+	Path string `json:"path"`
+	// Files that existed before the scenario are overwritten but never
+	// removed.
+	Removed bool   `json:"removed"`
+	Error   string `json:"error"`
+}
+
+type trackedFile struct {
+	path    string
+	existed bool
+}
+
+// The files written by the scenario, which are removed when the scenario is
+// torn down.
+var (
+	materializedFiles      []trackedFile
+	materializedFilesMutex sync.Mutex
+)
+
+// Expands the environment variables within a value, falling back to the
+// environment of the current process.
+func expandEnvironmentVariables(value string, env map[string]string) string {
+	return os.Expand(value, func(name string) string {
+		if value, ok := env[name]; ok {
+			return value
+		}
+		return os.Getenv(name)
+	})
+}
+
+// Resolves a path declared by a scenario, expanding its environment variables
+// and making it relative to the current working directory of the scenario.
+func resolveScenarioPath(path string, env map[string]string) string {
+	path = expandEnvironmentVariables(path, env)
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	workingDirectory, err := lib.LoadWorkingDirectoryStateFile(
+		lib.DefaultWorkingDirectoryStateFile,
+	)
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(workingDirectory, path)
+}
+
+// Writes the content of a code block to the file declared by its file
+// attribute. The file is tracked so that it can be removed when the scenario
+// is torn down.
+func MaterializeCodeBlock(codeBlock parsers.CodeBlock, env map[string]string) (shells.CommandOutput, error) {
+	if codeBlock.File == nil {
+		return shells.CommandOutput{}, fmt.Errorf("the code block is not written to a file")
+	}
+
+	currentEnvironment := lib.GetCurrentEnvironment(env)
+	path := resolveScenarioPath(codeBlock.File.Path, currentEnvironment)
+
+	content := codeBlock.Content
+	if codeBlock.File.ExpandVariables {
+		content = expandEnvironmentVariables(content, currentEnvironment)
+	}
+
+	_, statErr := os.Stat(path)
+	existed := statErr == nil
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return shells.CommandOutput{}, fmt.Errorf("failed to create the directory of %s: %w", path, err)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return shells.CommandOutput{}, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	logging.GlobalLogger.Infof("Wrote the code block to %s", path)
+
+	materializedFilesMutex.Lock()
+	defer materializedFilesMutex.Unlock()
+
+	tracked := false
+	for _, file := range materializedFiles {
+		tracked = tracked || file.path == path
+	}
+	if !tracked {
+		materializedFiles = append(materializedFiles, trackedFile{path: path, existed: existed})
+	}
+
+	return shells.CommandOutput{}, nil
+}
+
+// Removes the files written by the scenario unless they should be preserved,
+// and returns their final state. Files that existed before the scenario are
+// left in place.
+func RemoveMaterializedFiles(preserve bool) []MaterializedFile {
+	materializedFilesMutex.Lock()
+	files := materializedFiles
+	materializedFiles = nil
+	materializedFilesMutex.Unlock()
+
+	var results []MaterializedFile
+	for _, file := range files {
+		result := MaterializedFile{Path: file.path}
+
+		if !preserve && !file.existed {
+			if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+				logging.GlobalLogger.Errorf("Error removing %s: %s", file.path, err)
+				result.Error = err.Error()
+			} else {
+				result.Removed = true
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
@@ -0,0 +1,77 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaterializeCodeBlock(t *testing.T) {
+	directory := t.TempDir()
+	err := os.WriteFile(lib.DefaultWorkingDirectoryStateFile, []byte(directory+"\n"), 0644)
+	assert.NoError(t, err)
+	defer lib.DeleteWorkingDirectoryStateFile(lib.DefaultWorkingDirectoryStateFile)
+
+	fileCodeBlock := func(content string, path string, expand bool) parsers.CodeBlock {
+		return parsers.CodeBlock{
+			Language: "yaml",
+			Content:  content,
+			File:     &parsers.FileTarget{Path: path, ExpandVariables: expand},
+		}
+	}
+
+	env := map[string]string{"APP_NAME": "web"}
+
+	t.Run("Writes the content relative to the working directory", func(t *testing.T) {
+		_, err := ExecuteCodeBlock(fileCodeBlock("name: $APP_NAME\n", "manifests/deployment.yaml", false), env)
+		assert.NoError(t, err)
+
+		content, err := os.ReadFile(filepath.Join(directory, "manifests", "deployment.yaml"))
+		assert.NoError(t, err)
+		assert.Equal(t, "name: $APP_NAME\n", string(content))
+	})
+
+	t.Run("Expands variables when requested", func(t *testing.T) {
+		_, err := ExecuteCodeBlock(fileCodeBlock("name: $APP_NAME\n", "$APP_NAME.yaml", true), env)
+		assert.NoError(t, err)
+
+		content, err := os.ReadFile(filepath.Join(directory, "web.yaml"))
+		assert.NoError(t, err)
+		assert.Equal(t, "name: web\n", string(content))
+	})
+
+	t.Run("Removes the files it created", func(t *testing.T) {
+		existing := filepath.Join(directory, "existing.yaml")
+		assert.NoError(t, os.WriteFile(existing, []byte("old"), 0644))
+
+		_, err := ExecuteCodeBlock(fileCodeBlock("new", "existing.yaml", false), env)
+		assert.NoError(t, err)
+
+		files := RemoveMaterializedFiles(false)
+		assert.Len(t, files, 3)
+		for _, file := range files {
+			_, statErr := os.Stat(file.Path)
+			if file.Path == existing {
+				assert.False(t, file.Removed)
+				assert.NoError(t, statErr)
+			} else {
+				assert.True(t, file.Removed)
+				assert.True(t, os.IsNotExist(statErr))
+			}
+		}
+	})
+
+	t.Run("Keeps the files when they are preserved", func(t *testing.T) {
+		_, err := ExecuteCodeBlock(fileCodeBlock("kept", "kept.yaml", false), env)
+		assert.NoError(t, err)
+
+		files := RemoveMaterializedFiles(true)
+		assert.Len(t, files, 1)
+		assert.False(t, files[0].Removed)
+		assert.FileExists(t, filepath.Join(directory, "kept.yaml"))
+	})
+}
@@ -0,0 +1,287 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+)
+
+// The environment variable that holds the path of the job summary of a GitHub
+// Actions step.
+const GithubStepSummaryVariable = "GITHUB_STEP_SUMMARY"
+
+// The repository that a scenario is tested in on GitHub Actions, used to point
+// annotations and the job summary at the lines of the markdown files.
+type GithubWorkspace struct {
+	// The directory the repository is checked out to.
+	Directory string
+	// The URL of the repository, I.E. https://github.com/Azure/InnovationEngine.
+	RepositoryURL string
+	Commit        string
+	// The directory that relative paths to scenarios are resolved against.
+	WorkingDirectory string
+}
+
+// Reads the workspace from the default environment variables of a GitHub
+// Actions workflow run.
+func GithubWorkspaceFromEnvironment(workingDirectory string) GithubWorkspace {
+	workspace := GithubWorkspace{
+		Directory:        os.Getenv("GITHUB_WORKSPACE"),
+		Commit:           os.Getenv("GITHUB_SHA"),
+		WorkingDirectory: workingDirectory,
+	}
+
+	server, repository := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY")
+	if server != "" && repository != "" {
+		workspace.RepositoryURL = strings.TrimSuffix(server, "/") + "/" + repository
+	}
+
+	return workspace
+}
+
+// Gets the path of a scenario file relative to the root of the repository,
+// which is how GitHub identifies files in annotations. Files downloaded from a
+// URL aren't part of the repository.
+func (workspace GithubWorkspace) relativePath(file string) (string, bool) {
+	if file == "" || strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://") {
+		return "", false
+	}
+
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(workspace.WorkingDirectory, file)
+	}
+
+	if workspace.Directory == "" {
+		return filepath.ToSlash(filepath.Clean(file)), true
+	}
+
+	relative, err := filepath.Rel(workspace.Directory, file)
+	if err != nil || strings.HasPrefix(relative, "..") {
+		return "", false
+	}
+
+	return filepath.ToSlash(relative), true
+}
+
+// Renders a position as markdown, linking to the line within the repository
+// when the commit being tested is known.
+func (workspace GithubWorkspace) markdownLink(position parsers.SourcePosition) string {
+	path, ok := workspace.relativePath(position.File)
+	if !ok || position.StartLine == 0 {
+		return position.String()
+	}
+
+	text := fmt.Sprintf("%s:%d", path, position.StartLine)
+	if workspace.RepositoryURL == "" || workspace.Commit == "" {
+		return text
+	}
+
+	return fmt.Sprintf(
+		"[%s](%s/blob/%s/%s#L%d-L%d)",
+		text,
+		workspace.RepositoryURL,
+		workspace.Commit,
+		path,
+		position.StartLine,
+		position.EndLine,
+	)
+}
+
+// The code blocks of a step along with how they went.
+type githubStep struct {
+	number     int
+	name       string
+	codeBlocks []StatefulCodeBlock
+}
+
+func (step githubStep) failed() *StatefulCodeBlock {
+	for index, codeBlock := range step.codeBlocks {
+		if codeBlock.Error != nil {
+			return &step.codeBlocks[index]
+		}
+	}
+	return nil
+}
+
+func (step githubStep) succeeded() int {
+	succeeded := 0
+	for _, codeBlock := range step.codeBlocks {
+		if codeBlock.Success {
+			succeeded++
+		}
+	}
+	return succeeded
+}
+
+// Groups the code blocks by the step they belong to, in the order they were
+// executed.
+func groupGithubSteps(codeBlocks []StatefulCodeBlock) []githubStep {
+	sorted := append([]StatefulCodeBlock{}, codeBlocks...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].StepNumber != sorted[j].StepNumber {
+			return sorted[i].StepNumber < sorted[j].StepNumber
+		}
+		return sorted[i].CodeBlockNumber < sorted[j].CodeBlockNumber
+	})
+
+	var steps []githubStep
+	for _, codeBlock := range sorted {
+		if len(steps) == 0 || steps[len(steps)-1].number != codeBlock.StepNumber+1 {
+			steps = append(steps, githubStep{number: codeBlock.StepNumber + 1, name: codeBlock.StepName})
+		}
+		steps[len(steps)-1].codeBlocks = append(steps[len(steps)-1].codeBlocks, codeBlock)
+	}
+
+	return steps
+}
+
+// Escapes the message of a workflow command.
+func escapeGithubData(data string) string {
+	data = strings.ReplaceAll(data, "%", "%25")
+	data = strings.ReplaceAll(data, "\r", "%0D")
+	return strings.ReplaceAll(data, "\n", "%0A")
+}
+
+// Escapes the value of a property of a workflow command.
+func escapeGithubProperty(value string) string {
+	value = escapeGithubData(value)
+	value = strings.ReplaceAll(value, ":", "%3A")
+	return strings.ReplaceAll(value, ",", "%2C")
+}
+
+// Writes the results of a test run as GitHub Actions workflow commands. Each
+// step is a collapsible group with the code blocks that were executed and
+// their output, and the code block that failed is annotated with an error on
+// its lines of the markdown file.
+func WriteGithubActionsLog(
+	writer io.Writer,
+	codeBlocks []StatefulCodeBlock,
+	workspace GithubWorkspace,
+) {
+	for _, step := range groupGithubSteps(codeBlocks) {
+		fmt.Fprintf(writer, "::group::%s\n", escapeGithubData(fmt.Sprintf("%d. %s", step.number, step.name)))
+		for _, codeBlock := range step.codeBlocks {
+			if !codeBlock.WasExecuted() {
+				continue
+			}
+
+			fmt.Fprint(writer, ensureTrailingNewline(codeBlock.CodeBlock.Content))
+			if codeBlock.StdOut != "" {
+				fmt.Fprint(writer, ensureTrailingNewline(lib.StripAnsiCodes(codeBlock.StdOut)))
+			}
+			if codeBlock.StdErr != "" {
+				fmt.Fprint(writer, ensureTrailingNewline(lib.StripAnsiCodes(codeBlock.StdErr)))
+			}
+		}
+		fmt.Fprintln(writer, "::endgroup::")
+
+		failed := step.failed()
+		if failed == nil {
+			continue
+		}
+
+		properties := []string{
+			"title=" + escapeGithubProperty(fmt.Sprintf("Step %d failed: %s", step.number, step.name)),
+		}
+		position := failed.CodeBlock.Position
+		if path, ok := workspace.relativePath(position.File); ok && position.StartLine != 0 {
+			properties = append(
+				properties,
+				"file="+escapeGithubProperty(path),
+				fmt.Sprintf("line=%d", position.StartLine),
+				fmt.Sprintf("endLine=%d", position.EndLine),
+			)
+		}
+
+		fmt.Fprintf(
+			writer,
+			"::error %s::%s\n",
+			strings.Join(properties, ","),
+			escapeGithubData(lib.StripAnsiCodes(failed.Error.Error())),
+		)
+	}
+}
+
+func ensureTrailingNewline(text string) string {
+	if text == "" || strings.HasSuffix(text, "\n") {
+		return text
+	}
+	return text + "\n"
+}
+
+// Appends a markdown summary of a test run to the job summary of a GitHub
+// Actions step, with a table of the results of each step and a link to the
+// lines of the code block that failed.
+func WriteGithubStepSummary(
+	path string,
+	scenarioName string,
+	codeBlocks []StatefulCodeBlock,
+	workspace GithubWorkspace,
+) error {
+	steps := groupGithubSteps(codeBlocks)
+
+	var failure *StatefulCodeBlock
+	for _, step := range steps {
+		if failed := step.failed(); failed != nil && failure == nil {
+			failure = failed
+		}
+	}
+
+	var summary strings.Builder
+	icon := "✅"
+	if failure != nil {
+		icon = "❌"
+	}
+	fmt.Fprintf(&summary, "### %s %s\n\n", icon, scenarioName)
+	summary.WriteString("| Step | Result | Code blocks | Location |\n")
+	summary.WriteString("| ---- | ------ | ----------- | -------- |\n")
+
+	for _, step := range steps {
+		result := "✅ Passed"
+		location := ""
+		switch failed := step.failed(); {
+		case failed != nil:
+			result = "❌ Failed"
+			location = workspace.markdownLink(failed.CodeBlock.Position)
+		case step.succeeded() < len(step.codeBlocks):
+			result = "⏭️ Not run"
+		}
+
+		fmt.Fprintf(
+			&summary,
+			"| %d. %s | %s | %d/%d | %s |\n",
+			step.number,
+			strings.ReplaceAll(step.name, "|", "\\|"),
+			result,
+			step.succeeded(),
+			len(step.codeBlocks),
+			location,
+		)
+	}
+
+	if failure != nil {
+		fmt.Fprintf(
+			&summary,
+			"\n<details><summary>Error</summary>\n\n```text\n%s\n```\n\n</details>\n",
+			strings.TrimSpace(lib.StripAnsiCodes(failure.Error.Error())),
+		)
+	}
+	summary.WriteString("\n")
+
+	// The job summary is shared by every command of the step, so it is
+	// appended to rather than overwritten.
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(summary.String())
+	return err
+}
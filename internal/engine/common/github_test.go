@@ -0,0 +1,115 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+func githubTestCodeBlocks(workspace string) []StatefulCodeBlock {
+	file := filepath.Join(workspace, "docs", "deploy.md")
+	return []StatefulCodeBlock{
+		{
+			CodeBlock: parsers.CodeBlock{
+				Content:  "echo created\n",
+				Position: parsers.SourcePosition{File: file, StartLine: 5, EndLine: 7},
+			},
+			StepName:   "Create, the group",
+			StepNumber: 0,
+			StdOut:     "created\n",
+			Success:    true,
+		},
+		{
+			CodeBlock: parsers.CodeBlock{
+				Content:  "az deployment create\n",
+				Position: parsers.SourcePosition{File: file, StartLine: 12, EndLine: 14},
+			},
+			StepName:   "Deploy",
+			StepNumber: 1,
+			StdErr:     "\x1b[31mdeployment failed\x1b[0m",
+			Error:      errors.New("docs/deploy.md:12: exit status 1\n100% failed"),
+		},
+		{
+			CodeBlock: parsers.CodeBlock{
+				Content:  "echo cleanup\n",
+				Position: parsers.SourcePosition{File: file, StartLine: 20, EndLine: 22},
+			},
+			StepName:   "Clean up",
+			StepNumber: 2,
+		},
+	}
+}
+
+func TestWriteGithubActionsLog(t *testing.T) {
+	workspace := t.TempDir()
+
+	var output bytes.Buffer
+	WriteGithubActionsLog(
+		&output,
+		githubTestCodeBlocks(workspace),
+		GithubWorkspace{Directory: workspace, WorkingDirectory: workspace},
+	)
+
+	assert.Equal(
+		t,
+		"::group::1. Create, the group\necho created\ncreated\n::endgroup::\n"+
+			"::group::2. Deploy\naz deployment create\ndeployment failed\n::endgroup::\n"+
+			"::error title=Step 2 failed%3A Deploy,file=docs/deploy.md,line=12,endLine=14::"+
+			"docs/deploy.md:12: exit status 1%0A100%25 failed\n"+
+			"::group::3. Clean up\n::endgroup::\n",
+		output.String(),
+	)
+}
+
+func TestWriteGithubStepSummary(t *testing.T) {
+	workspace := t.TempDir()
+	summaryPath := filepath.Join(t.TempDir(), "summary.md")
+	assert.NoError(t, os.WriteFile(summaryPath, []byte("Earlier output\n"), 0644))
+
+	err := WriteGithubStepSummary(
+		summaryPath,
+		"Deploy an app",
+		githubTestCodeBlocks(workspace),
+		GithubWorkspace{
+			Directory:        workspace,
+			RepositoryURL:    "https://github.com/Azure/InnovationEngine",
+			Commit:           "abc123",
+			WorkingDirectory: filepath.Join(workspace, "docs"),
+		},
+	)
+	assert.NoError(t, err)
+
+	summary, err := os.ReadFile(summaryPath)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		"Earlier output\n"+
+			"### ❌ Deploy an app\n\n"+
+			"| Step | Result | Code blocks | Location |\n"+
+			"| ---- | ------ | ----------- | -------- |\n"+
+			"| 1. Create, the group | ✅ Passed | 1/1 |  |\n"+
+			"| 2. Deploy | ❌ Failed | 0/1 | [docs/deploy.md:12](https://github.com/Azure/InnovationEngine/blob/abc123/docs/deploy.md#L12-L14) |\n"+
+			"| 3. Clean up | ⏭️ Not run | 0/1 |  |\n"+
+			"\n<details><summary>Error</summary>\n\n```text\ndocs/deploy.md:12: exit status 1\n100% failed\n```\n\n</details>\n\n",
+		string(summary),
+	)
+}
+
+func TestGithubWorkspaceRelativePath(t *testing.T) {
+	workspace := GithubWorkspace{Directory: "/repo", WorkingDirectory: "/repo/docs"}
+
+	path, ok := workspace.relativePath("tutorial.md")
+	assert.True(t, ok)
+	assert.Equal(t, "docs/tutorial.md", path)
+
+	_, ok = workspace.relativePath("/elsewhere/tutorial.md")
+	assert.False(t, ok)
+
+	_, ok = workspace.relativePath("https://example.com/tutorial.md")
+	assert.False(t, ok)
+}
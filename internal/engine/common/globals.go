@@ -1,9 +1,21 @@
 package common
 
-import tea "github.com/charmbracelet/bubbletea"
+import (
+	"github.com/Azure/InnovationEngine/internal/tracing"
+	tea "github.com/charmbracelet/bubbletea"
+)
 
 // TODO: Ideally we won't need a global program variable. We should
 // refactor this in the future such that each tea program is localized to the
 // function that creates it and ExecuteCodeBlockSync doesn't mutate the global
 // program variable.
 var Program *tea.Program = nil
+
+// The events of the scenario that is running, if any. Like the program, it is
+// global so that code blocks executed from anywhere stream their output to it.
+var Events *EventLog = nil
+
+// The trace of the scenario that is running, if any. It is global for the same
+// reason as the events, so that the commands of code blocks executed from
+// anywhere join it.
+var Trace *tracing.ScenarioTrace = nil
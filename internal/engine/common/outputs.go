@@ -2,81 +2,169 @@ package common
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
 
 	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
 	"github.com/Azure/InnovationEngine/internal/ui"
-	"github.com/xrash/smetrics"
 )
 
+// Name reported as the algorithm for expected outputs that are validated with
+// a regex instead of a similarity score.
+const regexComparison = "regex"
+
+// The result of comparing the actual output of a command to its expected
+// output.
+type OutputComparison struct {
+	Score     float64 `json:"score"`
+	Algorithm string  `json:"algorithm"`
+}
+
+// Determines the similarity algorithm used to compare the output of a command
+// to an expected output block. The algorithm set on the block is used when
+// present, otherwise JSON and YAML outputs are compared structurally and
+// everything else uses Jaro-Winkler.
+func ResolveSimilarityAlgorithm(
+	expected parsers.ExpectedOutputBlock,
+) (lib.SimilarityAlgorithm, error) {
+	if expected.SimilarityAlgorithm != "" {
+		return lib.ParseSimilarityAlgorithm(expected.SimilarityAlgorithm)
+	}
+
+	switch strings.ToLower(expected.Language) {
+	case "json", "yaml", "yml":
+		return lib.SimilarityStructural, nil
+	default:
+		return lib.SimilarityJaroWinkler, nil
+	}
+}
+
+// Checks whether a code block has an expected output to compare its output
+// against.
+func HasExpectedOutput(expected parsers.ExpectedOutputBlock) bool {
+	return expected.Content != "" || expected.ExpectedRegex != nil
+}
+
+// Describes where an expected output is declared, I.E. ` (docs/deploy.md:14)`,
+// or returns an empty string when its position is unknown.
+func expectedOutputLocation(expected parsers.ExpectedOutputBlock) string {
+	if expected.Position.StartLine == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", expected.Position)
+}
+
 // Compares the actual output of a command to the expected output of a command.
+// Both outputs are normalized before they are compared, and placeholders in the
+// expected output (I.E. `<GUID>` or `<VAR:NAME>`) are resolved using the
+// environment variables provided.
 func CompareCommandOutputs(
 	actualOutput string,
-	expectedOutput string,
-	expectedSimilarity float64,
-	expectedRegex *regexp.Regexp,
-	expectedOutputLanguage string,
-) (float64, error) {
-	if expectedRegex != nil {
-		if !expectedRegex.MatchString(actualOutput) {
-			return 0.0, fmt.Errorf(
+	expected parsers.ExpectedOutputBlock,
+	environmentVariables map[string]string,
+) (OutputComparison, error) {
+	actualOutput = lib.NormalizeOutput(actualOutput, lib.DefaultOutputNormalizers...)
+	expectedOutput := lib.NormalizeOutput(expected.Content, lib.DefaultOutputNormalizers...)
+	expectedSimilarity := expected.ExpectedSimilarity
+	placeholders := lib.NewPlaceholders(environmentVariables)
+
+	if expected.ExpectedRegex != nil {
+		comparison := OutputComparison{Score: 0.0, Algorithm: regexComparison}
+		if !expected.ExpectedRegex.MatchString(actualOutput) {
+			return comparison, fmt.Errorf(
 				ui.ErrorMessageStyle.Render(
-					fmt.Sprintf("Expected output does not match: %q.", expectedRegex),
+					fmt.Sprintf("Expected output%s does not match: %q.", expectedOutputLocation(expected), expected.ExpectedRegex),
 				),
 			)
 		}
 
-		return 0.0, nil
+		return comparison, nil
 	}
 
-	if strings.ToLower(expectedOutputLanguage) == "json" {
+	algorithm, err := ResolveSimilarityAlgorithm(expected)
+	if err != nil {
+		return OutputComparison{}, err
+	}
+
+	comparison := OutputComparison{Algorithm: string(algorithm)}
+	var differences string
+
+	if algorithm == lib.SimilarityStructural {
+		compareStructuredStrings := lib.CompareJsonStrings
+		switch strings.ToLower(expected.Language) {
+		case "yaml", "yml":
+			compareStructuredStrings = lib.CompareYamlStrings
+		}
+
 		logging.GlobalLogger.Debugf(
-			"Comparing JSON strings:\nExpected: %s\nActual%s",
+			"Comparing %s strings:\nExpected: %s\nActual%s",
+			expected.Language,
 			expectedOutput,
 			actualOutput,
 		)
-		results, err := lib.CompareJsonStrings(actualOutput, expectedOutput, expectedSimilarity)
-		if err != nil {
-			return results.Score, err
-		}
-
-		logging.GlobalLogger.Debugf(
-			"Expected Similarity: %f, Actual Similarity: %f",
+		results, err := compareStructuredStrings(
+			actualOutput,
+			expectedOutput,
 			expectedSimilarity,
-			results.Score,
+			lib.StructuralComparisonOptions{
+				IgnorePaths:     expected.IgnorePaths,
+				UnorderedArrays: expected.UnorderedArrays,
+				Placeholders:    &placeholders,
+			},
 		)
+		comparison.Score = results.Score
+		if err != nil {
+			return comparison, err
+		}
 
-		if !results.AboveThreshold {
-			return results.Score, fmt.Errorf(
-				ui.ErrorMessageStyle.Render(
-					"Expected output does not match actual output.\nGot:\n%s\nExpected:\n%s\nExpected Score:%s\nActual Score:%s",
-				),
-				ui.VerboseStyle.Render(actualOutput),
-				ui.VerboseStyle.Render(expectedOutput),
-				ui.VerboseStyle.Render(fmt.Sprintf("%f", expectedSimilarity)),
-				ui.VerboseStyle.Render(fmt.Sprintf("%f", results.Score)),
-			)
+		differences = lib.FormatStructuralDifferences(results.Differences)
+	} else {
+		// Placeholders are replaced with the text they matched so they don't
+		// count against the score.
+		expectedOutput = placeholders.Substitute(expectedOutput, actualOutput)
+		comparison.Score, err = lib.ComputeSimilarity(algorithm, expectedOutput, actualOutput)
+		if err != nil {
+			return comparison, err
 		}
 
-		return results.Score, nil
+		// An exact comparison only passes on a perfect match, regardless of the
+		// expected similarity.
+		if algorithm == lib.SimilarityExact {
+			expectedSimilarity = 1.0
+		}
 	}
 
-	// Default case, using similarity on non JSON block.
-	score := smetrics.JaroWinkler(expectedOutput, actualOutput, 0.7, 4)
+	logging.GlobalLogger.Debugf(
+		"Expected Similarity: %f, Actual Similarity: %f, Algorithm: %s",
+		expectedSimilarity,
+		comparison.Score,
+		comparison.Algorithm,
+	)
 
-	if expectedSimilarity > score {
-		return score, fmt.Errorf(
-			ui.ErrorMessageStyle.Render(
-				"Expected output does not match actual output.\nGot:\n%s\nExpected:\n%s\nExpected Score:%s\nActual Score:%s",
-			),
+	if expectedSimilarity > comparison.Score {
+		message := "Expected output%s does not match actual output.\nGot:\n%s\nExpected:\n%s\n"
+		arguments := []interface{}{
+			expectedOutputLocation(expected),
 			ui.VerboseStyle.Render(actualOutput),
 			ui.VerboseStyle.Render(expectedOutput),
+		}
+
+		if differences != "" {
+			message += "Differences:\n%s\n"
+			arguments = append(arguments, ui.VerboseStyle.Render(differences))
+		}
+
+		message += "Algorithm:%s\nExpected Score:%s\nActual Score:%s"
+		arguments = append(
+			arguments,
+			ui.VerboseStyle.Render(comparison.Algorithm),
 			ui.VerboseStyle.Render(fmt.Sprintf("%f", expectedSimilarity)),
-			ui.VerboseStyle.Render(fmt.Sprintf("%f", score)),
+			ui.VerboseStyle.Render(fmt.Sprintf("%f", comparison.Score)),
 		)
+
+		return comparison, fmt.Errorf(ui.ErrorMessageStyle.Render(message), arguments...)
 	}
 
-	return score, nil
+	return comparison, nil
 }
@@ -0,0 +1,110 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareCommandOutputs(t *testing.T) {
+	t.Run("Placeholders and normalization in text outputs", func(t *testing.T) {
+		comparison, err := CompareCommandOutputs(
+			"\x1b[1mName\x1b[0m    Location\r\nrg-42   eastus  \r\n",
+			parsers.ExpectedOutputBlock{
+				Language:           "text",
+				Content:            "Name    Location\n<VAR:MY_RESOURCE_GROUP>   <ANY>\n",
+				ExpectedSimilarity: 1.0,
+			},
+			map[string]string{"MY_RESOURCE_GROUP": "rg-42"},
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1.0, comparison.Score)
+	})
+
+	t.Run("Placeholders in JSON outputs", func(t *testing.T) {
+		comparison, err := CompareCommandOutputs(
+			`{"id": "0a2c89a7-a44e-4cd0-b6ec-868432ad1d13", "count": 3}`,
+			parsers.ExpectedOutputBlock{
+				Language:           "json",
+				Content:            `{"id": "<GUID>", "count": "<ANY>"}`,
+				ExpectedSimilarity: 1.0,
+			},
+			nil,
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1.0, comparison.Score)
+	})
+
+	t.Run("Mismatched JSON outputs report the differing paths", func(t *testing.T) {
+		_, err := CompareCommandOutputs(
+			`[{"name": "rg", "properties": {"provisioningState": "Failed"}}]`,
+			parsers.ExpectedOutputBlock{
+				Language:           "json",
+				Content:            `[{"name": "rg", "properties": {"provisioningState": "Succeeded"}}]`,
+				ExpectedSimilarity: 1.0,
+			},
+			nil,
+		)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "$[0].properties.provisioningState")
+	})
+
+	t.Run("The selected similarity algorithm is used and reported", func(t *testing.T) {
+		comparison, err := CompareCommandOutputs(
+			"Name    Location\nrg-1    eastus\nrg-2    westus",
+			parsers.ExpectedOutputBlock{
+				Language:            "text",
+				Content:             "Name    Location\nrg-1    eastus",
+				ExpectedSimilarity:  1.0,
+				SimilarityAlgorithm: "contains_lines",
+			},
+			nil,
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "contains_lines", comparison.Algorithm)
+		assert.Equal(t, 1.0, comparison.Score)
+	})
+
+	t.Run("Exact comparisons ignore the expected similarity", func(t *testing.T) {
+		comparison, err := CompareCommandOutputs(
+			"Hello world",
+			parsers.ExpectedOutputBlock{
+				Language:            "text",
+				Content:             "Hello World",
+				ExpectedSimilarity:  0.5,
+				SimilarityAlgorithm: "exact",
+			},
+			nil,
+		)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "exact")
+		assert.Equal(t, 0.0, comparison.Score)
+	})
+
+	t.Run("Unknown similarity algorithms return an error", func(t *testing.T) {
+		_, err := CompareCommandOutputs(
+			"Hello",
+			parsers.ExpectedOutputBlock{Content: "Hello", SimilarityAlgorithm: "cosine"},
+			nil,
+		)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("JSON outputs default to the structural algorithm", func(t *testing.T) {
+		comparison, err := CompareCommandOutputs(
+			`{"a": 1}`,
+			parsers.ExpectedOutputBlock{Language: "json", Content: `{"a": 1}`, ExpectedSimilarity: 1.0},
+			nil,
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "structural", comparison.Algorithm)
+	})
+}
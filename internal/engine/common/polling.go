@@ -0,0 +1,116 @@
+package common
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+)
+
+// The number of times a code block was executed before its wait-until
+// condition was met, and how long it took.
+type WaitResult struct {
+	Polls            int     `json:"polls"`
+	TotalWaitSeconds float64 `json:"totalWaitSeconds"`
+}
+
+// Gets the number of times a code block was polled, which is zero when it
+// didn't wait for a condition.
+func (result *WaitResult) GetPolls() int {
+	if result == nil {
+		return 0
+	}
+	return result.Polls
+}
+
+// Emitted after every unsuccessful poll of a code block with a wait-until
+// condition.
+type WaitProgressMessage struct {
+	Poll      int
+	Elapsed   time.Duration
+	Timeout   time.Duration
+	LastError error
+}
+
+// Renders the progress of a wait-until code block for the user.
+func (progress WaitProgressMessage) String() string {
+	return fmt.Sprintf(
+		"Waiting for the expected output (poll %d, %s of %s elapsed)",
+		progress.Poll,
+		progress.Elapsed.Round(time.Second),
+		progress.Timeout,
+	)
+}
+
+// Executes a code block until it succeeds and its output passes validation, or
+// until the timeout of its wait-until condition is reached. onProgress is
+// called after every unsuccessful poll and may be nil. When the timeout is
+// reached, the output of the last poll is returned along with its error.
+func PollCodeBlock(
+	codeBlock parsers.CodeBlock,
+	execute func() (shells.CommandOutput, error),
+	env map[string]string,
+	onProgress func(WaitProgressMessage),
+) (shells.CommandOutput, WaitResult, error) {
+	condition := parsers.WaitCondition{
+		Interval: parsers.DefaultWaitInterval,
+		Timeout:  parsers.DefaultWaitTimeout,
+	}
+	if codeBlock.WaitUntil != nil {
+		condition = *codeBlock.WaitUntil
+	}
+
+	start := time.Now()
+	result := WaitResult{}
+
+	for {
+		output, err := execute()
+		result.Polls++
+
+		if err == nil {
+			_, err = ValidateCommandOutput(codeBlock, output, lib.GetCurrentEnvironment(env))
+		}
+
+		elapsed := time.Since(start)
+		result.TotalWaitSeconds = elapsed.Seconds()
+
+		if err == nil {
+			logging.GlobalLogger.Infof(
+				"Wait-until condition met after %d polls in %s",
+				result.Polls,
+				elapsed,
+			)
+			return output, result, nil
+		}
+
+		if elapsed+condition.Interval > condition.Timeout {
+			logging.GlobalLogger.Errorf(
+				"Wait-until condition not met after %d polls in %s",
+				result.Polls,
+				elapsed,
+			)
+			return output, result, fmt.Errorf(
+				"timed out after %d polls in %s: %w",
+				result.Polls,
+				elapsed.Round(time.Second),
+				err,
+			)
+		}
+
+		logging.GlobalLogger.Debugf("Poll %d failed, retrying in %s: %s", result.Polls, condition.Interval, err)
+		Trace.BlockRetried(result.Polls, err)
+		if onProgress != nil {
+			onProgress(WaitProgressMessage{
+				Poll:      result.Polls,
+				Elapsed:   elapsed,
+				Timeout:   condition.Timeout,
+				LastError: err,
+			})
+		}
+
+		time.Sleep(condition.Interval)
+	}
+}
@@ -0,0 +1,87 @@
+package common
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPollCodeBlock(t *testing.T) {
+	codeBlock := parsers.CodeBlock{
+		Content:    "curl -s http://localhost",
+		Assertions: mustParseAssertions(t, `stdout contains ready`),
+		WaitUntil: &parsers.WaitCondition{
+			Interval: time.Millisecond,
+			Timeout:  time.Second,
+		},
+	}
+
+	t.Run("Polls until the output is valid", func(t *testing.T) {
+		outputs := []string{"starting", "starting", "ready"}
+		executions := 0
+		var progress []WaitProgressMessage
+
+		output, result, err := PollCodeBlock(
+			codeBlock,
+			func() (shells.CommandOutput, error) {
+				executions++
+				return shells.CommandOutput{StdOut: outputs[executions-1]}, nil
+			},
+			nil,
+			func(message WaitProgressMessage) {
+				progress = append(progress, message)
+			},
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "ready", output.StdOut)
+		assert.Equal(t, 3, result.Polls)
+		assert.Len(t, progress, 2)
+		assert.Equal(t, 2, progress[1].Poll)
+	})
+
+	t.Run("Command failures are retried", func(t *testing.T) {
+		executions := 0
+
+		_, result, err := PollCodeBlock(
+			codeBlock,
+			func() (shells.CommandOutput, error) {
+				executions++
+				if executions == 1 {
+					return shells.CommandOutput{}, errors.New("connection refused")
+				}
+				return shells.CommandOutput{StdOut: "ready"}, nil
+			},
+			nil,
+			nil,
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, result.Polls)
+	})
+
+	t.Run("Times out when the output never becomes valid", func(t *testing.T) {
+		timingOut := codeBlock
+		timingOut.WaitUntil = &parsers.WaitCondition{
+			Interval: 5 * time.Millisecond,
+			Timeout:  20 * time.Millisecond,
+		}
+
+		_, result, err := PollCodeBlock(
+			timingOut,
+			func() (shells.CommandOutput, error) {
+				return shells.CommandOutput{StdOut: "starting"}, nil
+			},
+			nil,
+			nil,
+		)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "timed out")
+		assert.GreaterOrEqual(t, result.Polls, 2)
+	})
+}
@@ -5,16 +5,21 @@ import (
 	"os"
 
 	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
 )
 
 type Report struct {
-	Name                 string                 `json:"name"`
-	Properties           map[string]interface{} `json:"properties"`
-	EnvironmentVariables map[string]string      `json:"environmentVariables"`
-	Success              bool                   `json:"success"`
-	Error                string                 `json:"error"`
-	FailedAtStep         int                    `json:"failedAtStep"`
-	CodeBlocks           []StatefulCodeBlock    `json:"steps"`
+	Name                 string                    `json:"name"`
+	Properties           map[string]interface{}    `json:"properties"`
+	EnvironmentVariables map[string]string         `json:"environmentVariables"`
+	Success              bool                      `json:"success"`
+	Error                string                    `json:"error"`
+	FailedAtStep         int                       `json:"failedAtStep"`
+	FailedAt             *parsers.SourcePosition   `json:"failedAt"`
+	CodeBlocks           []StatefulCodeBlock       `json:"steps"`
+	BackgroundProcesses  []BackgroundProcessResult `json:"backgroundProcesses"`
+	Files                []MaterializedFile        `json:"files"`
+	Events               []Event                   `json:"events"`
 }
 
 func (report *Report) WithProperties(properties map[string]interface{}) *Report {
@@ -32,6 +37,35 @@ func (report *Report) WithCodeBlocks(codeBlocks []StatefulCodeBlock) *Report {
 	return report
 }
 
+func (report *Report) WithBackgroundProcesses(processes []BackgroundProcessResult) *Report {
+	report.BackgroundProcesses = processes
+	return report
+}
+
+func (report *Report) WithFiles(files []MaterializedFile) *Report {
+	report.Files = files
+	return report
+}
+
+// Records the events of the scenario, which are emitted the same way as by
+// `--output jsonl`.
+func (report *Report) WithEvents(events []Event) *Report {
+	report.Events = events
+	return report
+}
+
+// Records the code block that the scenario failed on, if any.
+func (report *Report) WithFailedCodeBlock(codeBlock *StatefulCodeBlock) *Report {
+	if codeBlock == nil {
+		return report
+	}
+
+	position := codeBlock.CodeBlock.Position
+	report.FailedAtStep = codeBlock.StepNumber
+	report.FailedAt = &position
+	return report
+}
+
 func (report *Report) WithError(err error) *Report {
 	if err == nil {
 		return report
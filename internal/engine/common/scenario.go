@@ -6,30 +6,81 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/lib/fs"
 	"github.com/Azure/InnovationEngine/internal/logging"
 	"github.com/Azure/InnovationEngine/internal/parsers"
-	"github.com/Azure/InnovationEngine/internal/patterns"
+	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/yuin/goldmark/ast"
 )
 
 // Individual steps within a scenario.
 type Step struct {
-	Name       string
-	CodeBlocks []parsers.CodeBlock
+	Name       string              `json:"name"`
+	CodeBlocks []parsers.CodeBlock `json:"codeBlocks"`
+}
+
+// Where the value of a scenario variable was declared.
+type VariableSource string
+
+const (
+	// The INI file next to the markdown file.
+	VariableSourceIni VariableSource = "ini"
+	// A ```variables``` comment within the markdown file.
+	VariableSourceMarkdown VariableSource = "markdown"
+	// A ```variables``` comment within a prerequisite.
+	VariableSourcePrerequisite VariableSource = "prerequisite"
+	// A --var flag.
+	VariableSourceCli VariableSource = "cli"
+	// The vars of the IE configuration files.
+	VariableSourceConfig VariableSource = "config"
+	// An assignment within a code block.
+	VariableSourceCodeBlock VariableSource = "codeBlock"
+	// Read by a code block but never assigned, so its value can only come from
+	// the environment the scenario runs in.
+	VariableSourceUndefined VariableSource = "undefined"
+)
+
+// A variable declared by a scenario, along with where its value came from.
+type ScenarioVariable struct {
+	Name   string         `json:"name"`
+	Value  string         `json:"value"`
+	Source VariableSource `json:"source"`
+	// The file and line that declared the variable, empty for CLI and
+	// configuration variables.
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+	// The section of the INI file that declared the variable.
+	Section string `json:"section,omitempty"`
+}
+
+// A scenario linked from the prerequisites section of another scenario, whose
+// code blocks are executed before the code blocks of the scenario.
+type Prerequisite struct {
+	Title  string `json:"title"`
+	Source string `json:"source"`
+	// The prerequisites of the prerequisite. Prerequisites are only resolved
+	// one level deep for now, so this is always empty.
+	Prerequisites []Prerequisite `json:"prerequisites"`
 }
 
 // Scenarios are the top-level object that represents a scenario to be executed.
 type Scenario struct {
-	Name        string
-	MarkdownAst ast.Node
-	Steps       []Step
-	Properties  map[string]interface{}
-	Environment map[string]string
-	Source      []byte
+	Name          string
+	Path          string
+	MarkdownAst   ast.Node
+	Steps         []Step
+	Properties    map[string]interface{}
+	Environment   map[string]string
+	Variables     []ScenarioVariable
+	Prerequisites []Prerequisite
+	Source        []byte
+	// The overridden variables that aren't assigned by any code block, which
+	// are exported before the first step instead.
+	UnmatchedOverrides []string
 }
 
 // Get the markdown source for the scenario as a string.
@@ -58,6 +109,52 @@ func groupCodeBlocksIntoSteps(blocks []parsers.CodeBlock) []Step {
 	return groupedSteps
 }
 
+// Drops the code blocks written in an opt-in language, such as python, that
+// don't opt into being executed with the exec attribute. Code blocks that are
+// written to a file are always kept.
+func filterExecutableCodeBlocks(blocks []parsers.CodeBlock) []parsers.CodeBlock {
+	var executable []parsers.CodeBlock
+	for _, block := range blocks {
+		if block.File == nil && !shells.ShouldExecute(block.Language, block.Attributes) {
+			logging.GlobalLogger.Debugf(
+				"Skipping the %s code block on line %d, it doesn't set %s=true",
+				block.Language,
+				block.Position.StartLine,
+				shells.ExecuteAttribute,
+			)
+			continue
+		}
+		executable = append(executable, block)
+	}
+	return executable
+}
+
+// Records the file that code blocks were parsed from in their positions, along
+// with the positions of their expected outputs and directives.
+func setCodeBlockFile(blocks []parsers.CodeBlock, file string) []parsers.CodeBlock {
+	setFile := func(position *parsers.SourcePosition) {
+		if position.StartLine != 0 {
+			position.File = file
+		}
+	}
+
+	for index := range blocks {
+		block := &blocks[index]
+		setFile(&block.Position)
+		setFile(&block.ExpectedOutput.Position)
+		for assertion := range block.Assertions {
+			setFile(&block.Assertions[assertion].Position)
+		}
+		if block.WaitUntil != nil {
+			setFile(&block.WaitUntil.Position)
+		}
+		if block.Background != nil {
+			setFile(&block.Background.Position)
+		}
+	}
+	return blocks
+}
+
 // Download the scenario markdown over http
 func downloadScenarioMarkdown(url string) ([]byte, error) {
 	resp, err := http.Get(url)
@@ -89,14 +186,20 @@ func resolveMarkdownSource(path string) ([]byte, error) {
 	return os.ReadFile(path)
 }
 
-// Creates a scenario object from a given markdown file. languagesToExecute is
-// used to filter out code blocks that should not be parsed out of the markdown
-// file.
+// Creates a scenario object from a given markdown file. Only the code blocks
+// written in a language with a registered executor are parsed out of the
+// markdown file. The configuration variables override the assignments of the
+// scenario like the overrides do, but without warning when they don't match
+// any. The INI section selects the section of the INI file that is layered on
+// top of its default section.
 func CreateScenarioFromMarkdown(
 	path string,
-	languagesToExecute []string,
 	environmentVariableOverrides map[string]string,
+	configVariables map[string]string,
+	iniSection string,
 ) (*Scenario, error) {
+	languagesToExecute := shells.ExecutableLanguages()
+
 	source, err := resolveMarkdownSource(path)
 	if err != nil {
 		return nil, err
@@ -105,16 +208,52 @@ func CreateScenarioFromMarkdown(
 	// Load environment variables
 	markdownINI := strings.TrimSuffix(path, filepath.Ext(path)) + ".ini"
 	environmentVariables := make(map[string]string)
+	variables := make(map[string]ScenarioVariable)
+	declareVariables := func(declared map[string]string, source VariableSource, file string, lines map[string]int) {
+		for key, value := range declared {
+			environmentVariables[key] = value
+			variables[key] = ScenarioVariable{
+				Name:   key,
+				Value:  value,
+				Source: source,
+				File:   file,
+				Line:   lines[key],
+			}
+		}
+	}
+	declareMarkdownVariables := func(declarations []parsers.VariableDeclaration, source VariableSource, file string) {
+		declared := make(map[string]string)
+		lines := make(map[string]int)
+		for _, declaration := range declarations {
+			declared[declaration.Name] = declaration.Value
+			lines[declaration.Name] = declaration.Line
+		}
+		declareVariables(declared, source, file, lines)
+	}
 
 	// Check if the INI file exists & load it.
 	if !fs.FileExists(markdownINI) {
+		if iniSection != "" {
+			return nil, fmt.Errorf("the INI section %s can't be selected, INI file '%s' does not exist", iniSection, markdownINI)
+		}
 		logging.GlobalLogger.Infof("INI file '%s' does not exist, skipping...", markdownINI)
 	} else {
 		logging.GlobalLogger.Infof("INI file '%s' exists, loading...", markdownINI)
-		environmentVariables, err = parsers.ParseINIFile(markdownINI)
+		iniVariables, err := parsers.ParseINIProfile(markdownINI, iniSection)
 		if err != nil {
 			return nil, err
 		}
+		for key, variable := range iniVariables {
+			environmentVariables[key] = variable.Value
+			variables[key] = ScenarioVariable{
+				Name:    key,
+				Value:   variable.Value,
+				Source:  VariableSourceIni,
+				File:    markdownINI,
+				Line:    variable.Line,
+				Section: variable.Section,
+			}
+		}
 
 		for key, value := range environmentVariables {
 			logging.GlobalLogger.Debugf("Setting %s=%s\n", key, value)
@@ -124,18 +263,24 @@ func CreateScenarioFromMarkdown(
 	// Convert the markdown into an AST and extract the scenario variables.
 	markdown := parsers.ParseMarkdownIntoAst(source)
 	properties := parsers.ExtractYamlMetadataFromAst(markdown)
-	scenarioVariables := parsers.ExtractScenarioVariablesFromAst(markdown, source)
-	for key, value := range scenarioVariables {
-		environmentVariables[key] = value
-	}
+	declareMarkdownVariables(
+		parsers.ExtractScenarioVariableDeclarationsFromAst(markdown, source),
+		VariableSourceMarkdown,
+		path,
+	)
 
 	// Extract the code blocks from the markdown file.
-	codeBlocks := parsers.ExtractCodeBlocksFromAst(markdown, source, languagesToExecute)
+	codeBlocks, err := parsers.ExtractCodeBlocksFromAst(markdown, source, languagesToExecute)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	codeBlocks = setCodeBlockFile(filterExecutableCodeBlocks(codeBlocks), path)
 	logging.GlobalLogger.WithField("CodeBlocks", codeBlocks).
 		Debugf("Found %d code blocks", len(codeBlocks))
 
 	// Extract the URLs of any prerequisite documents linked from the markdown file.
 	// TODO: This is a bit of a hack. Should be refactored to remove duplication. Use recursion.
+	prerequisites := []Prerequisite{}
 	prerequisiteUrls, err := parsers.ExtractPrerequisiteUrlsFromAst(markdown, source)
 	if err == nil && len(prerequisiteUrls) > 0 {
 		for _, url := range prerequisiteUrls {
@@ -154,12 +299,31 @@ func CreateScenarioFromMarkdown(
 				properties[key] = value
 			}
 
-			prerequisiteVariables := parsers.ExtractScenarioVariablesFromAst(prerequisiteMarkdown, prerequisiteSource)
-			for key, value := range prerequisiteVariables {
-				environmentVariables[key] = value
+			declareMarkdownVariables(
+				parsers.ExtractScenarioVariableDeclarationsFromAst(prerequisiteMarkdown, prerequisiteSource),
+				VariableSourcePrerequisite,
+				url,
+			)
+
+			prerequisiteTitle, err := parsers.ExtractScenarioTitleFromAst(prerequisiteMarkdown, prerequisiteSource)
+			if err != nil {
+				prerequisiteTitle = filepath.Base(url)
 			}
+			prerequisites = append(prerequisites, Prerequisite{
+				Title:         prerequisiteTitle,
+				Source:        url,
+				Prerequisites: []Prerequisite{},
+			})
 
-			prerequisiteCodeBlocks := parsers.ExtractCodeBlocksFromAst(prerequisiteMarkdown, prerequisiteSource, languagesToExecute)
+			prerequisiteCodeBlocks, err := parsers.ExtractCodeBlocksFromAst(
+				prerequisiteMarkdown,
+				prerequisiteSource,
+				languagesToExecute,
+			)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", url, err)
+			}
+			prerequisiteCodeBlocks = setCodeBlockFile(filterExecutableCodeBlocks(prerequisiteCodeBlocks), url)
 
 			// Split existing codeBlocks into before and after prerequisites
 			var beforePrerequisites, afterPrerequisites []parsers.CodeBlock
@@ -181,61 +345,123 @@ func CreateScenarioFromMarkdown(
 		logging.GlobalLogger.Warn(err)
 	}
 
-	varsToExport := lib.CopyMap(environmentVariableOverrides)
+	// Replace the values assigned to the overridden variables within the shell
+	// code blocks. The overrides win over the configuration variables.
+	configOverrides := make(map[string]string)
+	for key, value := range configVariables {
+		if _, overridden := environmentVariableOverrides[key]; !overridden {
+			configOverrides[key] = value
+		}
+	}
+	overrides := make(map[string]string)
+	for key, value := range configOverrides {
+		overrides[key] = value
+	}
 	for key, value := range environmentVariableOverrides {
-		environmentVariables[key] = value
-		logging.GlobalLogger.Debugf("Attempting to override %s with %s", key, value)
-		exportRegex := patterns.ExportVariableRegex(key)
-
-		for index, codeBlock := range codeBlocks {
-			matches := exportRegex.FindAllStringSubmatch(codeBlock.Content, -1)
-
-			if len(matches) != 0 {
-				logging.GlobalLogger.Debugf(
-					"Found %d matches for %s, deleting from varsToExport",
-					len(matches),
-					key,
-				)
-				delete(varsToExport, key)
-			} else {
-				logging.GlobalLogger.Debugf("Found no matches for %s inside of %s", key, codeBlock.Content)
-			}
+		overrides[key] = value
+	}
 
-			for _, match := range matches {
-				oldLine := match[0]
-				oldValue := match[1]
+	overrideMatches := make(map[string]int)
+	reads := make(map[string]bool)
+	for index, codeBlock := range codeBlocks {
+		if !parsers.IsShellLanguage(codeBlock.Language) || codeBlock.File != nil {
+			continue
+		}
 
-				// Replace the old export with the new export statement
-				newLine := strings.Replace(oldLine, oldValue, value+" ", 1)
-				logging.GlobalLogger.Debugf("Replacing '%s' with '%s'", oldLine, newLine)
+		content, matches, err := parsers.OverrideShellVariables(
+			codeBlock.Content,
+			overrides,
+		)
+		if err != nil {
+			logging.GlobalLogger.Warnf(
+				"Failed to parse the code block on line %d of %s, skipping its variable overrides: %s",
+				codeBlock.Position.StartLine,
+				codeBlock.Position.File,
+				err,
+			)
+			continue
+		}
 
-				// Update the code block with the new export statement
-				codeBlocks[index].Content = strings.Replace(codeBlock.Content, oldLine, newLine, 1)
+		for key, count := range matches {
+			logging.GlobalLogger.Debugf("Overrode %d assignments of %s", count, key)
+			overrideMatches[key] += count
+		}
+		if usage, err := parsers.AnalyzeShellVariables(codeBlock.Content); err == nil {
+			for _, read := range usage.Reads {
+				reads[read.Name] = true
 			}
+		}
+		codeBlocks[index].Content = content
+	}
 
+	// Configuration variables are shared by every document, so the ones that
+	// the scenario neither assigns nor reads are left out of it.
+	configVarsToExport := make(map[string]string)
+	usedConfigVariables := make(map[string]string)
+	for key, value := range configOverrides {
+		if overrideMatches[key] > 0 {
+			usedConfigVariables[key] = value
+		} else if reads[key] {
+			usedConfigVariables[key] = value
+			configVarsToExport[key] = value
+		}
+	}
+	declareVariables(usedConfigVariables, VariableSourceConfig, "", nil)
+
+	varsToExport := make(map[string]string)
+	unmatchedOverrides := []string{}
+	for key, value := range environmentVariableOverrides {
+		if overrideMatches[key] > 0 {
+			continue
 		}
+		varsToExport[key] = value
+		unmatchedOverrides = append(unmatchedOverrides, key)
+		logging.GlobalLogger.Warnf("The override of %s doesn't match any assignment of the scenario", key)
 	}
+	sort.Strings(unmatchedOverrides)
+	declareVariables(environmentVariableOverrides, VariableSourceCli, "", nil)
 
 	// If there are some variables left after going through each of the codeblocks,
 	// do not update the scenario
 	// steps.
-	if len(varsToExport) != 0 {
+	exportVariables := func(header string, exports map[string]string) {
+		if len(exports) == 0 {
+			return
+		}
 		logging.GlobalLogger.Debugf(
 			"Found %d variables to add to the scenario as a step.",
-			len(varsToExport),
+			len(exports),
 		)
 		exportCodeBlock := parsers.CodeBlock{
 			Language:       "bash",
 			Content:        "",
-			Header:         "Exporting variables defined via the CLI and not in the markdown file.",
+			Header:         header,
 			ExpectedOutput: parsers.ExpectedOutputBlock{},
 		}
-		for key, value := range varsToExport {
+		for key, value := range exports {
 			exportCodeBlock.Content += fmt.Sprintf("export %s=\"%s\"\n", key, value)
 		}
 
 		codeBlocks = append([]parsers.CodeBlock{exportCodeBlock}, codeBlocks...)
 	}
+	exportVariables("Exporting variables defined via the CLI and not in the markdown file.", varsToExport)
+	exportVariables("Exporting variables defined in the configuration files and not in the markdown file.", configVarsToExport)
+
+	// Apply the scenario wide similarity algorithm to the expected outputs that
+	// don't select one themselves. Blocks without an expected output are left
+	// alone as they aren't compared.
+	if algorithm, ok := properties[parsers.SimilarityAlgorithmProperty].(string); ok && algorithm != "" {
+		if _, err := lib.ParseSimilarityAlgorithm(algorithm); err != nil {
+			return nil, fmt.Errorf("invalid %s in %s: %w", parsers.SimilarityAlgorithmProperty, path, err)
+		}
+
+		logging.GlobalLogger.Debugf("Using %s as the default similarity algorithm", algorithm)
+		for index, block := range codeBlocks {
+			if block.ExpectedOutput.Content != "" && block.ExpectedOutput.SimilarityAlgorithm == "" {
+				codeBlocks[index].ExpectedOutput.SimilarityAlgorithm = algorithm
+			}
+		}
+	}
 
 	// Group the code blocks into steps.
 	steps := groupCodeBlocksIntoSteps(codeBlocks)
@@ -253,19 +479,34 @@ func CreateScenarioFromMarkdown(
 
 	logging.GlobalLogger.Infof("Successfully built out the scenario: %s", title)
 
+	sortedVariables := make([]ScenarioVariable, 0, len(variables))
+	for _, variable := range variables {
+		sortedVariables = append(sortedVariables, variable)
+	}
+	sort.Slice(sortedVariables, func(i, j int) bool {
+		return sortedVariables[i].Name < sortedVariables[j].Name
+	})
+
 	return &Scenario{
-		Name:        title,
-		Environment: environmentVariables,
-		Steps:       steps,
-		Properties:  properties,
-		MarkdownAst: markdown,
-		Source:      source,
+		Name:               title,
+		Path:               path,
+		Environment:        environmentVariables,
+		Variables:          sortedVariables,
+		Prerequisites:      prerequisites,
+		UnmatchedOverrides: unmatchedOverrides,
+		Steps:              steps,
+		Properties:         properties,
+		MarkdownAst:        markdown,
+		Source:             source,
 	}, nil
 }
 
-// Convert a scenario into a shell script
+// Convert a scenario into a shell script. Code blocks whose behavior changes
+// once they are converted are called out by a warning at the top of the script.
 func (s *Scenario) ToShellScript() string {
 	var script strings.Builder
+	var warnings []string
+	warned := make(map[string]bool)
 
 	for key, value := range s.Environment {
 		script.WriteString(fmt.Sprintf("export %s=\"%s\"\n", key, value))
@@ -274,9 +515,89 @@ func (s *Scenario) ToShellScript() string {
 	for _, step := range s.Steps {
 		script.WriteString(fmt.Sprintf("# %s\n", step.Name))
 		for _, block := range step.CodeBlocks {
-			script.WriteString(fmt.Sprintf("%s\n", block.Content))
+			content := block.Content
+			if block.File != nil {
+				content = fileShellCommand(block)
+			} else if executor, err := shells.GetExecutor(block.Language); err == nil {
+				content = executor.ToShellCommand(content)
+				if warner, ok := executor.(shells.ShellCommandWarner); ok {
+					warning := warner.ShellCommandWarning()
+					if !warned[warning] {
+						warned[warning] = true
+						warnings = append(warnings, warning)
+					}
+				}
+			}
+			script.WriteString(fmt.Sprintf("%s\n", content))
 		}
 	}
 
-	return script.String()
+	for _, name := range s.UnmatchedOverrides {
+		warnings = append(warnings, fmt.Sprintf("--var %s doesn't match any assignment of the scenario, it is exported at the top of this script.", name))
+	}
+
+	var header strings.Builder
+	for _, warning := range warnings {
+		header.WriteString(fmt.Sprintf("# Warning: %s\n", warning))
+	}
+
+	return header.String() + script.String()
+}
+
+// Renders a command that writes the content of a code block to its file. The
+// heredoc is only left unquoted when the variables within the content should
+// be expanded.
+func fileShellCommand(block parsers.CodeBlock) string {
+	delimiter := "'IE_EOF'"
+	if block.File.ExpandVariables {
+		delimiter = "IE_EOF"
+	}
+
+	return fmt.Sprintf(
+		"mkdir -p \"$(dirname \"%[1]s\")\"\ncat > \"%[1]s\" <<%[2]s\n%[3]s\nIE_EOF",
+		block.File.Path,
+		delimiter,
+		strings.TrimSuffix(block.Content, "\n"),
+	)
+}
+
+// A machine readable description of a scenario, as rendered by
+// `ie inspect --output`.
+type ScenarioDescription struct {
+	Title         string                 `json:"title"`
+	Source        string                 `json:"source"`
+	Properties    map[string]interface{} `json:"properties"`
+	Variables     []ScenarioVariable     `json:"variables"`
+	Prerequisites []Prerequisite         `json:"prerequisites"`
+	Steps         []Step                 `json:"steps"`
+}
+
+// Describes the fully resolved scenario, including the code blocks of its
+// prerequisites and the source of each of its variables.
+func (s *Scenario) Describe() ScenarioDescription {
+	properties, _ := lib.StringifyYamlKeys(s.Properties).(map[string]interface{})
+	if properties == nil {
+		properties = map[string]interface{}{}
+	}
+
+	description := ScenarioDescription{
+		Title:         s.Name,
+		Source:        s.Path,
+		Properties:    properties,
+		Variables:     s.Variables,
+		Prerequisites: s.Prerequisites,
+		Steps:         s.Steps,
+	}
+
+	if description.Variables == nil {
+		description.Variables = []ScenarioVariable{}
+	}
+	if description.Prerequisites == nil {
+		description.Prerequisites = []Prerequisite{}
+	}
+	if description.Steps == nil {
+		description.Steps = []Step{}
+	}
+
+	return description
 }
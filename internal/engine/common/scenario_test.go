@@ -9,6 +9,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/Azure/InnovationEngine/internal/parsers"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -99,7 +100,7 @@ func TestScenarioParsing(t *testing.T) {
 
 		path := temporaryFile.Name()
 
-		scenario, err := CreateScenarioFromMarkdown(path, []string{"bash"}, nil)
+		scenario, err := CreateScenarioFromMarkdown(path, nil, nil, "")
 
 		assert.NoError(t, err)
 		fmt.Println(scenario)
@@ -124,7 +125,7 @@ func TestScenarioParsing(t *testing.T) {
 
 		path := temporaryFile.Name()
 
-		scenario, err := CreateScenarioFromMarkdown(path, []string{"bash"}, nil)
+		scenario, err := CreateScenarioFromMarkdown(path, nil, nil, "")
 
 		assert.NoError(t, err)
 		fmt.Println(scenario)
@@ -138,10 +139,11 @@ func TestVariableOverrides(t *testing.T) {
 	t.Run("Override a standard variable declaration", func(t *testing.T) {
 		scenario, err := CreateScenarioFromMarkdown(
 			variableScenarioPath,
-			[]string{"bash"},
 			map[string]string{
 				"MY_VAR": "my_value",
 			},
+			nil,
+			"",
 		)
 
 		assert.NoError(t, err)
@@ -154,10 +156,11 @@ func TestVariableOverrides(t *testing.T) {
 		func(t *testing.T) {
 			scenario, err := CreateScenarioFromMarkdown(
 				variableScenarioPath,
-				[]string{"bash"},
 				map[string]string{
 					"NEXT_VAR": "next_value",
 				},
+				nil,
+				"",
 			)
 
 			assert.NoError(t, err)
@@ -175,11 +178,12 @@ func TestVariableOverrides(t *testing.T) {
 		func(t *testing.T) {
 			scenario, err := CreateScenarioFromMarkdown(
 				variableScenarioPath,
-				[]string{"bash"},
 				map[string]string{
 					"THIS_VAR": "this_value",
 					"THAT_VAR": "that_value",
 				},
+				nil,
+				"",
 			)
 
 			assert.NoError(t, err)
@@ -195,10 +199,11 @@ func TestVariableOverrides(t *testing.T) {
 	t.Run("Override a variable that has a subshell command as it's value", func(t *testing.T) {
 		scenario, err := CreateScenarioFromMarkdown(
 			variableScenarioPath,
-			[]string{"bash"},
 			map[string]string{
 				"SUBSHELL_VARIABLE": "subshell_value",
 			},
+			nil,
+			"",
 		)
 
 		assert.NoError(t, err)
@@ -213,10 +218,11 @@ func TestVariableOverrides(t *testing.T) {
 	t.Run("Override a variable that references another variable", func(t *testing.T) {
 		scenario, err := CreateScenarioFromMarkdown(
 			variableScenarioPath,
-			[]string{"bash"},
 			map[string]string{
 				"VAR2": "var2_value",
 			},
+			nil,
+			"",
 		)
 
 		assert.NoError(t, err)
@@ -226,5 +232,335 @@ func TestVariableOverrides(t *testing.T) {
 			scenario.Steps[4].CodeBlocks[0].Content,
 			`export VAR2=var2_value`,
 		)
+		assert.Empty(t, scenario.UnmatchedOverrides)
 	})
+
+	t.Run("Overrides that don't match any assignment are reported", func(t *testing.T) {
+		directory := t.TempDir()
+		path := filepath.Join(directory, "scenario.md")
+		assert.NoError(t, os.WriteFile(filepath.Join(directory, "scenario.ini"), []byte("REGION=eastus\n"), 0644))
+		assert.NoError(t, os.WriteFile(path, []byte("# Scenario\n\n## Deploy\n\n```bash\necho $REGION\n```\n"), 0644))
+
+		scenario, err := CreateScenarioFromMarkdown(
+			path,
+			map[string]string{
+				"REGION":  "westus",
+				"UNKNOWN": "value",
+			},
+			nil,
+			"",
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"REGION", "UNKNOWN"}, scenario.UnmatchedOverrides)
+		assert.Contains(t, scenario.Steps[0].CodeBlocks[0].Content, `export REGION="westus"`)
+		assert.Contains(t, scenario.ToShellScript(), "# Warning: --var UNKNOWN doesn't match any assignment of the scenario")
+	})
+
+	t.Run("Configuration variables override assignments without warnings", func(t *testing.T) {
+		scenario, err := CreateScenarioFromMarkdown(
+			variableScenarioPath,
+			map[string]string{
+				"NEXT_VAR": "next_value",
+			},
+			map[string]string{
+				"MY_VAR":   "config_value",
+				"NEXT_VAR": "config_value",
+				"UNUSED":   "config_value",
+			},
+			"",
+		)
+
+		assert.NoError(t, err)
+		assert.Empty(t, scenario.UnmatchedOverrides)
+		assert.Contains(t, scenario.Steps[0].CodeBlocks[0].Content, "export MY_VAR=config_value")
+		assert.Contains(t, scenario.Steps[1].CodeBlocks[0].Content, "export NEXT_VAR=next_value")
+		assert.NotContains(t, scenario.ToShellScript(), "export UNUSED=")
+		assert.Contains(t, scenario.Variables, ScenarioVariable{Name: "MY_VAR", Value: "config_value", Source: VariableSourceConfig})
+	})
+
+	t.Run("Configuration variables that are only read are exported", func(t *testing.T) {
+		directory := t.TempDir()
+		path := filepath.Join(directory, "scenario.md")
+		assert.NoError(t, os.WriteFile(path, []byte("# Scenario\n\n## Deploy\n\n```bash\necho $REGION\n```\n"), 0644))
+
+		scenario, err := CreateScenarioFromMarkdown(path, nil, map[string]string{"REGION": "eastus"}, "")
+
+		assert.NoError(t, err)
+		assert.Empty(t, scenario.UnmatchedOverrides)
+		assert.Equal(
+			t,
+			"Exporting variables defined in the configuration files and not in the markdown file.",
+			scenario.Steps[0].Name,
+		)
+		assert.Equal(t, "export REGION=\"eastus\"\n", scenario.Steps[0].CodeBlocks[0].Content)
+	})
+}
+
+func TestScenarioSimilarityAlgorithm(t *testing.T) {
+	t.Run("The scenario similarity algorithm applies to blocks without one", func(t *testing.T) {
+		content := "---\nsimilarity_algorithm: line_diff\n---\n# Title\n\n" +
+			"```bash\necho hello\n```\n\n<!-- expected_similarity=1.0 -->\n\n```text\nhello\n```\n\n" +
+			"```bash\necho world\n```\n\n<!-- expected_similarity=1.0 similarity_algorithm=exact -->\n\n```text\nworld\n```\n"
+		temporaryFile, err := os.CreateTemp("", "example")
+		if err != nil {
+			t.Fatalf("Error creating temporary file: %v", err)
+		}
+		defer os.Remove(temporaryFile.Name())
+
+		if _, err := temporaryFile.Write([]byte(content)); err != nil {
+			t.Fatalf("Error writing to temporary file: %v", err)
+		}
+		if err := temporaryFile.Close(); err != nil {
+			t.Fatalf("Error closing temporary file: %v", err)
+		}
+
+		scenario, err := CreateScenarioFromMarkdown(temporaryFile.Name(), nil, nil, "")
+
+		assert.NoError(t, err)
+		blocks := scenario.Steps[0].CodeBlocks
+		assert.Equal(t, "line_diff", blocks[0].ExpectedOutput.SimilarityAlgorithm)
+		assert.Equal(t, "exact", blocks[1].ExpectedOutput.SimilarityAlgorithm)
+	})
+
+	t.Run("Blocks without an expected output keep no algorithm", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "scenario.md")
+		content := "---\nsimilarity_algorithm: exact\n---\n# Title\n\n```bash\necho hello\n```\n"
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+		scenario, err := CreateScenarioFromMarkdown(path, nil, nil, "")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "", scenario.Steps[0].CodeBlocks[0].ExpectedOutput.SimilarityAlgorithm)
+	})
+
+	t.Run("Unknown algorithms are rejected", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "scenario.md")
+		assert.NoError(t, os.WriteFile(path, []byte("---\nsimilarity_algorithm: exactly\n---\n# Title\n"), 0644))
+
+		_, err := CreateScenarioFromMarkdown(path, nil, nil, "")
+		assert.ErrorContains(t, err, "exactly")
+
+		assert.NoError(t, os.WriteFile(
+			path,
+			[]byte("# Title\n\n```bash\necho hello\n```\n\n<!-- expected_similarity=1.0 similarity_algorithm=levenstein -->\n```text\nhello\n```\n"),
+			0644,
+		))
+
+		_, err = CreateScenarioFromMarkdown(path, nil, nil, "")
+		assert.ErrorContains(t, err, "line 7")
+	})
+}
+
+func TestScenarioToShellScript(t *testing.T) {
+	scenario := Scenario{
+		Steps: []Step{
+			{
+				Name: "Deploy",
+				CodeBlocks: []parsers.CodeBlock{
+					{
+						Language: "yaml",
+						Content:  "name: $APP\n",
+						File:     &parsers.FileTarget{Path: "k8s/app.yaml"},
+					},
+					{
+						Language: "yaml",
+						Content:  "name: $APP\n",
+						File:     &parsers.FileTarget{Path: "expanded.yaml", ExpandVariables: true},
+					},
+					{Language: "bash", Content: "kubectl apply -f k8s/app.yaml\n"},
+				},
+			},
+		},
+	}
+
+	assert.Equal(
+		t,
+		"# Deploy\n"+
+			"mkdir -p \"$(dirname \"k8s/app.yaml\")\"\ncat > \"k8s/app.yaml\" <<'IE_EOF'\nname: $APP\nIE_EOF\n"+
+			"mkdir -p \"$(dirname \"expanded.yaml\")\"\ncat > \"expanded.yaml\" <<IE_EOF\nname: $APP\nIE_EOF\n"+
+			"kubectl apply -f k8s/app.yaml\n\n",
+		scenario.ToShellScript(),
+	)
+}
+
+func TestScenarioToShellScriptWarnings(t *testing.T) {
+	scenario := Scenario{
+		Steps: []Step{
+			{
+				Name: "Analyze",
+				CodeBlocks: []parsers.CodeBlock{
+					{Language: "python", Content: "import json\n"},
+					{Language: "python", Content: "print(json.dumps({}))\n"},
+				},
+			},
+		},
+	}
+
+	script := scenario.ToShellScript()
+
+	assert.True(t, strings.HasPrefix(script, "# Warning: Python code blocks run in separate python3 processes"))
+	assert.Equal(t, 1, strings.Count(script, "# Warning:"))
+}
+
+func TestScenarioDescription(t *testing.T) {
+	directory := t.TempDir()
+	write := func(name string, content string) string {
+		path := filepath.Join(directory, name)
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	write("prerequisite.md", "# Setup\n\n<!--\n```variables\nexport REGION=eastus\n```\n-->\n\nSetup:\n\n```bash\necho setup\n```\n")
+	iniPath := write("scenario.ini", "NAME=from-ini\nSIZE=small\nTIER=basic\n")
+	path := write(
+		"scenario.md",
+		"---\nms.author: someone\n---\n# Scenario\n\n<!--\n```variables\nexport SIZE=large\n```\n-->\n\n"+
+			"## Prerequisites\n\n- [Setup](prerequisite.md)\n\n## Deploy\n\nDeploy it:\n\n```bash\necho $NAME\n```\n",
+	)
+
+	scenario, err := CreateScenarioFromMarkdown(path, map[string]string{"NAME": "from-cli"}, nil, "")
+	assert.NoError(t, err)
+
+	description := scenario.Describe()
+	assert.Equal(t, "Scenario", description.Title)
+	assert.Equal(t, path, description.Source)
+	assert.Equal(t, "someone", description.Properties["ms.author"])
+
+	assert.Equal(t, []ScenarioVariable{
+		{Name: "NAME", Value: "from-cli", Source: VariableSourceCli},
+		{Name: "REGION", Value: "eastus", Source: VariableSourcePrerequisite, File: filepath.Join(directory, "prerequisite.md"), Line: 5},
+		{Name: "SIZE", Value: "large", Source: VariableSourceMarkdown, File: path, Line: 8},
+		{Name: "TIER", Value: "basic", Source: VariableSourceIni, File: iniPath, Line: 3, Section: "default"},
+	}, description.Variables)
+
+	assert.Equal(t, []Prerequisite{
+		{Title: "Setup", Source: filepath.Join(directory, "prerequisite.md"), Prerequisites: []Prerequisite{}},
+	}, description.Prerequisites)
+
+	var contents []string
+	for _, step := range description.Steps {
+		for _, block := range step.CodeBlocks {
+			contents = append(contents, block.Content)
+		}
+	}
+	assert.Equal(t, []string{"export NAME=\"from-cli\"\n", "echo setup\n", "echo $NAME\n"}, contents)
+}
+
+func TestScenarioPositions(t *testing.T) {
+	directory := t.TempDir()
+	prerequisitePath := filepath.Join(directory, "prerequisite.md")
+	path := filepath.Join(directory, "scenario.md")
+
+	assert.NoError(t, os.WriteFile(
+		prerequisitePath,
+		[]byte("# Setup\n\nSetup:\n\n```bash\necho setup\n```\n\n<!-- ie:assert stdout contains setup -->\n"),
+		0644,
+	))
+	assert.NoError(t, os.WriteFile(
+		path,
+		[]byte("# Scenario\n\n## Prerequisites\n\n- [Setup](prerequisite.md)\n\n## Deploy\n\nDeploy it:\n\n"+
+			"```bash\necho deployed\n```\n\n<!-- expected_similarity=1.0 -->\n\n```text\ndeployed\n```\n"),
+		0644,
+	))
+
+	scenario, err := CreateScenarioFromMarkdown(path, nil, nil, "")
+	assert.NoError(t, err)
+
+	var blocks []parsers.CodeBlock
+	for _, step := range scenario.Steps {
+		blocks = append(blocks, step.CodeBlocks...)
+	}
+	if !assert.Len(t, blocks, 2) {
+		return
+	}
+
+	// Code blocks of prerequisites keep the file they come from.
+	setup := blocks[0]
+	assert.Equal(t, parsers.SourcePosition{File: prerequisitePath, StartLine: 5, EndLine: 7}, setup.Position)
+	assert.Equal(t, parsers.SourcePosition{File: prerequisitePath, StartLine: 9, EndLine: 9}, setup.Assertions[0].Position)
+
+	deploy := blocks[1]
+	assert.Equal(t, parsers.SourcePosition{File: path, StartLine: 11, EndLine: 13}, deploy.Position)
+	assert.Equal(t, parsers.SourcePosition{File: path, StartLine: 17, EndLine: 19}, deploy.ExpectedOutput.Position)
+}
+
+func TestScenarioIniSections(t *testing.T) {
+	directory := t.TempDir()
+	iniPath := filepath.Join(directory, "scenario.ini")
+	path := filepath.Join(directory, "scenario.md")
+	assert.NoError(t, os.WriteFile(iniPath, []byte("[default]\nREGION=eastus\nSIZE=small\n\n[westus]\nREGION=westus\n"), 0644))
+	assert.NoError(t, os.WriteFile(path, []byte("# Scenario\n\n## Deploy\n\n```bash\necho $REGION $SIZE\n```\n"), 0644))
+
+	t.Run("The selected section is layered on top of default", func(t *testing.T) {
+		scenario, err := CreateScenarioFromMarkdown(path, nil, nil, "westus")
+		assert.NoError(t, err)
+
+		assert.Equal(t, "westus", scenario.Environment["REGION"])
+		assert.Equal(t, "small", scenario.Environment["SIZE"])
+		assert.Equal(t, []ScenarioVariable{
+			{Name: "REGION", Value: "westus", Source: VariableSourceIni, File: iniPath, Line: 6, Section: "westus"},
+			{Name: "SIZE", Value: "small", Source: VariableSourceIni, File: iniPath, Line: 3, Section: "default"},
+		}, scenario.Describe().Variables)
+	})
+
+	t.Run("Other sections are ignored without a selection", func(t *testing.T) {
+		scenario, err := CreateScenarioFromMarkdown(path, nil, nil, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "eastus", scenario.Environment["REGION"])
+	})
+
+	t.Run("Unknown sections are rejected", func(t *testing.T) {
+		_, err := CreateScenarioFromMarkdown(path, nil, nil, "ci")
+		assert.ErrorContains(t, err, "[ci]")
+	})
+
+	t.Run("Files without a default section keep the keys of every section", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(iniPath, []byte("[azure]\nREGION=eastus\nSIZE=small\n"), 0644))
+
+		scenario, err := CreateScenarioFromMarkdown(path, nil, nil, "")
+		assert.NoError(t, err)
+		assert.Equal(t, "eastus", scenario.Environment["REGION"])
+		assert.Equal(t, "small", scenario.Environment["SIZE"])
+	})
+}
+
+func TestScenarioInvalidDirectives(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.md")
+	assert.NoError(t, os.WriteFile(
+		path,
+		[]byte("# Scenario\n\n## Deploy\n\nDeploy it:\n\n```bash\necho deployed\n```\n\n<!-- ie:assert stdout not contians Error -->\n"),
+		0644,
+	))
+
+	_, err := CreateScenarioFromMarkdown(path, nil, nil, "")
+	assert.ErrorContains(t, err, path)
+	assert.ErrorContains(t, err, "line 11: Invalid assertion")
+
+	assert.NoError(t, os.WriteFile(
+		path,
+		[]byte("# Scenario\n\n## Deploy\n\nDeploy it:\n\n```bash\ncurl -s localhost\n```\n\n<!-- ie:wait-until retries=3 -->\n"),
+		0644,
+	))
+
+	_, err = CreateScenarioFromMarkdown(path, nil, nil, "")
+	assert.ErrorContains(t, err, "line 11: Invalid wait-until directive")
+}
+
+func TestScenarioOptInLanguages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.md")
+	content := "# Scenario\n\n## Deploy\n\n```bash\necho deployed\n```\n\n" +
+		"```python\nprint('illustration')\n```\n\n" +
+		"```python exec=true\nprint('executed')\n```\n\n" +
+		"```http\nGET http://localhost\n```\n"
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	scenario, err := CreateScenarioFromMarkdown(path, nil, nil, "")
+
+	assert.NoError(t, err)
+	blocks := scenario.Steps[0].CodeBlocks
+	if assert.Len(t, blocks, 2) {
+		assert.Equal(t, "bash", blocks[0].Language)
+		assert.Equal(t, "print('executed')\n", blocks[1].Content)
+	}
 }
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+)
+
+// A syntax error within a shell code block of a scenario, positioned within
+// the markdown file that the code block comes from.
+type CodeBlockSyntaxError struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+func (e CodeBlockSyntaxError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: syntax error: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// Parses every shell code block of a scenario without executing it and
+// returns the syntax errors found, in the order the code blocks are executed.
+// Code blocks that are written to a file and code blocks generated by IE are
+// not checked.
+func CheckScenarioSyntax(scenario *Scenario) []CodeBlockSyntaxError {
+	var syntaxErrors []CodeBlockSyntaxError
+
+	for _, step := range scenario.Steps {
+		for _, block := range step.CodeBlocks {
+			if !parsers.IsShellLanguage(block.Language) || block.File != nil || block.Position.File == "" {
+				continue
+			}
+
+			err := parsers.CheckShellSyntax(block.Content, block.Language)
+			if err == nil {
+				continue
+			}
+
+			// The content of a code block starts on the line after its opening
+			// fence.
+			syntaxErrors = append(syntaxErrors, CodeBlockSyntaxError{
+				File:    block.Position.File,
+				Line:    block.Position.StartLine + err.Line,
+				Column:  err.Column,
+				Message: err.Message,
+			})
+		}
+	}
+
+	return syntaxErrors
+}
@@ -0,0 +1,28 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckScenarioSyntax(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.md")
+	content := "# Scenario\n\n## Valid\n\n```bash\necho hello\n```\n\n" +
+		"## Invalid\n\n```bash\necho one\nif true; then\n  echo two\n```\n\n" +
+		"## Not a shell\n\n```python\nif True:\n```\n"
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	scenario, err := CreateScenarioFromMarkdown(path, nil, nil, "")
+	assert.NoError(t, err)
+
+	syntaxErrors := CheckScenarioSyntax(scenario)
+	if assert.Len(t, syntaxErrors, 1) {
+		assert.Equal(t, path, syntaxErrors[0].File)
+		assert.Equal(t, 13, syntaxErrors[0].Line)
+		assert.Equal(t, 1, syntaxErrors[0].Column)
+		assert.Contains(t, syntaxErrors[0].Error(), path+":13:1: syntax error: ")
+	}
+}
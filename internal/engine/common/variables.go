@@ -0,0 +1,193 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+)
+
+// A code block that reads or writes a variable. Steps and code blocks are
+// numbered from 1, the same way `ie inspect` numbers them.
+type VariableReference struct {
+	Step      int    `json:"step"`
+	CodeBlock int    `json:"codeBlock"`
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+}
+
+func (reference VariableReference) String() string {
+	return fmt.Sprintf("%d.%d (%s:%d)", reference.Step, reference.CodeBlock, reference.File, reference.Line)
+}
+
+// Where a variable gets its final value from, and which code blocks use it.
+type VariableProvenance struct {
+	Name   string         `json:"name"`
+	Value  string         `json:"value"`
+	Source VariableSource `json:"source"`
+	File   string         `json:"file,omitempty"`
+	Line   int            `json:"line,omitempty"`
+	// The section of the INI file that set the value.
+	Section string `json:"section,omitempty"`
+	// The code blocks that read the variable.
+	ReadBy []VariableReference `json:"readBy"`
+	// The code blocks that assign the variable.
+	WrittenBy []VariableReference `json:"writtenBy"`
+	// The reads of the variable that happen before any value is assigned to
+	// it.
+	UsedBeforeDefined []VariableReference `json:"usedBeforeDefined"`
+}
+
+// Variables that are set by bash or by the environment of almost every
+// shell, which aren't reported when the code blocks read them without
+// assigning them.
+var wellKnownVariables = map[string]bool{
+	"BASH_SOURCE":  true,
+	"BASH_VERSION": true,
+	"EDITOR":       true,
+	"EUID":         true,
+	"HOME":         true,
+	"HOSTNAME":     true,
+	"IFS":          true,
+	"LANG":         true,
+	"LINENO":       true,
+	"LOGNAME":      true,
+	"OLDPWD":       true,
+	"OSTYPE":       true,
+	"PATH":         true,
+	"PPID":         true,
+	"PWD":          true,
+	"RANDOM":       true,
+	"REPLY":        true,
+	"SECONDS":      true,
+	"SHELL":        true,
+	"TERM":         true,
+	"TMPDIR":       true,
+	"UID":          true,
+	"USER":         true,
+}
+
+// Traces every variable of a scenario from the variables it declares and the
+// assignments within its shell code blocks, in the order they are executed.
+// The last assignment to a variable determines its final value, except for
+// variables set with --var, which replace the assignments within the code
+// blocks. Variables that the code blocks read but never assign, such as a
+// misspelled name, are included with an undefined source unless they are
+// well known, such as $HOME.
+func AnalyzeScenarioVariables(scenario *Scenario) []VariableProvenance {
+	provenances := make(map[string]*VariableProvenance)
+	defined := make(map[string]bool)
+
+	for _, variable := range scenario.Variables {
+		provenances[variable.Name] = &VariableProvenance{
+			Name:    variable.Name,
+			Value:   variable.Value,
+			Source:  variable.Source,
+			File:    variable.File,
+			Line:    variable.Line,
+			Section: variable.Section,
+		}
+		defined[variable.Name] = true
+	}
+
+	reads := make(map[string][]VariableReference)
+	undefinedReads := make(map[string][]VariableReference)
+
+	for stepNumber, step := range scenario.Steps {
+		for codeBlockNumber, block := range step.CodeBlocks {
+			// Code blocks generated by IE, such as the exports of --var, have no
+			// position and are already accounted for.
+			if !parsers.IsShellLanguage(block.Language) || block.File != nil || block.Position.File == "" {
+				continue
+			}
+
+			usage, err := parsers.AnalyzeShellVariables(block.Content)
+			if err != nil {
+				logging.GlobalLogger.Warnf(
+					"Skipping the variables of the code block at %s:%d: %s",
+					block.Position.File,
+					block.Position.StartLine,
+					err,
+				)
+				continue
+			}
+
+			reference := func(access parsers.ShellVariableAccess) VariableReference {
+				return VariableReference{
+					Step:      stepNumber + 1,
+					CodeBlock: codeBlockNumber + 1,
+					File:      block.Position.File,
+					Line:      block.Position.StartLine + access.Line,
+				}
+			}
+
+			// Walk through the accesses in the order they happen. Reads on the
+			// same line as a write happen first, I.E. `B=$A`.
+			readIndex, writeIndex := 0, 0
+			for readIndex < len(usage.Reads) || writeIndex < len(usage.Writes) {
+				if writeIndex == len(usage.Writes) ||
+					(readIndex < len(usage.Reads) && usage.Reads[readIndex].Line <= usage.Writes[writeIndex].Line) {
+					read := usage.Reads[readIndex]
+					readIndex++
+
+					reads[read.Name] = append(reads[read.Name], reference(read))
+					if !defined[read.Name] {
+						undefinedReads[read.Name] = append(undefinedReads[read.Name], reference(read))
+					}
+					continue
+				}
+
+				write := usage.Writes[writeIndex]
+				writeIndex++
+				defined[write.Name] = true
+
+				provenance, ok := provenances[write.Name]
+				if !ok {
+					provenance = &VariableProvenance{Name: write.Name}
+					provenances[write.Name] = provenance
+				}
+				provenance.WrittenBy = append(provenance.WrittenBy, reference(write))
+
+				if provenance.Source != VariableSourceCli && provenance.Source != VariableSourceConfig {
+					provenance.Value = write.Value
+					provenance.Source = VariableSourceCodeBlock
+					provenance.File = block.Position.File
+					provenance.Line = reference(write).Line
+					provenance.Section = ""
+				}
+			}
+		}
+	}
+
+	for name := range reads {
+		if _, ok := provenances[name]; !ok && !wellKnownVariables[name] {
+			provenances[name] = &VariableProvenance{Name: name, Source: VariableSourceUndefined}
+		}
+	}
+
+	var names []string
+	for name := range provenances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]VariableProvenance, 0, len(names))
+	for _, name := range names {
+		provenance := provenances[name]
+		provenance.ReadBy = nonNilReferences(reads[name])
+		provenance.WrittenBy = nonNilReferences(provenance.WrittenBy)
+		provenance.UsedBeforeDefined = nonNilReferences(undefinedReads[name])
+		result = append(result, *provenance)
+	}
+
+	return result
+}
+
+// Keeps empty lists of references as empty lists in the JSON output.
+func nonNilReferences(references []VariableReference) []VariableReference {
+	if references == nil {
+		return []VariableReference{}
+	}
+	return references
+}
@@ -0,0 +1,65 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzeScenarioVariables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.md")
+	markdown := "# Variables\n\n" +
+		"<!--\n```variables\nexport LOCATION=eastus\n```\n-->\n\n" +
+		"## Create\n\nCreate the group:\n\n" +
+		"```bash\necho $VM_NAME $HOME\nexport RESOURCE_GROUP=\"rg-$LOCATION\"\naz group create -n $RESOURCE_GROUP\n```\n\n" +
+		"## Name\n\nName the VM:\n\n" +
+		"```bash\nexport VM_NAME=vm-1\nexport SIZE=large\n```\n\n" +
+		"## Delete\n\nDelete the group:\n\n" +
+		"```bash\naz group delete -n $RESOURC_GROUP --yes ${NO_WAIT:-}\n```\n"
+	assert.NoError(t, os.WriteFile(path, []byte(markdown), 0644))
+
+	scenario, err := CreateScenarioFromMarkdown(path, map[string]string{"SIZE": "small"}, nil, "")
+	assert.NoError(t, err)
+
+	variables := make(map[string]VariableProvenance)
+	for _, variable := range AnalyzeScenarioVariables(scenario) {
+		variables[variable.Name] = variable
+	}
+
+	assert.NotContains(t, variables, "HOME")
+
+	location := variables["LOCATION"]
+	assert.Equal(t, "eastus", location.Value)
+	assert.Equal(t, VariableSourceMarkdown, location.Source)
+	assert.Equal(t, 5, location.Line)
+	assert.Equal(t, []VariableReference{{Step: 1, CodeBlock: 1, File: path, Line: 15}}, location.ReadBy)
+	assert.Empty(t, location.UsedBeforeDefined)
+
+	resourceGroup := variables["RESOURCE_GROUP"]
+	assert.Equal(t, `"rg-$LOCATION"`, resourceGroup.Value)
+	assert.Equal(t, VariableSourceCodeBlock, resourceGroup.Source)
+	assert.Equal(t, 15, resourceGroup.Line)
+	assert.Equal(t, []VariableReference{{Step: 1, CodeBlock: 1, File: path, Line: 15}}, resourceGroup.WrittenBy)
+	assert.Equal(t, []VariableReference{{Step: 1, CodeBlock: 1, File: path, Line: 16}}, resourceGroup.ReadBy)
+
+	vmName := variables["VM_NAME"]
+	assert.Equal(t, "vm-1", vmName.Value)
+	assert.Equal(t, []VariableReference{{Step: 1, CodeBlock: 1, File: path, Line: 14}}, vmName.UsedBeforeDefined)
+
+	size := variables["SIZE"]
+	assert.Equal(t, "small", size.Value)
+	assert.Equal(t, VariableSourceCli, size.Source)
+	assert.Equal(t, []VariableReference{{Step: 2, CodeBlock: 1, File: path, Line: 25}}, size.WrittenBy)
+
+	// Variables that are never assigned are reported unless they are well
+	// known, such as $HOME.
+	for _, name := range []string{"RESOURC_GROUP", "NO_WAIT"} {
+		undefined := variables[name]
+		assert.Equal(t, VariableSourceUndefined, undefined.Source)
+		assert.Equal(t, "", undefined.Value)
+		assert.Empty(t, undefined.WrittenBy)
+		assert.Equal(t, []VariableReference{{Step: 3, CodeBlock: 1, File: path, Line: 33}}, undefined.UsedBeforeDefined)
+	}
+}
@@ -3,6 +3,7 @@ package engine
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
@@ -28,6 +29,12 @@ type EngineConfiguration struct {
 	WorkingDirectory string
 	RenderValues     bool
 	ReportFile       string
+	// Check the syntax of every shell code block before executing or testing
+	// the scenario.
+	Preflight bool
+	// Replace the terminal UI with a stream of events written to stdout as
+	// JSON lines.
+	EventStream bool
 }
 
 type Engine struct {
@@ -36,32 +43,97 @@ type Engine struct {
 
 // / Create a new engine instance.
 func NewEngine(configuration EngineConfiguration) (*Engine, error) {
+	if configuration.EventStream && environments.IsAzureEnvironment(configuration.Environment) {
+		return nil, fmt.Errorf(
+			"the event stream can't be used in the %s environment, which reports its status on stdout",
+			configuration.Environment,
+		)
+	}
+
 	return &Engine{
 		Configuration: configuration,
 	}, nil
 }
 
+// Checks the syntax of the shell code blocks of a scenario before any of them
+// are executed, so that a typo late in a document doesn't leave the scenario
+// half deployed.
+func checkScenarioSyntax(scenario *common.Scenario) error {
+	syntaxErrors := common.CheckScenarioSyntax(scenario)
+	if len(syntaxErrors) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for _, syntaxError := range syntaxErrors {
+		logging.GlobalLogger.Errorf("%s", syntaxError)
+		errs = append(errs, syntaxError)
+	}
+
+	return fmt.Errorf("the scenario was not executed because of syntax errors:\n%w", errors.Join(errs...))
+}
+
 // Executes a markdown scenario.
 func (e *Engine) ExecuteScenario(scenario *common.Scenario) error {
-	return fs.UsingDirectory(e.Configuration.WorkingDirectory, func() error {
+	if e.Configuration.Preflight {
+		if err := checkScenarioSyntax(scenario); err != nil {
+			return err
+		}
+	}
+
+	e.startTrace(scenario, traceModeExecute)
+	err := fs.UsingDirectory(e.Configuration.WorkingDirectory, func() error {
 		az.SetCorrelationId(e.Configuration.CorrelationId, scenario.Environment)
 
+		// The steps are executed the same way when the events are streamed,
+		// they just aren't rendered.
+		if e.Configuration.EventStream {
+			defer common.TeardownScenario(e.Configuration.DoNotDelete)
+			events := e.startEvents(scenario)
+			defer stopEvents()
+
+			err := e.ExecuteAndRenderSteps(scenario.Steps, lib.CopyMap(scenario.Environment))
+			events.ScenarioFinished(err)
+			return err
+		}
+
 		// Execute the steps
 		fmt.Println(ui.ScenarioTitleStyle.Render(scenario.Name))
+		defer common.TeardownScenario(e.Configuration.DoNotDelete)
+
 		err := e.ExecuteAndRenderSteps(scenario.Steps, lib.CopyMap(scenario.Environment))
 		return err
 	})
+	stopTrace(err)
+	return err
 }
 
 // Executes a scenario in testing moe. This mode goes over each code block
 // and executes it without user interaction.
 func (e *Engine) TestScenario(scenario *common.Scenario) error {
-	return fs.UsingDirectory(e.Configuration.WorkingDirectory, func() error {
+	if e.Configuration.Preflight {
+		if err := checkScenarioSyntax(scenario); err != nil {
+			if !e.Configuration.EventStream {
+				fmt.Println(ui.ErrorMessageStyle.Render(err.Error()))
+			}
+			return err
+		}
+	}
+
+	// Relative paths to the scenario are relative to the directory IE was
+	// launched from rather than the working directory of the scenario.
+	launchDirectory, _ := os.Getwd()
+
+	e.startTrace(scenario, traceModeTest)
+	err := fs.UsingDirectory(e.Configuration.WorkingDirectory, func() error {
 		az.SetCorrelationId(e.Configuration.CorrelationId, scenario.Environment)
 		stepsToExecute := filterDeletionCommands(scenario.Steps, e.Configuration.DoNotDelete)
 
 		initialEnvironmentVariables := lib.GetEnvironmentVariables()
 
+		events := e.startEvents(scenario)
+		defer stopEvents()
+
 		model, err := test.NewTestModeModel(
 			scenario.Name,
 			e.Configuration.Subscription,
@@ -70,11 +142,20 @@ func (e *Engine) TestScenario(scenario *common.Scenario) error {
 			lib.CopyMap(scenario.Environment),
 		)
 		if err != nil {
+			events.ScenarioFinished(err)
 			return err
 		}
 
 		var flags []tea.ProgramOption
-		if environments.EnvironmentsGithubAction == e.Configuration.Environment {
+		if e.Configuration.EventStream {
+			// The events take the place of the UI on stdout.
+			flags = append(
+				flags,
+				tea.WithoutRenderer(),
+				tea.WithOutput(io.Discard),
+				tea.WithInput(nil),
+			)
+		} else if environments.EnvironmentsGithubAction == e.Configuration.Environment {
 			flags = append(
 				flags,
 				tea.WithoutRenderer(),
@@ -90,6 +171,10 @@ func (e *Engine) TestScenario(scenario *common.Scenario) error {
 		var finalModel tea.Model
 		finalModel, err = common.Program.Run()
 
+		// Background processes, interpreters and files only live as long as
+		// the scenario.
+		teardown := common.TeardownScenario(e.Configuration.DoNotDelete)
+
 		// TODO(vmarcella): After testing is complete, we should generate a report.
 
 		model, ok := finalModel.(test.TestModeModel)
@@ -98,6 +183,8 @@ func (e *Engine) TestScenario(scenario *common.Scenario) error {
 			return err
 		}
 
+		events.ScenarioFinished(model.GetFailure())
+
 		if e.Configuration.ReportFile != "" {
 			allEnvironmentVariables, envErr := lib.LoadEnvironmentStateFile(
 				lib.DefaultEnvironmentStateFile,
@@ -118,7 +205,11 @@ func (e *Engine) TestScenario(scenario *common.Scenario) error {
 				WithProperties(scenario.Properties).
 				WithEnvironmentVariables(variablesDeclaredByScenario).
 				WithError(model.GetFailure()).
+				WithFailedCodeBlock(model.GetFailedCodeBlock()).
 				WithCodeBlocks(model.GetCodeBlocks()).
+				WithBackgroundProcesses(teardown.BackgroundProcesses).
+				WithFiles(teardown.Files).
+				WithEvents(events.Recorded()).
 				WriteToJSONFile(e.Configuration.ReportFile)
 			if err != nil {
 				err = errors.Join(err, fmt.Errorf("failed to write report to file: %s", err))
@@ -131,7 +222,14 @@ func (e *Engine) TestScenario(scenario *common.Scenario) error {
 			)
 		}
 
-		fmt.Println(strings.Join(model.CommandLines, "\n"))
+		switch {
+		case e.Configuration.EventStream:
+			// The events already took the place of the output.
+		case environments.EnvironmentsGithubAction == e.Configuration.Environment:
+			e.reportToGithubActions(scenario, model, launchDirectory)
+		default:
+			fmt.Println(strings.Join(model.CommandLines, "\n"))
+		}
 
 		err = errors.Join(err, model.GetFailure())
 		if err != nil {
@@ -141,12 +239,40 @@ func (e *Engine) TestScenario(scenario *common.Scenario) error {
 
 		return nil
 	})
+	stopTrace(err)
+	return err
+}
+
+// Reports the results of a test run to GitHub Actions, grouping the output of
+// each step, annotating the code block that failed and appending a summary to
+// the job summary of the step when there is one.
+func (e *Engine) reportToGithubActions(
+	scenario *common.Scenario,
+	model test.TestModeModel,
+	launchDirectory string,
+) {
+	workspace := common.GithubWorkspaceFromEnvironment(launchDirectory)
+	common.WriteGithubActionsLog(os.Stdout, model.GetCodeBlocks(), workspace)
+
+	fmt.Println("::group::Innovation Engine output")
+	fmt.Println(strings.Join(model.CommandLines, "\n"))
+	fmt.Println("::endgroup::")
+
+	summaryPath := os.Getenv(common.GithubStepSummaryVariable)
+	if summaryPath == "" {
+		return
+	}
+
+	if err := common.WriteGithubStepSummary(summaryPath, scenario.Name, model.GetCodeBlocks(), workspace); err != nil {
+		logging.GlobalLogger.Errorf("Failed to write the job summary to %s: %s", summaryPath, err)
+	}
 }
 
 // Executes a Scenario in interactive mode. This mode goes over each codeblock
 // step by step and allows the user to interact with the codeblock.
 func (e *Engine) InteractWithScenario(scenario *common.Scenario) error {
-	return fs.UsingDirectory(e.Configuration.WorkingDirectory, func() error {
+	e.startTrace(scenario, traceModeInteractive)
+	err := fs.UsingDirectory(e.Configuration.WorkingDirectory, func() error {
 		az.SetCorrelationId(e.Configuration.CorrelationId, scenario.Environment)
 
 		stepsToExecute := filterDeletionCommands(scenario.Steps, e.Configuration.DoNotDelete)
@@ -168,6 +294,7 @@ func (e *Engine) InteractWithScenario(scenario *common.Scenario) error {
 		var finalModel tea.Model
 		var ok bool
 		finalModel, err = common.Program.Run()
+		common.TeardownScenario(e.Configuration.DoNotDelete)
 
 		model, ok = finalModel.(interactive.InteractiveModeModel)
 
@@ -204,4 +331,6 @@ func (e *Engine) InteractWithScenario(scenario *common.Scenario) error {
 
 		return nil
 	})
+	stopTrace(err)
+	return err
 }
@@ -2,29 +2,42 @@ package environments
 
 import (
 	"encoding/json"
-	"fmt"
-	"strings"
+	"time"
 
 	"github.com/Azure/InnovationEngine/internal/az"
 	"github.com/Azure/InnovationEngine/internal/logging"
-	"github.com/Azure/InnovationEngine/internal/patterns"
-	"github.com/Azure/InnovationEngine/internal/ui"
+	"github.com/Azure/InnovationEngine/internal/parsers"
 )
 
 // codeblock metadata needed for learn mode deployments.
 type AzureCodeBlock struct {
 	Description string `json:"description"`
 	Command     string `json:"command"`
+	// The granular state of the code block, which is only part of the
+	// versioned status.
+	State     State      `json:"state"`
+	StartedAt *time.Time `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt"`
+	// The output of the code block, truncated to its last
+	// MaxStatusOutputLength bytes.
+	Output string `json:"output"`
+	Error  string `json:"error"`
 }
 
 // Step metadata needed for learn mode deployments.
 type AzureStep struct {
 	Name       string           `json:"name"`
 	CodeBlocks []AzureCodeBlock `json:"codeblocks"`
+	State      State            `json:"state"`
+	StartedAt  *time.Time       `json:"startedAt"`
+	EndedAt    *time.Time       `json:"endedAt"`
 }
 
-// The status of a one-click deployment or learn mode deployment.
+// The status of a one-click deployment or learn mode deployment. Marshaling
+// the status produces the versioned status, while AsJsonString produces the
+// legacy status that the portal parses.
 type AzureDeploymentStatus struct {
+	SchemaVersion      int         `json:"schemaVersion"`
 	Steps              []AzureStep `json:"steps"`
 	CurrentStep        int         `json:"currentStep"`
 	CurrentCodeBlock   int         `json:"currentCodeBlock"`
@@ -33,10 +46,13 @@ type AzureDeploymentStatus struct {
 	Error              string      `json:"error"`
 	Output             string      `json:"output"`
 	ConfiguredMarkdown string      `json:"configuredMarkdown"`
+	StartedAt          *time.Time  `json:"startedAt"`
+	EndedAt            *time.Time  `json:"endedAt"`
 }
 
 func NewAzureDeploymentStatus() AzureDeploymentStatus {
 	return AzureDeploymentStatus{
+		SchemaVersion:      StatusSchemaVersion,
 		Steps:              []AzureStep{},
 		CurrentStep:        0,
 		CurrentCodeBlock:   0,
@@ -48,9 +64,10 @@ func NewAzureDeploymentStatus() AzureDeploymentStatus {
 	}
 }
 
-// Get the status as a JSON string.
+// Get the status as a JSON string, in the legacy shape that the portal
+// parses.
 func (status *AzureDeploymentStatus) AsJsonString() (string, error) {
-	json, err := json.Marshal(status)
+	json, err := json.Marshal(status.legacy())
 	if err != nil {
 		logging.GlobalLogger.Error("Failed to marshal status", err)
 		return "", err
@@ -60,9 +77,16 @@ func (status *AzureDeploymentStatus) AsJsonString() (string, error) {
 }
 
 func (status *AzureDeploymentStatus) AddStep(step string, codeBlocks []AzureCodeBlock) {
+	for index := range codeBlocks {
+		if codeBlocks[index].State == "" {
+			codeBlocks[index].State = StatePending
+		}
+	}
+
 	status.Steps = append(status.Steps, AzureStep{
 		Name:       step,
 		CodeBlocks: codeBlocks,
+		State:      StatePending,
 	})
 }
 
@@ -73,6 +97,13 @@ func (status *AzureDeploymentStatus) AddResourceURI(uri string) {
 func (status *AzureDeploymentStatus) SetError(err error) {
 	status.Status = "Failed"
 	status.Error = err.Error()
+	status.EndedAt = now()
+}
+
+// Marks the deployment as succeeded.
+func (status *AzureDeploymentStatus) SetSucceeded() {
+	status.Status = "Succeeded"
+	status.EndedAt = now()
 }
 
 func (status *AzureDeploymentStatus) SetOutput(output string) {
@@ -91,74 +122,49 @@ func (status *AzureDeploymentStatus) ConfigureMarkdownForDownload(
 		return
 	}
 
-	for key, value := range environmentVariables {
-		exportRegex := patterns.ExportVariableRegex(key)
-
-		matches := exportRegex.FindAllStringSubmatch(markdown, -1)
-
-		if len(matches) != 0 {
+	markdown, matches := parsers.OverrideMarkdownVariables(markdown, environmentVariables)
+	for key := range environmentVariables {
+		if matches[key] == 0 {
 			logging.GlobalLogger.Debugf(
-				"Found %d matches for the environment variable %s, Replacing them in markdown source.",
-				len(matches),
+				"The environment variable %s doesn't match any variable of the markdown source",
 				key,
 			)
+			continue
 		}
 
-		for _, match := range matches {
-			oldLine := match[0]
-			oldValue := match[1]
-
-			// Replace the old export with the new export statement
-			newLine := strings.Replace(oldLine, oldValue, value+" ", 1)
-			logging.GlobalLogger.Debugf("Replacing '%s' with '%s'", oldLine, newLine)
-
-			// Update the code block with the new export statement
-			markdown = strings.Replace(
-				markdown,
-				oldLine,
-				newLine,
-				1,
-			)
-		}
+		logging.GlobalLogger.Debugf(
+			"Found %d matches for the environment variable %s, Replaced them in markdown source.",
+			matches[key],
+			key,
+		)
 	}
 
 	status.ConfiguredMarkdown = markdown
 }
 
-// Print out the status JSON for azure/cloudshell if in the correct environment.
+// Sends the status to the status reporters of the current run. In an azure
+// environment the status is always printed for the portal.
 func ReportAzureStatus(status AzureDeploymentStatus, environment string) {
-	if !IsAzureEnvironment(environment) {
-		return
-	}
-
-	statusJson, err := status.AsJsonString()
-	if err != nil {
-		logging.GlobalLogger.Error("Failed to marshal status", err)
-	} else {
-		// We add these strings to the output so that the portal can find and parse
-		// the JSON status.
-		ocdStatus := fmt.Sprintf("ie_us%sie_ue", statusJson)
-		logging.GlobalLogger.Tracef("Generated status: %s", ocdStatus)
-		fmt.Println(ui.OcdStatusUpdateStyle.Render(ocdStatus))
+	for _, reporter := range activeStatusReporters(environment) {
+		if err := reporter.Report(status); err != nil {
+			logging.GlobalLogger.Errorf("Failed to report the status: %s", err)
+		}
 	}
 }
 
-// Same as ReportAzureStatus, but returns the status string instead of printing it.
+// Same as ReportAzureStatus, but returns the status string the portal expects
+// instead of printing it.
 func GetAzureStatus(status AzureDeploymentStatus, environment string) string {
 	if !IsAzureEnvironment(environment) {
 		return ""
 	}
 
-	statusJson, err := status.AsJsonString()
+	ocdStatus, err := portalStatusUpdate(status)
 	if err != nil {
 		logging.GlobalLogger.Error("Failed to marshal status", err)
 		return ""
-	} else {
-		// We add these strings to the output so that the portal can find and parse
-		// the JSON status.
-		ocdStatus := fmt.Sprintf("ie_us%sie_ue", statusJson)
-		return ocdStatus
 	}
+	return ocdStatus
 }
 
 // Attach deployed resource URIs to the one click deployment status if we're in
@@ -0,0 +1,316 @@
+package environments
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/ui"
+)
+
+// Receives the status of a deployment every time it changes, so that hosts
+// other than the terminal can follow the progress of a scenario.
+type StatusReporter interface {
+	Report(status AzureDeploymentStatus) error
+	Close() error
+}
+
+// The kinds of status reporters that can be selected with --status-reporter.
+const (
+	StatusReporterPortal  = "portal"
+	StatusReporterJsonl   = "jsonl"
+	StatusReporterSocket  = "socket"
+	StatusReporterWebhook = "webhook"
+)
+
+// Reports the status the way the portal expects it, as JSON wrapped in
+// `ie_us` and `ie_ue` markers on its own line of the terminal output.
+type PortalStatusReporter struct {
+	writer io.Writer
+}
+
+func NewPortalStatusReporter(writer io.Writer) *PortalStatusReporter {
+	return &PortalStatusReporter{writer: writer}
+}
+
+// Wraps the JSON of a status in the markers that the portal searches for.
+func portalStatusUpdate(status AzureDeploymentStatus) (string, error) {
+	statusJson, err := status.AsJsonString()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("ie_us%sie_ue", statusJson), nil
+}
+
+func (reporter *PortalStatusReporter) Report(status AzureDeploymentStatus) error {
+	ocdStatus, err := portalStatusUpdate(status)
+	if err != nil {
+		return err
+	}
+
+	logging.GlobalLogger.Tracef("Generated status: %s", ocdStatus)
+	_, err = fmt.Fprintln(reporter.writer, ui.OcdStatusUpdateStyle.Render(ocdStatus))
+	return err
+}
+
+func (reporter *PortalStatusReporter) Close() error {
+	return nil
+}
+
+// Writes each status as a line of JSON to a writer, such as a file or a
+// socket.
+type jsonLinesWriter struct {
+	mutex  sync.Mutex
+	writer io.WriteCloser
+}
+
+func (reporter *jsonLinesWriter) Report(status AzureDeploymentStatus) error {
+	statusJson, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	reporter.mutex.Lock()
+	defer reporter.mutex.Unlock()
+
+	_, err = reporter.writer.Write(append(statusJson, '\n'))
+	return err
+}
+
+func (reporter *jsonLinesWriter) Close() error {
+	reporter.mutex.Lock()
+	defer reporter.mutex.Unlock()
+
+	return reporter.writer.Close()
+}
+
+// Appends each status as a line of JSON to a file.
+type JsonLinesStatusReporter struct {
+	jsonLinesWriter
+}
+
+func NewJsonLinesStatusReporter(path string) (*JsonLinesStatusReporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the status file %s: %w", path, err)
+	}
+
+	return &JsonLinesStatusReporter{jsonLinesWriter{writer: file}}, nil
+}
+
+// Streams each status as a line of JSON over a Unix domain socket that the
+// host is listening on.
+type SocketStatusReporter struct {
+	jsonLinesWriter
+}
+
+func NewSocketStatusReporter(path string) (*SocketStatusReporter, error) {
+	connection, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the status socket %s: %w", path, err)
+	}
+
+	return &SocketStatusReporter{jsonLinesWriter{writer: connection}}, nil
+}
+
+// The time a webhook has to accept a status before it is given up on.
+const webhookTimeout = 10 * time.Second
+
+// Sends each status as the JSON body of a POST request to a URL. The requests
+// are sent in the background so that a slow webhook doesn't hold up the
+// scenario. Statuses that change while a request is in flight are coalesced,
+// so only the latest one is sent next.
+type WebhookStatusReporter struct {
+	url    string
+	client *http.Client
+
+	mutex sync.Mutex
+	// The JSON of the latest status that hasn't been sent yet.
+	pending []byte
+	closed  bool
+	// Wakes up the sender when there is a pending status, or when the
+	// reporter is closed.
+	wake chan struct{}
+	// Closed once the sender has sent the last pending status and exited.
+	done chan struct{}
+	// The last error the webhook responded with, returned when the reporter
+	// is closed.
+	err error
+}
+
+func NewWebhookStatusReporter(url string) (*WebhookStatusReporter, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("the status webhook %q must be an http or https URL", url)
+	}
+
+	reporter := &WebhookStatusReporter{
+		url:    url,
+		client: &http.Client{Timeout: webhookTimeout},
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go reporter.send()
+
+	return reporter, nil
+}
+
+// Queues a status to be sent. The status is rendered right away, as it keeps
+// changing after it is reported.
+func (reporter *WebhookStatusReporter) Report(status AzureDeploymentStatus) error {
+	statusJson, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	reporter.mutex.Lock()
+	defer reporter.mutex.Unlock()
+
+	if reporter.closed {
+		return fmt.Errorf("the status webhook %s is closed", reporter.url)
+	}
+	reporter.pending = statusJson
+
+	select {
+	case reporter.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Sends the pending statuses until the reporter is closed and the last of
+// them has been sent.
+func (reporter *WebhookStatusReporter) send() {
+	defer close(reporter.done)
+
+	for range reporter.wake {
+		reporter.mutex.Lock()
+		statusJson := reporter.pending
+		reporter.pending = nil
+		closed := reporter.closed
+		reporter.mutex.Unlock()
+
+		if statusJson != nil {
+			if err := reporter.post(statusJson); err != nil {
+				logging.GlobalLogger.Errorf("Failed to report the status: %s", err)
+				reporter.err = err
+			}
+		}
+
+		if closed {
+			return
+		}
+	}
+}
+
+func (reporter *WebhookStatusReporter) post(statusJson []byte) error {
+	response, err := reporter.client.Post(reporter.url, "application/json", bytes.NewReader(statusJson))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("the status webhook %s responded with %s", reporter.url, response.Status)
+	}
+
+	return nil
+}
+
+// Sends the last pending status and waits for it to be accepted. Returns the
+// last error the webhook responded with, if any.
+func (reporter *WebhookStatusReporter) Close() error {
+	reporter.mutex.Lock()
+	if !reporter.closed {
+		reporter.closed = true
+		close(reporter.wake)
+	}
+	reporter.mutex.Unlock()
+
+	<-reporter.done
+	return reporter.err
+}
+
+// Creates a status reporter from its description on the command line, which
+// is the kind of reporter followed by where it reports to, I.E.
+// `jsonl:/tmp/status.jsonl`, `socket:/tmp/ie.sock` or
+// `webhook:https://example.com/status`. The portal reporter writes to the
+// terminal and takes no target.
+func ParseStatusReporter(description string) (StatusReporter, error) {
+	kind, target, _ := strings.Cut(description, ":")
+
+	if kind != StatusReporterPortal && target == "" {
+		return nil, fmt.Errorf("the %s status reporter needs a target, I.E. %s:<target>", kind, kind)
+	}
+
+	switch kind {
+	case StatusReporterPortal:
+		return NewPortalStatusReporter(os.Stdout), nil
+	case StatusReporterJsonl:
+		return NewJsonLinesStatusReporter(target)
+	case StatusReporterSocket:
+		return NewSocketStatusReporter(target)
+	case StatusReporterWebhook:
+		return NewWebhookStatusReporter(target)
+	default:
+		return nil, fmt.Errorf(
+			"unknown status reporter %q, valid options are 'portal', 'jsonl', 'socket' and 'webhook'",
+			kind,
+		)
+	}
+}
+
+// The status reporters selected for the current run.
+var (
+	statusReporters      []StatusReporter
+	statusReportersMutex sync.Mutex
+)
+
+// Sets the status reporters that every status update is sent to.
+func SetStatusReporters(reporters []StatusReporter) {
+	statusReportersMutex.Lock()
+	defer statusReportersMutex.Unlock()
+
+	statusReporters = reporters
+}
+
+// Closes the status reporters of the current run.
+func CloseStatusReporters() {
+	statusReportersMutex.Lock()
+	defer statusReportersMutex.Unlock()
+
+	for _, reporter := range statusReporters {
+		if err := reporter.Close(); err != nil {
+			logging.GlobalLogger.Errorf("Failed to close the status reporter: %s", err)
+		}
+	}
+	statusReporters = nil
+}
+
+// Gets the reporters that a status update is sent to. The portal expects the
+// status on the terminal whenever IE runs in an azure environment, so it is
+// always included there.
+func activeStatusReporters(environment string) []StatusReporter {
+	statusReportersMutex.Lock()
+	defer statusReportersMutex.Unlock()
+
+	reporters := append([]StatusReporter{}, statusReporters...)
+	if !IsAzureEnvironment(environment) {
+		return reporters
+	}
+
+	for _, reporter := range reporters {
+		if _, ok := reporter.(*PortalStatusReporter); ok {
+			return reporters
+		}
+	}
+
+	return append([]StatusReporter{NewPortalStatusReporter(os.Stdout)}, reporters...)
+}
@@ -0,0 +1,160 @@
+package environments
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusReporters(t *testing.T) {
+	status := NewAzureDeploymentStatus()
+	status.CurrentStep = 2
+
+	t.Run("The portal reporter wraps the status in markers", func(t *testing.T) {
+		var output bytes.Buffer
+		reporter := NewPortalStatusReporter(&output)
+
+		assert.NoError(t, reporter.Report(status))
+		assert.Contains(t, output.String(), `ie_us{"steps":[],"currentStep":2`)
+		assert.Contains(t, output.String(), "ie_ue")
+	})
+
+	t.Run("The jsonl reporter appends a line per status", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "status.jsonl")
+		reporter, err := ParseStatusReporter("jsonl:" + path)
+		assert.NoError(t, err)
+
+		assert.NoError(t, reporter.Report(status))
+		assert.NoError(t, reporter.Report(status))
+		assert.NoError(t, reporter.Close())
+
+		content, err := os.ReadFile(path)
+		assert.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		assert.Len(t, lines, 2)
+
+		var reported AzureDeploymentStatus
+		assert.NoError(t, json.Unmarshal([]byte(lines[0]), &reported))
+		assert.Equal(t, 2, reported.CurrentStep)
+	})
+
+	t.Run("The socket reporter streams lines to the listener", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ie.sock")
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			t.Skipf("Unix domain sockets are unavailable: %s", err)
+		}
+		defer listener.Close()
+
+		received := make(chan string)
+		go func() {
+			connection, err := listener.Accept()
+			if err != nil {
+				close(received)
+				return
+			}
+			defer connection.Close()
+
+			line, _ := bufio.NewReader(connection).ReadString('\n')
+			received <- line
+		}()
+
+		reporter, err := ParseStatusReporter("socket:" + path)
+		assert.NoError(t, err)
+		defer reporter.Close()
+
+		assert.NoError(t, reporter.Report(status))
+		assert.Contains(t, <-received, `"currentStep":2`)
+	})
+
+	t.Run("The webhook reporter posts the status", func(t *testing.T) {
+		var body string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			content, _ := io.ReadAll(r.Body)
+			body = string(content)
+		}))
+		defer server.Close()
+
+		reporter, err := ParseStatusReporter("webhook:" + server.URL)
+		assert.NoError(t, err)
+
+		assert.NoError(t, reporter.Report(status))
+		assert.NoError(t, reporter.Close())
+		assert.Contains(t, body, `"currentStep":2`)
+	})
+
+	t.Run("The webhook reporter doesn't wait for the webhook", func(t *testing.T) {
+		release := make(chan struct{})
+		var bodies []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			content, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(content))
+			<-release
+		}))
+		defer server.Close()
+
+		reporter, err := ParseStatusReporter("webhook:" + server.URL)
+		assert.NoError(t, err)
+
+		// The statuses reported while the first request is in flight are
+		// coalesced into the latest one.
+		for step := 1; step <= 5; step++ {
+			status.CurrentStep = step
+			assert.NoError(t, reporter.Report(status))
+			time.Sleep(10 * time.Millisecond)
+		}
+		status.CurrentStep = 2
+
+		close(release)
+		assert.NoError(t, reporter.Close())
+		if assert.Len(t, bodies, 2) {
+			assert.Contains(t, bodies[0], `"currentStep":1`)
+			assert.Contains(t, bodies[1], `"currentStep":5`)
+		}
+	})
+
+	t.Run("Webhooks that reject the status fail when they are closed", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		reporter, err := ParseStatusReporter("webhook:" + server.URL)
+		assert.NoError(t, err)
+		assert.NoError(t, reporter.Report(status))
+		assert.Error(t, reporter.Close())
+	})
+
+	t.Run("Invalid reporters are rejected", func(t *testing.T) {
+		for _, description := range []string{"jsonl", "webhook:ftp://example.com", "carrier-pigeon:coop"} {
+			_, err := ParseStatusReporter(description)
+			assert.Error(t, err, description)
+		}
+	})
+
+	t.Run("The portal always receives the status in azure environments", func(t *testing.T) {
+		SetStatusReporters([]StatusReporter{NewPortalStatusReporter(io.Discard)})
+		defer CloseStatusReporters()
+
+		assert.Len(t, activeStatusReporters(EnvironmentsLocal), 1)
+		assert.Len(t, activeStatusReporters(EnvironmentsAzure), 1)
+
+		SetStatusReporters(nil)
+		assert.Len(t, activeStatusReporters(EnvironmentsLocal), 0)
+		assert.Len(t, activeStatusReporters(EnvironmentsAzure), 1)
+	})
+}
@@ -0,0 +1,197 @@
+package environments
+
+import (
+	"time"
+	"unicode/utf8"
+)
+
+// The version of the status document produced by marshaling an
+// AzureDeploymentStatus. It is incremented whenever a field is removed or its
+// meaning changes, so that consumers can tell which shape they receive.
+const StatusSchemaVersion = 2
+
+// The most output of a code block that is kept in the status. The end of the
+// output is kept, since that is where errors show up.
+const MaxStatusOutputLength = 4096
+
+// The prefix of output that was truncated.
+const truncatedOutputPrefix = "[truncated] "
+
+// The state of a step or a code block within the status.
+type State string
+
+const (
+	StatePending   State = "pending"
+	StateRunning   State = "running"
+	StateSucceeded State = "succeeded"
+	StateFailed    State = "failed"
+	StateSkipped   State = "skipped"
+)
+
+// The current time, as the status stores it.
+func now() *time.Time {
+	now := time.Now().UTC()
+	return &now
+}
+
+// Keeps the last MaxStatusOutputLength bytes of output, without splitting a
+// multi-byte character.
+func truncateStatusOutput(output string) string {
+	if len(output) <= MaxStatusOutputLength {
+		return output
+	}
+
+	start := len(output) - MaxStatusOutputLength
+	for start < len(output) && !utf8.RuneStart(output[start]) {
+		start++
+	}
+
+	return truncatedOutputPrefix + output[start:]
+}
+
+// Marks a code block as running. Steps and code blocks are numbered from zero,
+// while CurrentStep is numbered from one for the portal.
+func (status *AzureDeploymentStatus) StartCodeBlock(step int, codeBlock int) {
+	if step < 0 || step >= len(status.Steps) ||
+		codeBlock < 0 || codeBlock >= len(status.Steps[step].CodeBlocks) {
+		return
+	}
+
+	started := now()
+	if status.StartedAt == nil {
+		status.StartedAt = started
+	}
+
+	status.CurrentStep = step + 1
+	status.CurrentCodeBlock = codeBlock
+
+	azureStep := &status.Steps[step]
+	if azureStep.State == StatePending {
+		azureStep.State = StateRunning
+		azureStep.StartedAt = started
+	}
+
+	block := &azureStep.CodeBlocks[codeBlock]
+	block.State = StateRunning
+	block.StartedAt = started
+	block.EndedAt = nil
+	block.Output = ""
+	block.Error = ""
+}
+
+// Marks a code block as finished with its output. A code block that failed
+// fails its step, and every code block that hasn't started yet is skipped
+// since the scenario stops there. A step succeeds once its last code block
+// does.
+func (status *AzureDeploymentStatus) FinishCodeBlock(
+	step int,
+	codeBlock int,
+	output string,
+	err error,
+) {
+	if step < 0 || step >= len(status.Steps) ||
+		codeBlock < 0 || codeBlock >= len(status.Steps[step].CodeBlocks) {
+		return
+	}
+
+	ended := now()
+	azureStep := &status.Steps[step]
+	block := &azureStep.CodeBlocks[codeBlock]
+	if block.StartedAt == nil {
+		block.StartedAt = ended
+	}
+	block.EndedAt = ended
+	block.Output = truncateStatusOutput(output)
+
+	if err != nil {
+		block.State = StateFailed
+		block.Error = err.Error()
+		azureStep.State = StateFailed
+		azureStep.EndedAt = ended
+		status.skipPending()
+		return
+	}
+
+	block.State = StateSucceeded
+	if codeBlock == len(azureStep.CodeBlocks)-1 {
+		azureStep.State = StateSucceeded
+		azureStep.EndedAt = ended
+	}
+}
+
+// Skips the steps and code blocks that haven't started.
+func (status *AzureDeploymentStatus) skipPending() {
+	for step := range status.Steps {
+		azureStep := &status.Steps[step]
+		if azureStep.State == StatePending {
+			azureStep.State = StateSkipped
+		}
+		for codeBlock := range azureStep.CodeBlocks {
+			if azureStep.CodeBlocks[codeBlock].State == StatePending {
+				azureStep.CodeBlocks[codeBlock].State = StateSkipped
+			}
+		}
+	}
+}
+
+// Copies the status, so that it can be reported while the original keeps
+// changing.
+func (status AzureDeploymentStatus) Snapshot() AzureDeploymentStatus {
+	snapshot := status
+	snapshot.ResourceURIs = append([]string{}, status.ResourceURIs...)
+	snapshot.Steps = make([]AzureStep, len(status.Steps))
+	for index, step := range status.Steps {
+		snapshot.Steps[index] = step
+		snapshot.Steps[index].CodeBlocks = append([]AzureCodeBlock{}, step.CodeBlocks...)
+	}
+	return snapshot
+}
+
+// The code blocks of the status in the shape that the portal parses, from
+// before the status was versioned.
+type legacyAzureCodeBlock struct {
+	Description string `json:"description"`
+	Command     string `json:"command"`
+}
+
+type legacyAzureStep struct {
+	Name       string                 `json:"name"`
+	CodeBlocks []legacyAzureCodeBlock `json:"codeblocks"`
+}
+
+type legacyAzureDeploymentStatus struct {
+	Steps              []legacyAzureStep `json:"steps"`
+	CurrentStep        int               `json:"currentStep"`
+	CurrentCodeBlock   int               `json:"currentCodeBlock"`
+	Status             string            `json:"status"`
+	ResourceURIs       []string          `json:"resourceURIs"`
+	Error              string            `json:"error"`
+	Output             string            `json:"output"`
+	ConfiguredMarkdown string            `json:"configuredMarkdown"`
+}
+
+// Projects the status onto the legacy shape.
+func (status *AzureDeploymentStatus) legacy() legacyAzureDeploymentStatus {
+	steps := make([]legacyAzureStep, 0, len(status.Steps))
+	for _, step := range status.Steps {
+		codeBlocks := make([]legacyAzureCodeBlock, 0, len(step.CodeBlocks))
+		for _, codeBlock := range step.CodeBlocks {
+			codeBlocks = append(codeBlocks, legacyAzureCodeBlock{
+				Description: codeBlock.Description,
+				Command:     codeBlock.Command,
+			})
+		}
+		steps = append(steps, legacyAzureStep{Name: step.Name, CodeBlocks: codeBlocks})
+	}
+
+	return legacyAzureDeploymentStatus{
+		Steps:              steps,
+		CurrentStep:        status.CurrentStep,
+		CurrentCodeBlock:   status.CurrentCodeBlock,
+		Status:             status.Status,
+		ResourceURIs:       status.ResourceURIs,
+		Error:              status.Error,
+		Output:             status.Output,
+		ConfiguredMarkdown: status.ConfiguredMarkdown,
+	}
+}
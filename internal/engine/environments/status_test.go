@@ -0,0 +1,164 @@
+package environments
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStatus() AzureDeploymentStatus {
+	status := NewAzureDeploymentStatus()
+	status.AddStep("1. First", []AzureCodeBlock{
+		{Command: "echo 1", Description: "one"},
+		{Command: "echo 2", Description: "two"},
+	})
+	status.AddStep("2. Second", []AzureCodeBlock{
+		{Command: "echo 3", Description: "three"},
+	})
+	return status
+}
+
+func TestDeploymentStatusTransitions(t *testing.T) {
+	t.Run("Steps and code blocks start out pending", func(t *testing.T) {
+		status := newTestStatus()
+
+		assert.Equal(t, StatusSchemaVersion, status.SchemaVersion)
+		for _, step := range status.Steps {
+			assert.Equal(t, StatePending, step.State)
+			for _, codeBlock := range step.CodeBlocks {
+				assert.Equal(t, StatePending, codeBlock.State)
+			}
+		}
+	})
+
+	t.Run("Starting a code block marks it and its step as running", func(t *testing.T) {
+		status := newTestStatus()
+		status.StartCodeBlock(0, 1)
+
+		assert.Equal(t, 1, status.CurrentStep)
+		assert.Equal(t, 1, status.CurrentCodeBlock)
+		assert.Equal(t, StateRunning, status.Steps[0].State)
+		assert.Equal(t, StateRunning, status.Steps[0].CodeBlocks[1].State)
+		assert.NotNil(t, status.Steps[0].CodeBlocks[1].StartedAt)
+		assert.NotNil(t, status.StartedAt)
+	})
+
+	t.Run("A step succeeds with its last code block", func(t *testing.T) {
+		status := newTestStatus()
+		status.StartCodeBlock(0, 0)
+		status.FinishCodeBlock(0, 0, "1\n", nil)
+
+		assert.Equal(t, StateSucceeded, status.Steps[0].CodeBlocks[0].State)
+		assert.Equal(t, "1\n", status.Steps[0].CodeBlocks[0].Output)
+		assert.Equal(t, StateRunning, status.Steps[0].State)
+
+		status.StartCodeBlock(0, 1)
+		status.FinishCodeBlock(0, 1, "2\n", nil)
+
+		assert.Equal(t, StateSucceeded, status.Steps[0].State)
+		assert.NotNil(t, status.Steps[0].EndedAt)
+		assert.Equal(t, StatePending, status.Steps[1].State)
+	})
+
+	t.Run("A failed code block skips everything that hasn't started", func(t *testing.T) {
+		status := newTestStatus()
+		status.StartCodeBlock(0, 0)
+		status.FinishCodeBlock(0, 0, "boom", fmt.Errorf("exit status 1"))
+
+		assert.Equal(t, StateFailed, status.Steps[0].CodeBlocks[0].State)
+		assert.Equal(t, "exit status 1", status.Steps[0].CodeBlocks[0].Error)
+		assert.Equal(t, StateFailed, status.Steps[0].State)
+		assert.Equal(t, StateSkipped, status.Steps[0].CodeBlocks[1].State)
+		assert.Equal(t, StateSkipped, status.Steps[1].State)
+		assert.Equal(t, StateSkipped, status.Steps[1].CodeBlocks[0].State)
+	})
+
+	t.Run("Code blocks that don't exist are ignored", func(t *testing.T) {
+		status := newTestStatus()
+		status.StartCodeBlock(5, 0)
+		status.FinishCodeBlock(0, 5, "", nil)
+
+		assert.Equal(t, 0, status.CurrentStep)
+		assert.Nil(t, status.StartedAt)
+	})
+
+	t.Run("Succeeding and failing end the deployment", func(t *testing.T) {
+		status := newTestStatus()
+		status.SetSucceeded()
+		assert.Equal(t, "Succeeded", status.Status)
+		assert.NotNil(t, status.EndedAt)
+
+		status = newTestStatus()
+		status.SetError(fmt.Errorf("failed"))
+		assert.Equal(t, "Failed", status.Status)
+		assert.NotNil(t, status.EndedAt)
+	})
+}
+
+func TestTruncateStatusOutput(t *testing.T) {
+	t.Run("Short output is kept as is", func(t *testing.T) {
+		assert.Equal(t, "output", truncateStatusOutput("output"))
+	})
+
+	t.Run("Long output keeps its end", func(t *testing.T) {
+		output := strings.Repeat("a", MaxStatusOutputLength) + "end"
+		truncated := truncateStatusOutput(output)
+
+		assert.True(t, strings.HasPrefix(truncated, truncatedOutputPrefix))
+		assert.True(t, strings.HasSuffix(truncated, "end"))
+		assert.Equal(t, len(truncatedOutputPrefix)+MaxStatusOutputLength, len(truncated))
+	})
+
+	t.Run("Multi-byte characters aren't split", func(t *testing.T) {
+		output := "é" + strings.Repeat("a", MaxStatusOutputLength-1)
+		truncated := truncateStatusOutput(output)
+
+		assert.Equal(t, truncatedOutputPrefix+strings.Repeat("a", MaxStatusOutputLength-1), truncated)
+	})
+}
+
+func TestDeploymentStatusShapes(t *testing.T) {
+	status := newTestStatus()
+	status.StartCodeBlock(0, 0)
+	status.FinishCodeBlock(0, 0, "1\n", nil)
+
+	t.Run("The legacy shape only has the fields the portal knows", func(t *testing.T) {
+		legacy, err := status.AsJsonString()
+		assert.NoError(t, err)
+
+		var document map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(legacy), &document))
+		assert.NotContains(t, document, "schemaVersion")
+		assert.NotContains(t, document, "startedAt")
+		assert.Contains(t, document, "currentCodeBlock")
+
+		codeBlock := document["steps"].([]interface{})[0].(map[string]interface{})["codeblocks"].([]interface{})[0]
+		assert.Equal(
+			t,
+			map[string]interface{}{"description": "one", "command": "echo 1"},
+			codeBlock,
+		)
+	})
+
+	t.Run("The versioned shape has the state of each code block", func(t *testing.T) {
+		versioned, err := json.Marshal(status)
+		assert.NoError(t, err)
+
+		var document AzureDeploymentStatus
+		assert.NoError(t, json.Unmarshal(versioned, &document))
+		assert.Equal(t, StatusSchemaVersion, document.SchemaVersion)
+		assert.Equal(t, StateSucceeded, document.Steps[0].CodeBlocks[0].State)
+		assert.Equal(t, "1\n", document.Steps[0].CodeBlocks[0].Output)
+	})
+
+	t.Run("Snapshots don't change with the status", func(t *testing.T) {
+		snapshot := status.Snapshot()
+		status.StartCodeBlock(0, 1)
+
+		assert.Equal(t, StatePending, snapshot.Steps[0].CodeBlocks[1].State)
+		assert.Equal(t, StateRunning, status.Steps[0].CodeBlocks[1].State)
+	})
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"io"
+	"os"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/tracing"
+)
+
+// Starts emitting the events of a scenario. The events are written to stdout
+// when the event stream is enabled, and recorded either way so that they can
+// be added to the report.
+func (e *Engine) startEvents(scenario *common.Scenario) *common.EventLog {
+	var writer io.Writer
+	if e.Configuration.EventStream {
+		writer = os.Stdout
+	}
+
+	// The variables are compared against what the first code block sees, which
+	// includes the state left behind by the last command that was executed.
+	common.Events = common.NewEventLog(writer)
+	common.Events.ScenarioStarted(
+		scenario.Name,
+		len(scenario.Steps),
+		lib.MergeMaps(lib.GetEnvironmentVariables(), lib.GetCurrentEnvironment(scenario.Environment)),
+	)
+	return common.Events
+}
+
+// Stops emitting the events of the scenario.
+func stopEvents() {
+	common.Events = nil
+}
+
+// The modes that a scenario is traced in.
+const (
+	traceModeExecute     = "execute"
+	traceModeTest        = "test"
+	traceModeInteractive = "interactive"
+)
+
+// Starts the trace of a scenario, which does nothing unless the traces are
+// exported.
+func (e *Engine) startTrace(scenario *common.Scenario, mode string) {
+	prerequisites := make(map[string]string)
+	for _, prerequisite := range scenario.Prerequisites {
+		prerequisites[prerequisite.Source] = prerequisite.Title
+	}
+
+	common.Trace = tracing.StartScenario(
+		scenario.Name,
+		mode,
+		e.Configuration.CorrelationId,
+		prerequisites,
+	)
+}
+
+// Ends the trace of the scenario with the error that stopped it, if any.
+func stopTrace(err error) {
+	common.Trace.End(err)
+	common.Trace = nil
+}
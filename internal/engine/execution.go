@@ -24,6 +24,15 @@ const (
 	spinnerRefresh = 100 * time.Millisecond
 )
 
+// Replaces the contents of the line below a command that is being executed,
+// leaving the cursor on the line of the spinner.
+func renderBelowCommand(lines int, content string) {
+	if lines <= 0 {
+		return
+	}
+	fmt.Printf("\033[%dB\r\033[2K  %s\033[%dA\r", lines, content, lines)
+}
+
 // If a scenario has an `az group delete` command and the `--do-not-delete`
 // flag is set, we remove it from the steps.
 func filterDeletionCommands(steps []common.Step, preserveResources bool) []common.Step {
@@ -69,7 +78,10 @@ func renderCommand(blockContent string) (shells.CommandOutput, error) {
 }
 
 // Executes the steps from a scenario and renders the output to the terminal.
+// Nothing is rendered when the event stream is enabled, so that stdout only
+// holds the events of each code block.
 func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]string) error {
+	render := !e.Configuration.EventStream
 	var resourceGroupName string = ""
 	azureStatus := environments.NewAzureDeploymentStatus()
 
@@ -99,17 +111,26 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 	environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
 
 	for stepNumber, step := range stepsToExecute {
-		stepTitle := fmt.Sprintf("%d. %s\n", stepNumber+1, step.Name)
-		fmt.Println(ui.StepTitleStyle.Render(stepTitle))
-		azureStatus.CurrentStep = stepNumber + 1
+		if render {
+			stepTitle := fmt.Sprintf("%d. %s\n", stepNumber+1, step.Name)
+			fmt.Println(ui.StepTitleStyle.Render(stepTitle))
+		}
+
+		for codeBlockNumber, block := range step.CodeBlocks {
+			azureStatus.StartCodeBlock(stepNumber, codeBlockNumber)
+			environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
+			common.CodeBlockStarted(stepNumber, step.Name, codeBlockNumber, block)
 
-		for _, block := range step.CodeBlocks {
 			var finalCommandOutput string
-			if e.Configuration.RenderValues {
+			// Files are shown as they are written, their content isn't a
+			// command.
+			if render && e.Configuration.RenderValues && block.File == nil {
 				// Render the codeblock.
 				renderedCommand, err := renderCommand(block.Content)
 				if err != nil {
 					logging.GlobalLogger.Errorf("Failed to render command: %s", err.Error())
+					common.CodeBlockFinished(common.BlockResult{ExitCode: common.ExitCode(err), Error: err})
+					azureStatus.FinishCodeBlock(stepNumber, codeBlockNumber, "", err)
 					azureStatus.SetError(err)
 					environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
 					return err
@@ -119,7 +140,9 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 				finalCommandOutput = ui.IndentMultiLineCommand(block.Content, 4)
 			}
 
-			fmt.Print("    " + finalCommandOutput)
+			if render {
+				fmt.Print("    " + finalCommandOutput)
+			}
 
 			// execute the command as a goroutine to allow for the spinner to be
 			// rendered while the command is executing.
@@ -139,28 +162,44 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 			var commandErr error
 			var frame int = 0
 
+			// Progress of code blocks that are polled until they succeed.
+			waitProgress := make(chan string)
+			var waitResult common.WaitResult
+			showingWaitProgress := false
+
 			// If forwarding input/output, don't render the spinner.
 			if !interactiveCommand {
 				// Grab the number of lines it contains & set the cursor to the
 				// beginning of the block.
 
 				lines := strings.Count(finalCommandOutput, "\n")
-				terminal.MoveCursorPositionUp(lines)
+				if render {
+					terminal.MoveCursorPositionUp(lines)
 
-				// Render the spinner and hide the cursor.
-				fmt.Print(ui.SpinnerStyle.Render("  "+string(spinnerFrames[0])) + " ")
-				terminal.HideCursor()
+					// Render the spinner and hide the cursor.
+					fmt.Print(ui.SpinnerStyle.Render("  "+string(spinnerFrames[0])) + " ")
+					terminal.HideCursor()
+				}
 
 				go func(block parsers.CodeBlock) {
-					output, err := shells.ExecuteBashCommand(
-						block.Content,
-						shells.BashCommandConfiguration{
-							EnvironmentVariables: lib.CopyMap(env),
-							InheritEnvironment:   true,
-							InteractiveCommand:   false,
-							WriteToHistory:       true,
-						},
-					)
+					execute := func() (shells.CommandOutput, error) {
+						return common.ExecuteCodeBlock(block, lib.CopyMap(env))
+					}
+
+					var output shells.CommandOutput
+					var err error
+					if block.WaitUntil != nil {
+						output, waitResult, err = common.PollCodeBlock(
+							block,
+							execute,
+							env,
+							func(progress common.WaitProgressMessage) {
+								waitProgress <- progress.String()
+							},
+						)
+					} else {
+						output, err = execute()
+					}
 					logging.GlobalLogger.Infof("Command output to stdout:\n %s", output.StdOut)
 					logging.GlobalLogger.Infof("Command output to stderr:\n %s", output.StdErr)
 					commandOutput = output
@@ -170,28 +209,63 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 				// While the command is executing, render the spinner.
 				for {
 					select {
+					case progress := <-waitProgress:
+						if render {
+							renderBelowCommand(lines, ui.VerboseStyle.Render(progress))
+							showingWaitProgress = true
+						} else {
+							logging.GlobalLogger.Info(progress)
+						}
 					case commandErr = <-done:
 						// Show the cursor, check the result of the command, and display the
 						// final status.
-						terminal.ShowCursor()
+						if render {
+							terminal.ShowCursor()
+						}
 
-						if commandErr == nil {
+						if showingWaitProgress {
+							renderBelowCommand(lines, "")
+						}
 
-							actualOutput := commandOutput.StdOut
-							expectedOutput := block.ExpectedOutput.Content
-							expectedSimilarity := block.ExpectedOutput.ExpectedSimilarity
-							expectedRegex := block.ExpectedOutput.ExpectedRegex
-							expectedOutputLanguage := block.ExpectedOutput.Language
+						if block.WaitUntil != nil {
+							logging.GlobalLogger.Infof(
+								"Polled the command %d times over %.0f seconds",
+								waitResult.Polls,
+								waitResult.TotalWaitSeconds,
+							)
+						}
+
+						if commandErr == nil {
 
-							_, outputComparisonError := common.CompareCommandOutputs(actualOutput, expectedOutput, expectedSimilarity, expectedRegex, expectedOutputLanguage)
+							validation, outputComparisonError := common.ValidateCommandOutput(block, commandOutput, lib.GetCurrentEnvironment(env))
+							result := common.BlockResult{
+								StdOut:              commandOutput.StdOut,
+								StdErr:              commandOutput.StdErr,
+								SimilarityScore:     validation.Comparison.Score,
+								SimilarityAlgorithm: validation.Comparison.Algorithm,
+								Polls:               waitResult.Polls,
+							}
 
 							if outputComparisonError != nil {
+								outputComparisonError = common.CodeBlockError(block, outputComparisonError)
 								logging.GlobalLogger.Errorf("Error comparing command outputs: %s", outputComparisonError.Error())
-								fmt.Printf("\r  %s \n", ui.ErrorStyle.Render("✗"))
-								terminal.MoveCursorPositionDown(lines)
-								fmt.Printf("  %s\n", ui.ErrorMessageStyle.Render(outputComparisonError.Error()))
-								fmt.Printf("	%s\n", lib.GetDifferenceBetweenStrings(block.ExpectedOutput.Content, commandOutput.StdOut))
+								if render {
+									fmt.Printf("\r  %s \n", ui.ErrorStyle.Render("✗"))
+									terminal.MoveCursorPositionDown(lines)
+									fmt.Printf("  %s\n", ui.ErrorMessageStyle.Render(outputComparisonError.Error()))
+									fmt.Printf("	%s\n", lib.GetDifferenceBetweenStrings(block.ExpectedOutput.Content, commandOutput.StdOut))
+								}
+
+								result.Error = outputComparisonError
+								common.CodeBlockFinished(result)
+								common.Events.VariablesChanged(lib.GetCurrentEnvironment(env))
 
+								azureStatus.FinishCodeBlock(
+									stepNumber,
+									codeBlockNumber,
+									commandOutput.StdOut,
+									outputComparisonError,
+								)
 								azureStatus.SetError(outputComparisonError)
 								environments.AttachResourceURIsToAzureStatus(
 									&azureStatus,
@@ -203,10 +277,16 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 								return outputComparisonError
 							}
 
-							fmt.Printf("\r  %s \n", ui.CheckStyle.Render("✔"))
-							terminal.MoveCursorPositionDown(lines)
+							if render {
+								fmt.Printf("\r  %s \n", ui.CheckStyle.Render("✔"))
+								terminal.MoveCursorPositionDown(lines)
+
+								fmt.Printf("%s\n", ui.RemoveHorizontalAlign(ui.VerboseStyle.Render(commandOutput.StdOut)))
+							}
 
-							fmt.Printf("%s\n", ui.RemoveHorizontalAlign(ui.VerboseStyle.Render(commandOutput.StdOut)))
+							result.Success = true
+							common.CodeBlockFinished(result)
+							common.Events.VariablesChanged(lib.GetCurrentEnvironment(env))
 
 							// Extract the resource group name from the command output if
 							// it's not already set.
@@ -216,22 +296,40 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 								if tmpResourceGroup != "" {
 									logging.GlobalLogger.WithField("resourceGroup", tmpResourceGroup).Info("Found resource group")
 									resourceGroupName = tmpResourceGroup
+									common.Trace.SetResourceGroup(resourceGroupName)
 									azureStatus.AddResourceURI(az.BuildResourceGroupId(e.Configuration.Subscription, resourceGroupName))
 								}
 							}
 
-							if stepNumber != len(stepsToExecute)-1 {
-								environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
-							}
+							azureStatus.FinishCodeBlock(stepNumber, codeBlockNumber, commandOutput.StdOut, nil)
+							environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
 
 						} else {
-							terminal.ShowCursor()
-							fmt.Printf("\r  %s \n", ui.ErrorStyle.Render("✗"))
-							terminal.MoveCursorPositionDown(lines)
-							fmt.Printf("  %s\n", ui.ErrorMessageStyle.Render(commandErr.Error()))
+							exitCode := common.ExitCode(commandErr)
+							commandErr = common.CodeBlockError(block, commandErr)
+							common.CodeBlockFinished(common.BlockResult{
+								StdOut:   commandOutput.StdOut,
+								StdErr:   commandOutput.StdErr,
+								ExitCode: exitCode,
+								Polls:    waitResult.Polls,
+								Error:    commandErr,
+							})
+							common.Events.VariablesChanged(lib.GetCurrentEnvironment(env))
+							if render {
+								terminal.ShowCursor()
+								fmt.Printf("\r  %s \n", ui.ErrorStyle.Render("✗"))
+								terminal.MoveCursorPositionDown(lines)
+								fmt.Printf("  %s\n", ui.ErrorMessageStyle.Render(commandErr.Error()))
+							}
 
 							logging.GlobalLogger.Errorf("Error executing command: %s", commandErr.Error())
 
+							azureStatus.FinishCodeBlock(
+								stepNumber,
+								codeBlockNumber,
+								commandOutput.StdOut+commandOutput.StdErr,
+								commandErr,
+							)
 							azureStatus.SetError(commandErr)
 							environments.AttachResourceURIsToAzureStatus(
 								&azureStatus,
@@ -245,8 +343,10 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 
 						break renderingLoop
 					default:
-						frame = (frame + 1) % len(spinnerFrames)
-						fmt.Printf("\r  %s", ui.SpinnerStyle.Render(string(spinnerFrames[frame])))
+						if render {
+							frame = (frame + 1) % len(spinnerFrames)
+							fmt.Printf("\r  %s", ui.SpinnerStyle.Render(string(spinnerFrames[frame])))
+						}
 						time.Sleep(spinnerRefresh)
 					}
 				}
@@ -257,7 +357,7 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 				// to report the status before executing the command. This is needed for
 				// one click deployments and does not affect the normal execution flow.
 				if stepNumber == len(stepsToExecute)-1 && patterns.SshCommand.MatchString(block.Content) {
-					azureStatus.Status = "Succeeded"
+					azureStatus.SetSucceeded()
 					environments.AttachResourceURIsToAzureStatus(&azureStatus, resourceGroupName, e.Configuration.Environment)
 					environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
 				}
@@ -272,22 +372,42 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 					},
 				)
 
-				terminal.ShowCursor()
+				if render {
+					terminal.ShowCursor()
+				}
 
 				if commandExecutionError == nil {
-					fmt.Printf("\r  %s \n", ui.CheckStyle.Render("✔"))
-					terminal.MoveCursorPositionDown(lines)
-
-					fmt.Printf("  %s\n", ui.VerboseStyle.Render(output.StdOut))
+					if render {
+						fmt.Printf("\r  %s \n", ui.CheckStyle.Render("✔"))
+						terminal.MoveCursorPositionDown(lines)
 
-					if stepNumber != len(stepsToExecute)-1 {
-						environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
+						fmt.Printf("  %s\n", ui.VerboseStyle.Render(output.StdOut))
 					}
+
+					common.CodeBlockFinished(common.BlockResult{Success: true})
+					common.Events.VariablesChanged(lib.GetCurrentEnvironment(env))
+					azureStatus.FinishCodeBlock(stepNumber, codeBlockNumber, output.StdOut, nil)
+					environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
 				} else {
-					fmt.Printf("\r  %s \n", ui.ErrorStyle.Render("✗"))
-					terminal.MoveCursorPositionDown(lines)
-					fmt.Printf("  %s\n", ui.ErrorMessageStyle.Render(commandExecutionError.Error()))
+					exitCode := common.ExitCode(commandExecutionError)
+					commandExecutionError = common.CodeBlockError(block, commandExecutionError)
+					common.CodeBlockFinished(common.BlockResult{
+						ExitCode: exitCode,
+						Error:    commandExecutionError,
+					})
+					common.Events.VariablesChanged(lib.GetCurrentEnvironment(env))
+					if render {
+						fmt.Printf("\r  %s \n", ui.ErrorStyle.Render("✗"))
+						terminal.MoveCursorPositionDown(lines)
+						fmt.Printf("  %s\n", ui.ErrorMessageStyle.Render(commandExecutionError.Error()))
+					}
 
+					azureStatus.FinishCodeBlock(
+						stepNumber,
+						codeBlockNumber,
+						output.StdOut+output.StdErr,
+						commandExecutionError,
+					)
 					azureStatus.SetError(commandExecutionError)
 					environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
 					return commandExecutionError
@@ -297,7 +417,7 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 	}
 
 	// Report the final status of the deployment (Only applies to one click deployments).
-	azureStatus.Status = "Succeeded"
+	azureStatus.SetSucceeded()
 	environments.AttachResourceURIsToAzureStatus(
 		&azureStatus,
 		resourceGroupName,
@@ -305,6 +425,14 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 	)
 	environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
 
+	return e.cleanStateFiles()
+}
+
+// Cleans up the files that share state between code blocks once the steps
+// have been executed. The portal downloads the environment variables
+// afterwards, so they are only cleaned rather than deleted in the azure
+// environments.
+func (e *Engine) cleanStateFiles() error {
 	switch e.Configuration.Environment {
 	case environments.EnvironmentsAzure, environments.EnvironmentsOCD:
 		logging.GlobalLogger.Info(
@@ -3,6 +3,8 @@ package engine
 import (
 	"testing"
 
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/parsers"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -22,3 +24,38 @@ func TestExecuteBlock(t *testing.T) {
 	}
 
 }
+
+func TestExecuteScenarioPreflight(t *testing.T) {
+	scenario := &common.Scenario{
+		Name: "Preflight",
+		Steps: []common.Step{
+			{
+				Name: "Broken",
+				CodeBlocks: []parsers.CodeBlock{
+					{
+						Language: "bash",
+						Content:  "if true; then\n  echo unterminated\n",
+						Position: parsers.SourcePosition{File: "preflight.md", StartLine: 3},
+					},
+				},
+			},
+		},
+	}
+
+	t.Run("Syntax errors stop the scenario before it runs", func(t *testing.T) {
+		engine, err := NewEngine(EngineConfiguration{Preflight: true, WorkingDirectory: t.TempDir()})
+		assert.NoError(t, err)
+
+		err = engine.ExecuteScenario(scenario)
+		assert.ErrorContains(t, err, "the scenario was not executed because of syntax errors")
+	})
+
+	t.Run("The syntax check can be skipped", func(t *testing.T) {
+		engine, err := NewEngine(EngineConfiguration{Preflight: false, WorkingDirectory: t.TempDir()})
+		assert.NoError(t, err)
+
+		err = engine.ExecuteScenario(scenario)
+		assert.Error(t, err)
+		assert.NotContains(t, err.Error(), "syntax errors")
+	})
+}
@@ -178,13 +178,20 @@ func handleUserInput(
 		codeBlock := codeBlockState.CodeBlock
 
 		model.executingCommand = true
+		model.azureStatus.StartCodeBlock(codeBlockState.StepNumber, codeBlockState.CodeBlockNumber)
+		common.CodeBlockStarted(
+			codeBlockState.StepNumber,
+			codeBlockState.StepName,
+			codeBlockState.CodeBlockNumber,
+			codeBlock,
+		)
 
 		// If we're on the last step and the command is an SSH command, we need
 		// to report the status before executing the command. This is needed for
 		// one click deployments and does not affect the normal execution flow.
 		if model.currentCodeBlock == len(model.codeBlockState)-1 &&
 			patterns.SshCommand.MatchString(codeBlock.Content) {
-			model.azureStatus.Status = "Succeeded"
+			model.azureStatus.SetSucceeded()
 			environments.AttachResourceURIsToAzureStatus(
 				&model.azureStatus,
 				model.resourceGroupName,
@@ -212,9 +219,12 @@ func handleUserInput(
 				}))
 
 		} else {
-			commands = append(commands, common.ExecuteCodeBlockAsync(
-				codeBlock,
-				lib.CopyMap(model.env),
+			commands = append(commands, tea.Sequence(
+				common.UpdateAzureStatus(model.azureStatus, model.environment),
+				common.ExecuteCodeBlockAsync(
+					codeBlock,
+					lib.CopyMap(model.env),
+				),
 			))
 		}
 
@@ -310,7 +320,25 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		codeBlockState.StdOut = message.StdOut
 		codeBlockState.StdErr = message.StdErr
 		codeBlockState.Success = true
+		codeBlockState.SimilarityScore = message.SimilarityScore
+		codeBlockState.SimilarityAlgorithm = message.SimilarityAlgorithm
+		codeBlockState.AssertionResults = message.AssertionResults
+		codeBlockState.Wait = message.Wait
 		model.codeBlockState[step] = codeBlockState
+		model.azureStatus.FinishCodeBlock(
+			codeBlockState.StepNumber,
+			codeBlockState.CodeBlockNumber,
+			codeBlockState.StdOut,
+			nil,
+		)
+		common.CodeBlockFinished(common.BlockResult{
+			StdOut:              message.StdOut,
+			StdErr:              message.StdErr,
+			Success:             true,
+			SimilarityScore:     message.SimilarityScore,
+			SimilarityAlgorithm: message.SimilarityAlgorithm,
+			Polls:               message.Wait.GetPolls(),
+		})
 
 		logging.GlobalLogger.Infof("Finished executing:\n %s", codeBlockState.CodeBlock.Content)
 
@@ -322,6 +350,7 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 			if tmpResourceGroup != "" {
 				logging.GlobalLogger.Infof("Found resource group named: %s", tmpResourceGroup)
 				model.resourceGroupName = tmpResourceGroup
+				common.Trace.SetResourceGroup(tmpResourceGroup)
 				model.azureStatus.AddResourceURI(az.BuildResourceGroupId(model.subscription, model.resourceGroupName))
 			}
 		}
@@ -337,25 +366,13 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 			model.CommandLines = append(model.CommandLines, ui.CommandPrompt(nextLanguage)+nextCommand)
 		}
 
-		// Only increment the step for azure if the step name has changed.
-		nextCodeBlockState := model.codeBlockState[model.currentCodeBlock]
-
-		if codeBlockState.StepName != nextCodeBlockState.StepName {
-			logging.GlobalLogger.Debugf("Step name has changed, incrementing step & resetting codeblock count for Azure")
-			model.azureStatus.CurrentStep++
-			model.azureStatus.CurrentCodeBlock = 0
-		} else {
-			logging.GlobalLogger.Debugf("Step name has not changed, incrementing codeblock count for azure.")
-			model.azureStatus.CurrentCodeBlock++
-		}
-
 		model.stepsToBeExecuted--
 
 		// If the scenario has been completed, we need to update the azure
 		// status and quit the program.
 		if model.currentCodeBlock == len(model.codeBlockState) {
 			model.scenarioCompleted = true
-			model.azureStatus.Status = "Succeeded"
+			model.azureStatus.SetSucceeded()
 			environments.AttachResourceURIsToAzureStatus(
 				&model.azureStatus,
 				model.resourceGroupName,
@@ -397,6 +414,10 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 			)
 		}
 
+	case common.WaitProgressMessage:
+		// Show the progress of code blocks that are polled until they succeed.
+		model.CommandLines = append(model.CommandLines, ui.VerboseStyle.Render(message.String()))
+
 	case common.FailedCommandMessage:
 		// Handle failed command executions
 
@@ -406,9 +427,25 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		codeBlockState.StdOut = message.StdOut
 		codeBlockState.StdErr = message.StdErr
 		codeBlockState.Success = false
+		codeBlockState.Wait = message.Wait
 
 		model.codeBlockState[step] = codeBlockState
 		model.CommandLines = append(model.CommandLines, codeBlockState.StdErr)
+		model.azureStatus.FinishCodeBlock(
+			codeBlockState.StepNumber,
+			codeBlockState.CodeBlockNumber,
+			codeBlockState.StdOut+codeBlockState.StdErr,
+			message.Error,
+		)
+		common.CodeBlockFinished(common.BlockResult{
+			StdOut:              message.StdOut,
+			StdErr:              message.StdErr,
+			ExitCode:            message.ExitCode,
+			SimilarityScore:     message.SimilarityScore,
+			SimilarityAlgorithm: message.SimilarityAlgorithm,
+			Polls:               message.Wait.GetPolls(),
+			Error:               message.Error,
+		})
 
 		// Report the error
 		model.executingCommand = false
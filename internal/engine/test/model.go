@@ -6,6 +6,7 @@ import (
 
 	"github.com/Azure/InnovationEngine/internal/az"
 	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/engine/environments"
 	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
 	"github.com/Azure/InnovationEngine/internal/patterns"
@@ -23,6 +24,9 @@ type TestModeCommands struct {
 
 // The state required for testing scenarios.
 type TestModeModel struct {
+	// The status is shared by every copy of the model, so that the changes
+	// made while it is initialized aren't lost.
+	azureStatus          *environments.AzureDeploymentStatus
 	codeBlockState       map[int]common.StatefulCodeBlock
 	commands             TestModeCommands
 	currentCodeBlock     int
@@ -30,6 +34,7 @@ type TestModeModel struct {
 	environment          string
 	help                 help.Model
 	resourceGroupName    string
+	subscription         string
 	scenarioTitle        string
 	scenarioCompleted    bool
 	components           testModeComponents
@@ -54,6 +59,17 @@ func (model TestModeModel) GetFailure() error {
 	)
 }
 
+// Obtains the code block that the scenario failed on. If the scenario was
+// completed successfully, then it returns nil.
+func (model TestModeModel) GetFailedCodeBlock() *common.StatefulCodeBlock {
+	if model.scenarioCompleted {
+		return nil
+	}
+
+	failedCodeBlock := model.codeBlockState[model.currentCodeBlock]
+	return &failedCodeBlock
+}
+
 func (model TestModeModel) GetScenarioTitle() string {
 	return model.scenarioTitle
 }
@@ -65,9 +81,10 @@ func (model TestModeModel) GetEnvironment() string {
 
 // Get the code blocks that were executed in the scenario.
 func (model TestModeModel) GetCodeBlocks() []common.StatefulCodeBlock {
+	// The states are keyed by the order the code blocks are executed in.
 	var codeBlocks []common.StatefulCodeBlock
-	for _, codeBlock := range model.codeBlockState {
-		codeBlocks = append(codeBlocks, codeBlock)
+	for index := 0; index < len(model.codeBlockState); index++ {
+		codeBlocks = append(codeBlocks, model.codeBlockState[index])
 	}
 	return codeBlocks
 }
@@ -80,8 +97,29 @@ func (model TestModeModel) GetDeclaredEnvironmentVariables() map[string]string {
 	return model.environmentVariables
 }
 
+// Marks the current code block as running, reports the status and emits its
+// events.
+func (model TestModeModel) startCodeBlock() {
+	codeBlockState := model.codeBlockState[model.currentCodeBlock]
+	model.azureStatus.StartCodeBlock(codeBlockState.StepNumber, codeBlockState.CodeBlockNumber)
+	environments.ReportAzureStatus(*model.azureStatus, model.environment)
+	common.CodeBlockStarted(
+		codeBlockState.StepNumber,
+		codeBlockState.StepName,
+		codeBlockState.CodeBlockNumber,
+		codeBlockState.CodeBlock,
+	)
+}
+
+// Emits the events of the code block that finished executing.
+func (model TestModeModel) finishCodeBlock(result common.BlockResult) {
+	common.CodeBlockFinished(result)
+	common.Events.VariablesChanged(lib.GetCurrentEnvironment(model.environmentVariables))
+}
+
 // Init the test mode model by executing the first code block.
 func (model TestModeModel) Init() tea.Cmd {
+	model.startCodeBlock()
 	return common.ExecuteCodeBlockAsync(
 		model.codeBlockState[model.currentCodeBlock].CodeBlock,
 		model.environmentVariables,
@@ -118,7 +156,24 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		codeBlockState.StdErr = message.StdErr
 		codeBlockState.Success = true
 		codeBlockState.SimilarityScore = message.SimilarityScore
+		codeBlockState.SimilarityAlgorithm = message.SimilarityAlgorithm
+		codeBlockState.AssertionResults = message.AssertionResults
+		codeBlockState.Wait = message.Wait
 		model.codeBlockState[step] = codeBlockState
+		model.azureStatus.FinishCodeBlock(
+			codeBlockState.StepNumber,
+			codeBlockState.CodeBlockNumber,
+			codeBlockState.StdOut,
+			nil,
+		)
+		model.finishCodeBlock(common.BlockResult{
+			StdOut:              message.StdOut,
+			StdErr:              message.StdErr,
+			Success:             true,
+			SimilarityScore:     message.SimilarityScore,
+			SimilarityAlgorithm: message.SimilarityAlgorithm,
+			Polls:               message.Wait.GetPolls(),
+		})
 
 		logging.GlobalLogger.Infof("Finished executing:\n %s", codeBlockState.CodeBlock.Content)
 
@@ -130,6 +185,8 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 			if tmpResourceGroup != "" {
 				logging.GlobalLogger.Infof("Found resource group named: %s", tmpResourceGroup)
 				model.resourceGroupName = tmpResourceGroup
+				common.Trace.SetResourceGroup(tmpResourceGroup)
+				model.azureStatus.AddResourceURI(az.BuildResourceGroupId(model.subscription, model.resourceGroupName))
 			}
 		}
 		model.CommandLines = append(
@@ -169,6 +226,8 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		// status and quit the program. else,
 		if model.currentCodeBlock == len(model.codeBlockState) {
 			logging.GlobalLogger.Infof("The last codeblock was executed. Requesting to exit test mode...")
+			model.azureStatus.SetSucceeded()
+			environments.ReportAzureStatus(*model.azureStatus, model.environment)
 			commands = append(
 				commands,
 				common.Exit(false),
@@ -176,12 +235,19 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 
 		} else {
 			// If the scenario has not been completed, we need to execute the next command
+			environments.ReportAzureStatus(*model.azureStatus, model.environment)
+			model.startCodeBlock()
 			commands = append(
 				commands,
 				common.ExecuteCodeBlockAsync(nextCodeBlockState.CodeBlock, model.environmentVariables),
 			)
 		}
 
+	case common.WaitProgressMessage:
+		// Show the progress of code blocks that are polled until they succeed.
+		model.CommandLines = append(model.CommandLines, ui.VerboseStyle.Render(message.String()))
+		viewportContentUpdated = true
+
 	case common.FailedCommandMessage:
 		// Handle failed command executions
 
@@ -193,6 +259,9 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		codeBlockState.Error = message.Error
 		codeBlockState.Success = false
 		codeBlockState.SimilarityScore = message.SimilarityScore
+		codeBlockState.SimilarityAlgorithm = message.SimilarityAlgorithm
+		codeBlockState.AssertionResults = message.AssertionResults
+		codeBlockState.Wait = message.Wait
 
 		model.codeBlockState[step] = codeBlockState
 		model.CommandLines = append(
@@ -201,6 +270,24 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		)
 		viewportContentUpdated = true
 
+		model.azureStatus.FinishCodeBlock(
+			codeBlockState.StepNumber,
+			codeBlockState.CodeBlockNumber,
+			codeBlockState.StdOut+codeBlockState.StdErr,
+			message.Error,
+		)
+		model.azureStatus.SetError(message.Error)
+		environments.ReportAzureStatus(*model.azureStatus, model.environment)
+		model.finishCodeBlock(common.BlockResult{
+			StdOut:              message.StdOut,
+			StdErr:              message.StdErr,
+			ExitCode:            message.ExitCode,
+			SimilarityScore:     message.SimilarityScore,
+			SimilarityAlgorithm: message.SimilarityAlgorithm,
+			Polls:               message.Wait.GetPolls(),
+			Error:               message.Error,
+		})
+
 		commands = append(commands, common.Exit(true))
 
 	case common.ExitMessage:
@@ -217,6 +304,7 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 			)
 			logging.GlobalLogger.Infof("Attempting to delete the deployed resource group with the name: %s", model.resourceGroupName)
 			command := fmt.Sprintf("az group delete --name %s --yes --no-wait", model.resourceGroupName)
+			finishCleanup := common.Trace.StartCleanup("Delete resource group")
 			_, err := shells.ExecuteBashCommand(
 				command,
 				shells.BashCommandConfiguration{
@@ -226,6 +314,7 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 					WriteToHistory:       true,
 				},
 			)
+			finishCleanup(err)
 			if err != nil {
 				model.CommandLines = append(model.CommandLines, ui.ErrorStyle.Render("Error deleting resource group: %s\n", err.Error()))
 				logging.GlobalLogger.Errorf("Error deleting resource group: %s", err.Error())
@@ -271,12 +360,15 @@ func NewTestModeModel(
 	steps []common.Step,
 	env map[string]string,
 ) (TestModeModel, error) {
+	azureStatus := environments.NewAzureDeploymentStatus()
 	totalCodeBlocks := 0
 	codeBlockState := make(map[int]common.StatefulCodeBlock)
 
 	err := az.SetSubscription(subscription)
 	if err != nil {
 		logging.GlobalLogger.Errorf("Invalid Config: Failed to set subscription: %s", err)
+		azureStatus.SetError(err)
+		environments.ReportAzureStatus(azureStatus, environment)
 		return TestModeModel{}, err
 	}
 
@@ -288,7 +380,12 @@ func NewTestModeModel(
 	// TODO(vmarcella): The codeblock state building should be reused across
 	// Interactive mode and test mode in the future.
 	for stepNumber, step := range steps {
+		azureCodeBlocks := []environments.AzureCodeBlock{}
 		for blockNumber, block := range step.CodeBlocks {
+			azureCodeBlocks = append(azureCodeBlocks, environments.AzureCodeBlock{
+				Command:     block.Content,
+				Description: block.Description,
+			})
 
 			codeBlockState[totalCodeBlocks] = common.StatefulCodeBlock{
 				StepName:        step.Name,
@@ -303,6 +400,7 @@ func NewTestModeModel(
 
 			totalCodeBlocks += 1
 		}
+		azureStatus.AddStep(fmt.Sprintf("%d. %s", stepNumber+1, step.Name), azureCodeBlocks)
 	}
 
 	language := codeBlockState[0].CodeBlock.Language
@@ -320,8 +418,10 @@ func NewTestModeModel(
 				key.WithHelp("q", "Quit the scenario."),
 			),
 		},
+		azureStatus:          &azureStatus,
 		environmentVariables: env,
 		resourceGroupName:    "",
+		subscription:         subscription,
 		codeBlockState:       codeBlockState,
 		currentCodeBlock:     0,
 		help:                 help.New(),
@@ -1,9 +1,11 @@
 package test
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/engine/environments"
 	"github.com/Azure/InnovationEngine/internal/parsers"
 	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/stretchr/testify/assert"
@@ -224,4 +226,120 @@ func TestTestModeModel(t *testing.T) {
 			}
 		},
 	)
+
+	t.Run("The failed code block keeps its position", func(t *testing.T) {
+		position := parsers.SourcePosition{File: "doc.md", StartLine: 5, EndLine: 7}
+		steps := []common.Step{
+			{
+				Name: "step1",
+				CodeBlocks: []parsers.CodeBlock{
+					{Content: "exit 1", Language: "bash", Position: position},
+				},
+			},
+		}
+
+		model, err := NewTestModeModel("test", "", "test", steps, nil)
+		assert.NoError(t, err)
+
+		m, _ := model.Update(common.FailedCommandMessage{Error: fmt.Errorf("exit status 1")})
+		m, _ = m.Update(common.Exit(true)())
+		model, ok := m.(TestModeModel)
+		if !assert.True(t, ok) {
+			return
+		}
+
+		failed := model.GetFailedCodeBlock()
+		if assert.NotNil(t, failed) {
+			assert.Equal(t, position, failed.CodeBlock.Position)
+		}
+
+		report := common.BuildReport("test")
+		report.WithFailedCodeBlock(failed)
+		assert.Equal(t, &position, report.FailedAt)
+		assert.Equal(t, 0, report.FailedAtStep)
+	})
+}
+
+func TestTestModeStatus(t *testing.T) {
+	steps := []common.Step{
+		{
+			Name: "step1",
+			CodeBlocks: []parsers.CodeBlock{
+				{Content: "echo 1", Language: "bash"},
+				{Content: "exit 1", Language: "bash"},
+			},
+		},
+		{
+			Name: "step2",
+			CodeBlocks: []parsers.CodeBlock{
+				{Content: "echo 3", Language: "bash"},
+			},
+		},
+	}
+
+	model, err := NewTestModeModel("test", "", "test", steps, nil)
+	assert.NoError(t, err)
+	model.Init()
+
+	m, _ := model.Update(common.SuccessfulCommandMessage{StdOut: "1\n"})
+	m, _ = m.Update(common.FailedCommandMessage{Error: fmt.Errorf("exit status 1")})
+	model, ok := m.(TestModeModel)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	status := model.azureStatus
+	assert.Equal(t, "Failed", status.Status)
+	assert.Equal(t, environments.StateSucceeded, status.Steps[0].CodeBlocks[0].State)
+	assert.Equal(t, "1\n", status.Steps[0].CodeBlocks[0].Output)
+	assert.Equal(t, environments.StateFailed, status.Steps[0].CodeBlocks[1].State)
+	assert.Equal(t, "exit status 1", status.Steps[0].CodeBlocks[1].Error)
+	assert.Equal(t, environments.StateSkipped, status.Steps[1].State)
+	assert.Equal(t, 1, status.CurrentCodeBlock)
+}
+
+func TestTestModeEvents(t *testing.T) {
+	steps := []common.Step{
+		{
+			Name: "step1",
+			CodeBlocks: []parsers.CodeBlock{
+				{Content: "echo 1", Language: "bash"},
+				{Content: "exit 1", Language: "bash"},
+			},
+		},
+	}
+
+	common.Events = common.NewEventLog(nil)
+	defer func() { common.Events = nil }()
+
+	model, err := NewTestModeModel("test", "", "test", steps, nil)
+	assert.NoError(t, err)
+	model.Init()
+
+	m, _ := model.Update(common.SuccessfulCommandMessage{StdOut: "1\n", SimilarityScore: 1})
+	m.Update(common.FailedCommandMessage{Error: fmt.Errorf("exit status 1"), ExitCode: 1})
+
+	var types []common.EventType
+	var finished []common.Event
+	for _, event := range common.Events.Recorded() {
+		if event.Type == common.EventVariableChanged {
+			continue
+		}
+		types = append(types, event.Type)
+		if event.Type == common.EventBlockFinished {
+			finished = append(finished, event)
+		}
+	}
+
+	assert.Equal(t, []common.EventType{
+		common.EventStepStarted,
+		common.EventBlockStarted,
+		common.EventBlockFinished,
+		common.EventBlockStarted,
+		common.EventBlockFinished,
+	}, types)
+	assert.True(t, *finished[0].Success)
+	assert.Equal(t, 1.0, *finished[0].SimilarityScore)
+	assert.False(t, *finished[1].Success)
+	assert.Equal(t, 1, *finished[1].ExitCode)
 }
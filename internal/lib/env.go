@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/Azure/InnovationEngine/internal/lib/fs"
@@ -28,6 +29,11 @@ func GetEnvironmentVariables() map[string]string {
 var DefaultEnvironmentStateFile = "/tmp/env-vars"
 var DefaultWorkingDirectoryStateFile = "/tmp/working-dir"
 
+// The environment variable that carries the trace context to the commands of
+// a code block. It is set for each code block rather than shared between
+// them, so it is left out of the environment state.
+const TraceparentVariable = "TRACEPARENT"
+
 // Loads a file that contains environment variables
 func LoadEnvironmentStateFile(path string) (map[string]string, error) {
 	if !fs.FileExists(path) {
@@ -56,9 +62,23 @@ func LoadEnvironmentStateFile(path string) (map[string]string, error) {
 			env[parts[0]] = value
 		}
 	}
+
+	delete(env, TraceparentVariable)
 	return env, nil
 }
 
+// Gets the environment variables that were visible to the most recently
+// executed command by layering the environment state file on top of the
+// provided variables.
+func GetCurrentEnvironment(environmentVariables map[string]string) map[string]string {
+	envFromPreviousStep, err := LoadEnvironmentStateFile(DefaultEnvironmentStateFile)
+	if err != nil {
+		return CopyMap(environmentVariables)
+	}
+
+	return MergeMaps(environmentVariables, envFromPreviousStep)
+}
+
 func CleanEnvironmentStateFile(path string) error {
 	env, err := LoadEnvironmentStateFile(path)
 	if err != nil {
@@ -94,6 +114,23 @@ func filterInvalidKeys(envMap map[string]string) map[string]string {
 	return validEnvMap
 }
 
+// Writes environment variables to a file in the same format as `env`, so that
+// they are loaded before the next command is executed.
+func WriteEnvironmentStateFile(path string, env map[string]string) error {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var content strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&content, "%s=%s\n", key, env[key])
+	}
+
+	return os.WriteFile(path, []byte(content.String()), 0644)
+}
+
 // Deletes the stored environment variables file.
 func DeleteEnvironmentStateFile(path string) error {
 	return os.Remove(path)
@@ -2,18 +2,23 @@ package lib
 
 import (
 	"encoding/json"
-
-	"github.com/xrash/smetrics"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 )
 
+// Orders the fields of a JSON document alphabetically by unmarshalling and
+// re-marshalling it. Works with any JSON value, including top-level arrays.
 func OrderJsonFields(jsonStr string) (string, error) {
-	expectedMap := make(map[string]interface{})
-	err := json.Unmarshal([]byte(jsonStr), &expectedMap)
+	var expected interface{}
+	err := json.Unmarshal([]byte(jsonStr), &expected)
 	if err != nil {
 		return "", err
 	}
 
-	orderedJson, err := json.Marshal(expectedMap)
+	orderedJson, err := json.Marshal(expected)
 	if err != nil {
 		return "", err
 	}
@@ -23,30 +28,613 @@ func OrderJsonFields(jsonStr string) (string, error) {
 type ComparisonResult struct {
 	AboveThreshold bool
 	Score          float64
+	Differences    []StructuralDifference
+}
+
+// Options used to configure how two structured documents (JSON or YAML) are
+// compared.
+type StructuralComparisonOptions struct {
+	// JSONPath-style expressions for fields that should be excluded from the
+	// comparison. Supported syntax: `$.a.b`, `$.a[0]`, `$.a[*].b`, `$.a.*` and
+	// recursive descent `$..b`.
+	IgnorePaths []string
+	// When true, the order of elements within arrays is not taken into account.
+	UnorderedArrays bool
+	// When set, expected string values containing placeholder tokens such as
+	// `<GUID>` are matched against the actual values instead of compared for
+	// equality.
+	Placeholders *Placeholders
+}
+
+// A single difference found when comparing two structured documents.
+type StructuralDifference struct {
+	Path     string      `json:"path"`
+	Expected interface{} `json:"expected"`
+	Actual   interface{} `json:"actual"`
+}
+
+// Renders a difference as `path: expected <x>, got <y>`.
+func (difference StructuralDifference) String() string {
+	return fmt.Sprintf(
+		"%s: expected %s, got %s",
+		difference.Path,
+		renderStructuralValue(difference.Expected),
+		renderStructuralValue(difference.Actual),
+	)
+}
+
+// Renders a list of differences with one path per line.
+func FormatStructuralDifferences(differences []StructuralDifference) string {
+	var lines []string
+	for _, difference := range differences {
+		lines = append(lines, "  "+difference.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Marker used for values that don't exist on one side of a comparison.
+type missingValue struct{}
+
+func renderStructuralValue(value interface{}) string {
+	if _, ok := value.(missingValue); ok {
+		return "<missing>"
+	}
+
+	rendered, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(rendered)
 }
 
-// Compare two JSON strings by ordering the fields alphabetically and then
-// comparing the strings using the Jaro-Winkler algorithm to compute a score.
-// If the score is greater than the threshold, return true.
+// Compare two JSON strings structurally. Each leaf value of both documents is
+// compared by its path, and the score is the ratio of matching leaves to the
+// total number of leaves. If the score is greater than or equal to the
+// threshold, the result is marked as above the threshold.
 func CompareJsonStrings(
 	actualJson string,
 	expectedJson string,
 	threshold float64,
+	options StructuralComparisonOptions,
 ) (ComparisonResult, error) {
-	actualOutput, err := OrderJsonFields(actualJson)
-	if err != nil {
-		return ComparisonResult{}, err
+	var actual, expected interface{}
+
+	if err := json.Unmarshal([]byte(actualJson), &actual); err != nil {
+		return ComparisonResult{}, fmt.Errorf("failed to parse the actual output as JSON: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(expectedJson), &expected); err != nil {
+		return ComparisonResult{}, fmt.Errorf("failed to parse the expected output as JSON: %w", err)
 	}
 
-	expectedOutput, err := OrderJsonFields(expectedJson)
+	return CompareStructuredValues(actual, expected, threshold, options)
+}
+
+// Compare two already decoded documents structurally. Values are expected to
+// be composed of maps with string keys, slices and scalars, like the ones
+// produced by encoding/json.
+func CompareStructuredValues(
+	actual interface{},
+	expected interface{},
+	threshold float64,
+	options StructuralComparisonOptions,
+) (ComparisonResult, error) {
+	ignoredPaths, err := compileJsonPaths(options.IgnorePaths)
 	if err != nil {
 		return ComparisonResult{}, err
 	}
 
-	score := smetrics.Jaro(actualOutput, expectedOutput)
+	comparer := structuralComparer{
+		ignoredPaths:    ignoredPaths,
+		unorderedArrays: options.UnorderedArrays,
+		placeholders:    options.Placeholders,
+	}
+
+	matched, total, differences := comparer.compare(expected, actual, nil)
+
+	score := 1.0
+	if total > 0 {
+		score = float64(matched) / float64(total)
+	}
 
 	return ComparisonResult{
 		AboveThreshold: score >= threshold,
 		Score:          score,
+		Differences:    differences,
 	}, nil
 }
+
+// A single segment of a path within a structured document. Either a key of an
+// object or an index within an array.
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func renderPath(path []pathSegment) string {
+	var builder strings.Builder
+	builder.WriteString("$")
+	for _, segment := range path {
+		if segment.isIndex {
+			builder.WriteString(fmt.Sprintf("[%d]", segment.index))
+		} else {
+			builder.WriteString("." + segment.key)
+		}
+	}
+	return builder.String()
+}
+
+func appendPath(path []pathSegment, segment pathSegment) []pathSegment {
+	newPath := make([]pathSegment, len(path), len(path)+1)
+	copy(newPath, path)
+	return append(newPath, segment)
+}
+
+type structuralComparer struct {
+	ignoredPaths    []jsonPath
+	unorderedArrays bool
+	placeholders    *Placeholders
+}
+
+func (comparer structuralComparer) isIgnored(path []pathSegment) bool {
+	for _, ignored := range comparer.ignoredPaths {
+		if ignored.matches(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compares the expected and actual values at the given path. Returns the
+// number of matching leaves, the total number of leaves and the differences
+// that were found.
+func (comparer structuralComparer) compare(
+	expected interface{},
+	actual interface{},
+	path []pathSegment,
+) (int, int, []StructuralDifference) {
+	if comparer.isIgnored(path) {
+		return 0, 0, nil
+	}
+
+	switch expectedValue := expected.(type) {
+	case map[string]interface{}:
+		actualValue, ok := actual.(map[string]interface{})
+		if !ok {
+			return 0, countLeaves(expected), []StructuralDifference{
+				{Path: renderPath(path), Expected: expected, Actual: actual},
+			}
+		}
+		return comparer.compareObjects(expectedValue, actualValue, path)
+	case []interface{}:
+		actualValue, ok := actual.([]interface{})
+		if !ok {
+			return 0, countLeaves(expected), []StructuralDifference{
+				{Path: renderPath(path), Expected: expected, Actual: actual},
+			}
+		}
+		if comparer.unorderedArrays {
+			return comparer.compareUnorderedArrays(expectedValue, actualValue, path)
+		}
+		return comparer.compareOrderedArrays(expectedValue, actualValue, path)
+	case string:
+		if comparer.placeholders == nil || !comparer.placeholders.Contains(expectedValue) {
+			return comparer.compareScalars(expected, actual, path)
+		}
+
+		if comparer.placeholders.Matches(expectedValue, RenderJsonValue(actual)) {
+			return 1, 1, nil
+		}
+		return 0, 1, []StructuralDifference{
+			{Path: renderPath(path), Expected: expected, Actual: actual},
+		}
+	default:
+		return comparer.compareScalars(expected, actual, path)
+	}
+}
+
+func (comparer structuralComparer) compareScalars(
+	expected interface{},
+	actual interface{},
+	path []pathSegment,
+) (int, int, []StructuralDifference) {
+	if reflect.DeepEqual(expected, actual) {
+		return 1, 1, nil
+	}
+	return 0, 1, []StructuralDifference{
+		{Path: renderPath(path), Expected: expected, Actual: actual},
+	}
+}
+
+func (comparer structuralComparer) compareObjects(
+	expected map[string]interface{},
+	actual map[string]interface{},
+	path []pathSegment,
+) (int, int, []StructuralDifference) {
+	keys := make(map[string]bool)
+	for key := range expected {
+		keys[key] = true
+	}
+	for key := range actual {
+		keys[key] = true
+	}
+
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	matched, total := 0, 0
+	var differences []StructuralDifference
+
+	for _, key := range sortedKeys {
+		childPath := appendPath(path, pathSegment{key: key})
+		if comparer.isIgnored(childPath) {
+			continue
+		}
+
+		expectedChild, inExpected := expected[key]
+		actualChild, inActual := actual[key]
+
+		switch {
+		case inExpected && inActual:
+			childMatched, childTotal, childDifferences := comparer.compare(
+				expectedChild,
+				actualChild,
+				childPath,
+			)
+			matched += childMatched
+			total += childTotal
+			differences = append(differences, childDifferences...)
+		case inExpected:
+			total += countLeaves(expectedChild)
+			differences = append(differences, StructuralDifference{
+				Path:     renderPath(childPath),
+				Expected: expectedChild,
+				Actual:   missingValue{},
+			})
+		default:
+			total += countLeaves(actualChild)
+			differences = append(differences, StructuralDifference{
+				Path:     renderPath(childPath),
+				Expected: missingValue{},
+				Actual:   actualChild,
+			})
+		}
+	}
+
+	return matched, total, differences
+}
+
+func (comparer structuralComparer) compareOrderedArrays(
+	expected []interface{},
+	actual []interface{},
+	path []pathSegment,
+) (int, int, []StructuralDifference) {
+	matched, total := 0, 0
+	var differences []StructuralDifference
+
+	for index := 0; index < Max(len(expected), len(actual)); index++ {
+		childPath := appendPath(path, pathSegment{index: index, isIndex: true})
+		if comparer.isIgnored(childPath) {
+			continue
+		}
+
+		switch {
+		case index < len(expected) && index < len(actual):
+			childMatched, childTotal, childDifferences := comparer.compare(
+				expected[index],
+				actual[index],
+				childPath,
+			)
+			matched += childMatched
+			total += childTotal
+			differences = append(differences, childDifferences...)
+		case index < len(expected):
+			total += countLeaves(expected[index])
+			differences = append(differences, StructuralDifference{
+				Path:     renderPath(childPath),
+				Expected: expected[index],
+				Actual:   missingValue{},
+			})
+		default:
+			total += countLeaves(actual[index])
+			differences = append(differences, StructuralDifference{
+				Path:     renderPath(childPath),
+				Expected: missingValue{},
+				Actual:   actual[index],
+			})
+		}
+	}
+
+	return matched, total, differences
+}
+
+// Pairs every expected element with the unused actual element that matches it
+// best. Elements that can't be paired are reported as differences.
+func (comparer structuralComparer) compareUnorderedArrays(
+	expected []interface{},
+	actual []interface{},
+	path []pathSegment,
+) (int, int, []StructuralDifference) {
+	matched, total := 0, 0
+	var differences []StructuralDifference
+	used := make([]bool, len(actual))
+
+	for expectedIndex, expectedElement := range expected {
+		childPath := appendPath(path, pathSegment{index: expectedIndex, isIndex: true})
+		if comparer.isIgnored(childPath) {
+			continue
+		}
+
+		bestIndex := -1
+		bestMatched, bestTotal := 0, 0
+		var bestDifferences []StructuralDifference
+
+		for actualIndex, actualElement := range actual {
+			if used[actualIndex] {
+				continue
+			}
+
+			childMatched, childTotal, childDifferences := comparer.compare(
+				expectedElement,
+				actualElement,
+				childPath,
+			)
+
+			if bestIndex == -1 ||
+				float64(childMatched)/float64(Max(childTotal, 1)) >
+					float64(bestMatched)/float64(Max(bestTotal, 1)) {
+				bestIndex = actualIndex
+				bestMatched, bestTotal = childMatched, childTotal
+				bestDifferences = childDifferences
+			}
+
+			if len(childDifferences) == 0 {
+				break
+			}
+		}
+
+		if bestIndex == -1 {
+			total += countLeaves(expectedElement)
+			differences = append(differences, StructuralDifference{
+				Path:     renderPath(childPath),
+				Expected: expectedElement,
+				Actual:   missingValue{},
+			})
+			continue
+		}
+
+		used[bestIndex] = true
+		matched += bestMatched
+		total += bestTotal
+		differences = append(differences, bestDifferences...)
+	}
+
+	for actualIndex, actualElement := range actual {
+		if used[actualIndex] {
+			continue
+		}
+
+		childPath := appendPath(path, pathSegment{index: actualIndex, isIndex: true})
+		if comparer.isIgnored(childPath) {
+			continue
+		}
+
+		total += countLeaves(actualElement)
+		differences = append(differences, StructuralDifference{
+			Path:     renderPath(childPath),
+			Expected: missingValue{},
+			Actual:   actualElement,
+		})
+	}
+
+	return matched, total, differences
+}
+
+// Renders a JSON value as a string so it can be matched against a placeholder
+// or an assertion. Strings are returned as is, other values in their JSON form.
+func RenderJsonValue(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return str
+	}
+	return renderStructuralValue(value)
+}
+
+// Counts the number of leaves (scalars, empty objects and empty arrays) within
+// a value.
+func countLeaves(value interface{}) int {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if len(value) == 0 {
+			return 1
+		}
+		count := 0
+		for _, child := range value {
+			count += countLeaves(child)
+		}
+		return count
+	case []interface{}:
+		if len(value) == 0 {
+			return 1
+		}
+		count := 0
+		for _, child := range value {
+			count += countLeaves(child)
+		}
+		return count
+	default:
+		return 1
+	}
+}
+
+// A single token of a JSON path expression.
+type jsonPathToken struct {
+	// The key or index the token matches. Ignored when wildcard is set.
+	segment pathSegment
+	// Matches any key or index.
+	wildcard bool
+	// Matches zero or more segments (`..`).
+	recursive bool
+}
+
+// A compiled JSONPath-style expression, used to ignore fields during a
+// structural comparison or to look up a value within a document.
+type jsonPath struct {
+	tokens []jsonPathToken
+}
+
+func compileJsonPaths(expressions []string) ([]jsonPath, error) {
+	var paths []jsonPath
+	for _, expression := range expressions {
+		expression = strings.TrimSpace(expression)
+		if expression == "" {
+			continue
+		}
+
+		path, err := compileJsonPath(expression)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(path.tokens) == 0 {
+			return nil, fmt.Errorf("invalid ignore path %q: the root can't be ignored", expression)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// Compiles an expression such as `$.properties[*].id` or `$..etag`. The
+// leading `$` is optional.
+func compileJsonPath(expression string) (jsonPath, error) {
+	remaining := strings.TrimPrefix(expression, "$")
+	var tokens []jsonPathToken
+
+	if remaining != "" && remaining[0] != '.' && remaining[0] != '[' {
+		remaining = "." + remaining
+	}
+
+	for remaining != "" {
+		switch {
+		case strings.HasPrefix(remaining, ".."):
+			tokens = append(tokens, jsonPathToken{recursive: true})
+			remaining = remaining[1:]
+		case remaining[0] == '.':
+			end := strings.IndexAny(remaining[1:], ".[")
+			var key string
+			if end == -1 {
+				key = remaining[1:]
+				remaining = ""
+			} else {
+				key = remaining[1 : end+1]
+				remaining = remaining[end+1:]
+			}
+
+			if key == "" {
+				return jsonPath{}, fmt.Errorf("invalid JSON path %q: empty key", expression)
+			}
+
+			if key == "*" {
+				tokens = append(tokens, jsonPathToken{wildcard: true})
+			} else {
+				tokens = append(tokens, jsonPathToken{segment: pathSegment{key: key}})
+			}
+		case remaining[0] == '[':
+			end := strings.Index(remaining, "]")
+			if end == -1 {
+				return jsonPath{}, fmt.Errorf("invalid JSON path %q: unclosed bracket", expression)
+			}
+
+			content := strings.Trim(remaining[1:end], `'"`)
+			remaining = remaining[end+1:]
+
+			if content == "*" {
+				tokens = append(tokens, jsonPathToken{wildcard: true})
+			} else if index, err := strconv.Atoi(content); err == nil {
+				tokens = append(tokens, jsonPathToken{
+					segment: pathSegment{index: index, isIndex: true},
+				})
+			} else {
+				tokens = append(tokens, jsonPathToken{segment: pathSegment{key: content}})
+			}
+		default:
+			return jsonPath{}, fmt.Errorf("invalid JSON path %q", expression)
+		}
+	}
+
+	return jsonPath{tokens: tokens}, nil
+}
+
+// Checks if the given path is matched by the JSON path expression.
+func (expression jsonPath) matches(path []pathSegment) bool {
+	return matchJsonPathTokens(expression.tokens, path)
+}
+
+// Looks up the value at the given JSON path within a JSON document, I.E.
+// `.properties.provisioningState` or `$[0].name`. Wildcards and recursive
+// descent aren't supported as the path must resolve to a single value.
+func LookupJsonPath(jsonStr string, expression string) (interface{}, error) {
+	var document interface{}
+	if err := json.Unmarshal([]byte(jsonStr), &document); err != nil {
+		return nil, fmt.Errorf("failed to parse the output as JSON: %w", err)
+	}
+
+	path, err := compileJsonPath(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	current := document
+	for _, token := range path.tokens {
+		if token.wildcard || token.recursive {
+			return nil, fmt.Errorf("JSON path %q must resolve to a single value", expression)
+		}
+
+		switch value := current.(type) {
+		case map[string]interface{}:
+			child, ok := value[token.segment.key]
+			if token.segment.isIndex || !ok {
+				return nil, fmt.Errorf("JSON path %q does not exist", expression)
+			}
+			current = child
+		case []interface{}:
+			if !token.segment.isIndex || token.segment.index < 0 || token.segment.index >= len(value) {
+				return nil, fmt.Errorf("JSON path %q does not exist", expression)
+			}
+			current = value[token.segment.index]
+		default:
+			return nil, fmt.Errorf("JSON path %q does not exist", expression)
+		}
+	}
+
+	return current, nil
+}
+
+func matchJsonPathTokens(tokens []jsonPathToken, path []pathSegment) bool {
+	if len(tokens) == 0 {
+		return len(path) == 0
+	}
+
+	token := tokens[0]
+	if token.recursive {
+		for skipped := 0; skipped <= len(path); skipped++ {
+			if matchJsonPathTokens(tokens[1:], path[skipped:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(path) == 0 {
+		return false
+	}
+
+	if !token.wildcard && token.segment != path[0] {
+		return false
+	}
+
+	return matchJsonPathTokens(tokens[1:], path[1:])
+}
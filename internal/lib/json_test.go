@@ -1 +1,177 @@
 package lib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStructuralJsonComparison(t *testing.T) {
+	t.Run("Identical objects with different field order", func(t *testing.T) {
+		result, err := CompareJsonStrings(
+			`{"b": 2, "a": {"c": [1, 2]}}`,
+			`{"a": {"c": [1, 2]}, "b": 2}`,
+			1.0,
+			StructuralComparisonOptions{},
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if !result.AboveThreshold || result.Score != 1.0 {
+			t.Errorf("Expected a perfect score, got %f", result.Score)
+		}
+	})
+
+	t.Run("Top-level arrays", func(t *testing.T) {
+		result, err := CompareJsonStrings(
+			`[{"name": "rg1"}, {"name": "rg2"}]`,
+			`[{"name": "rg1"}, {"name": "rg3"}]`,
+			0.5,
+			StructuralComparisonOptions{},
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if result.Score != 0.5 {
+			t.Errorf("Expected a score of 0.5, got %f", result.Score)
+		}
+
+		if len(result.Differences) != 1 || result.Differences[0].Path != "$[1].name" {
+			t.Errorf("Unexpected differences: %v", result.Differences)
+		}
+	})
+
+	t.Run("Ignored paths are excluded from the score", func(t *testing.T) {
+		result, err := CompareJsonStrings(
+			`{"id": "/subscriptions/1", "etag": "a", "properties": {"state": "Succeeded", "etag": "b"}}`,
+			`{"id": "/subscriptions/2", "etag": "c", "properties": {"state": "Succeeded", "etag": "d"}}`,
+			1.0,
+			StructuralComparisonOptions{IgnorePaths: []string{"$.id", "$..etag"}},
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if !result.AboveThreshold {
+			t.Errorf("Expected ignored paths to be skipped, got differences: %v", result.Differences)
+		}
+	})
+
+	t.Run("Ignored paths with array wildcards", func(t *testing.T) {
+		result, err := CompareJsonStrings(
+			`[{"id": 1, "name": "a"}, {"id": 2, "name": "b"}]`,
+			`[{"id": 3, "name": "a"}, {"id": 4, "name": "b"}]`,
+			1.0,
+			StructuralComparisonOptions{IgnorePaths: []string{"$[*].id"}},
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if !result.AboveThreshold {
+			t.Errorf("Expected ignored paths to be skipped, got differences: %v", result.Differences)
+		}
+	})
+
+	t.Run("Unordered arrays", func(t *testing.T) {
+		actual := `{"zones": ["3", "1", "2"]}`
+		expected := `{"zones": ["1", "2", "3"]}`
+
+		ordered, err := CompareJsonStrings(actual, expected, 1.0, StructuralComparisonOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if ordered.AboveThreshold {
+			t.Errorf("Expected ordered comparison to fail")
+		}
+
+		unordered, err := CompareJsonStrings(
+			actual,
+			expected,
+			1.0,
+			StructuralComparisonOptions{UnorderedArrays: true},
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if !unordered.AboveThreshold {
+			t.Errorf("Expected unordered comparison to pass, got %v", unordered.Differences)
+		}
+	})
+
+	t.Run("Missing and extra fields are reported", func(t *testing.T) {
+		result, err := CompareJsonStrings(
+			`{"a": 1, "c": 3}`,
+			`{"a": 1, "b": 2}`,
+			1.0,
+			StructuralComparisonOptions{},
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		rendered := FormatStructuralDifferences(result.Differences)
+		if !strings.Contains(rendered, "$.b: expected 2, got <missing>") ||
+			!strings.Contains(rendered, "$.c: expected <missing>, got 3") {
+			t.Errorf("Unexpected differences:\n%s", rendered)
+		}
+	})
+
+	t.Run("Invalid ignore paths return an error", func(t *testing.T) {
+		_, err := CompareJsonStrings(`{}`, `{}`, 1.0, StructuralComparisonOptions{
+			IgnorePaths: []string{"$.a[0"},
+		})
+		if err == nil {
+			t.Errorf("Expected an error for an invalid ignore path")
+		}
+	})
+}
+
+func TestStructuralYamlComparison(t *testing.T) {
+	t.Run("YAML documents are compared structurally", func(t *testing.T) {
+		result, err := CompareYamlStrings(
+			"metadata:\n  name: web\n  uid: 123\nspec:\n  replicas: 2\n",
+			"spec:\n  replicas: 2\nmetadata:\n  name: web\n  uid: 456\n",
+			1.0,
+			StructuralComparisonOptions{IgnorePaths: []string{"$.metadata.uid"}},
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if !result.AboveThreshold {
+			t.Errorf("Expected YAML documents to match, got %v", result.Differences)
+		}
+	})
+}
+
+func TestLookupJsonPath(t *testing.T) {
+	document := `{"name": "web", "items": [{"id": 1}, {"id": 2}]}`
+
+	t.Run("Values are found by path", func(t *testing.T) {
+		value, err := LookupJsonPath(document, "$.items[1].id")
+		if err != nil {
+			t.Errorf("Error looking up path: %s", err)
+		}
+
+		if RenderJsonValue(value) != "2" {
+			t.Errorf("Value is wrong: %v", value)
+		}
+
+		value, err = LookupJsonPath(document, ".name")
+		if err != nil || RenderJsonValue(value) != "web" {
+			t.Errorf("Value is wrong: %v (%v)", value, err)
+		}
+	})
+
+	t.Run("Missing and ambiguous paths", func(t *testing.T) {
+		for _, expression := range []string{"$.missing", "$.items[5]", "$.items[*].id", "$..id"} {
+			if _, err := LookupJsonPath(document, expression); err == nil {
+				t.Errorf("Expected an error for %q", expression)
+			}
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package lib
+
+import (
+	"regexp"
+	"strings"
+)
+
+// A single step of the output normalization pipeline.
+type OutputNormalizer func(string) string
+
+// Matches ANSI CSI sequences (colors, cursor movement) and OSC sequences
+// (terminal titles, hyperlinks).
+var ansiEscapeSequence = regexp.MustCompile(
+	`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)`,
+)
+
+// Removes ANSI escape codes from the output.
+func StripAnsiCodes(output string) string {
+	return ansiEscapeSequence.ReplaceAllString(output, "")
+}
+
+// Converts CRLF and lone CR line endings into LF.
+func NormalizeLineEndings(output string) string {
+	output = strings.ReplaceAll(output, "\r\n", "\n")
+	return strings.ReplaceAll(output, "\r", "\n")
+}
+
+// Removes the whitespace at the end of every line as well as any trailing
+// empty lines.
+func TrimTrailingWhitespace(output string) string {
+	lines := strings.Split(output, "\n")
+	for index, line := range lines {
+		lines[index] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// The normalizers applied to command outputs before they are compared.
+var DefaultOutputNormalizers = []OutputNormalizer{
+	StripAnsiCodes,
+	NormalizeLineEndings,
+	TrimTrailingWhitespace,
+}
+
+// Runs the output through each of the normalizers in order.
+func NormalizeOutput(output string, normalizers ...OutputNormalizer) string {
+	for _, normalize := range normalizers {
+		output = normalize(output)
+	}
+	return output
+}
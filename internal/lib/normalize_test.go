@@ -0,0 +1,26 @@
+package lib
+
+import "testing"
+
+func TestOutputNormalization(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"ANSI colors", "\x1b[32mSucceeded\x1b[0m", "Succeeded"},
+		{"OSC hyperlinks", "\x1b]8;;https://aka.ms\x07link\x1b]8;;\x07", "link"},
+		{"CRLF line endings", "line1\r\nline2\r\n", "line1\nline2"},
+		{"Trailing whitespace", "name   \nvalue\t\n\n", "name\nvalue"},
+		{"Leading whitespace is kept", "  indented", "  indented"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := NormalizeOutput(tc.input, DefaultOutputNormalizers...)
+			if result != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/logging"
+)
+
+// Matches the placeholder tokens that can be used within expected outputs.
+var placeholderToken = regexp.MustCompile(
+	`<(GUID|TIMESTAMP|IP|ANY|VAR:([a-zA-Z_][a-zA-Z0-9_]*))>`,
+)
+
+// Patterns for each of the built-in placeholders.
+var placeholderPatterns = map[string]string{
+	"GUID":      `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	"TIMESTAMP": `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?`,
+	"IP":        `(?:(?:\d{1,3}\.){3}\d{1,3}|[0-9a-fA-F]{0,4}(?::[0-9a-fA-F]{0,4}){2,7})`,
+	"ANY":       `[^\n]*?`,
+}
+
+// Resolves placeholder tokens such as `<GUID>` or `<VAR:NAME>` within an
+// expected output. Variables are looked up in the environment variables
+// provided when the placeholders were created.
+type Placeholders struct {
+	environmentVariables map[string]string
+}
+
+func NewPlaceholders(environmentVariables map[string]string) Placeholders {
+	return Placeholders{environmentVariables: environmentVariables}
+}
+
+// Checks if the given string contains any placeholder tokens.
+func (placeholders Placeholders) Contains(expected string) bool {
+	return placeholderToken.MatchString(expected)
+}
+
+// Builds the regex pattern for the expected string, where literal text is
+// escaped and every placeholder becomes a capture group.
+func (placeholders Placeholders) pattern(expected string) string {
+	var pattern strings.Builder
+	last := 0
+
+	for _, match := range placeholderToken.FindAllStringSubmatchIndex(expected, -1) {
+		pattern.WriteString(regexp.QuoteMeta(expected[last:match[0]]))
+		last = match[1]
+
+		name := expected[match[2]:match[3]]
+		if match[4] != -1 {
+			variable := expected[match[4]:match[5]]
+			value, ok := placeholders.environmentVariables[variable]
+			if !ok {
+				logging.GlobalLogger.Warnf(
+					"Variable %s used by a placeholder is not defined, matching it literally",
+					variable,
+				)
+				value = expected[match[0]:match[1]]
+			}
+			pattern.WriteString("(" + regexp.QuoteMeta(value) + ")")
+			continue
+		}
+
+		pattern.WriteString("(" + placeholderPatterns[name] + ")")
+	}
+
+	pattern.WriteString(regexp.QuoteMeta(expected[last:]))
+	return pattern.String()
+}
+
+// Compiles the expected string into a regex that matches the entire actual
+// value.
+func (placeholders Placeholders) Compile(expected string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("^" + placeholders.pattern(expected) + "$")
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile placeholders in %q: %w", expected, err)
+	}
+	return re, nil
+}
+
+// Checks if the actual value matches the expected string, including its
+// placeholders.
+func (placeholders Placeholders) Matches(expected string, actual string) bool {
+	re, err := placeholders.Compile(expected)
+	if err != nil {
+		logging.GlobalLogger.Warn(err)
+		return false
+	}
+	return re.MatchString(actual)
+}
+
+// Replaces the placeholders within the expected output with the text they
+// matched in the actual output. The whole output is tried first, and if it
+// doesn't match, each line containing placeholders is matched against the
+// remaining lines of the actual output. Placeholders that can't be matched are
+// left untouched so that they count against the similarity score.
+func (placeholders Placeholders) Substitute(expected string, actual string) string {
+	if !placeholders.Contains(expected) {
+		return expected
+	}
+
+	re, err := regexp.Compile("^" + placeholders.pattern(expected) + "$")
+	if err == nil && re.MatchString(actual) {
+		return actual
+	}
+
+	expectedLines := strings.Split(expected, "\n")
+	actualLines := strings.Split(actual, "\n")
+	cursor := 0
+
+	for index, line := range expectedLines {
+		if !placeholders.Contains(line) {
+			continue
+		}
+
+		lineRegex, err := placeholders.Compile(line)
+		if err != nil {
+			logging.GlobalLogger.Warn(err)
+			continue
+		}
+
+		for candidate := cursor; candidate < len(actualLines); candidate++ {
+			if lineRegex.MatchString(actualLines[candidate]) {
+				expectedLines[index] = actualLines[candidate]
+				cursor = candidate + 1
+				break
+			}
+		}
+	}
+
+	return strings.Join(expectedLines, "\n")
+}
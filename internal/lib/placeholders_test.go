@@ -0,0 +1,59 @@
+package lib
+
+import "testing"
+
+func TestPlaceholders(t *testing.T) {
+	placeholders := NewPlaceholders(map[string]string{"MY_RESOURCE_GROUP": "rg-1.2"})
+
+	t.Run("Built-in placeholders match their values", func(t *testing.T) {
+		testCases := []struct {
+			expected string
+			actual   string
+			matches  bool
+		}{
+			{"<GUID>", "0a2c89a7-a44e-4cd0-b6ec-868432ad1d13", true},
+			{"<GUID>", "not-a-guid", false},
+			{"created at <TIMESTAMP>", "created at 2024-06-11T09:41:36.631310+00:00", true},
+			{"<IP>:22", "10.0.0.4:22", true},
+			{"name: <ANY>", "name: anything at all", true},
+			{"name: <ANY>", "name: first\nsecond", false},
+			{"group <VAR:MY_RESOURCE_GROUP>", "group rg-1.2", true},
+			{"group <VAR:MY_RESOURCE_GROUP>", "group rg-132", false},
+			{"<VAR:UNDEFINED>", "<VAR:UNDEFINED>", true},
+		}
+
+		for _, tc := range testCases {
+			if result := placeholders.Matches(tc.expected, tc.actual); result != tc.matches {
+				t.Errorf("Matches(%q, %q) = %v, expected %v", tc.expected, tc.actual, result, tc.matches)
+			}
+		}
+	})
+
+	t.Run("Substituting a fully matching output", func(t *testing.T) {
+		expected := "id: <GUID>\nstate: Succeeded"
+		actual := "id: 0a2c89a7-a44e-4cd0-b6ec-868432ad1d13\nstate: Succeeded"
+
+		if result := placeholders.Substitute(expected, actual); result != actual {
+			t.Errorf("Expected %q, got %q", actual, result)
+		}
+	})
+
+	t.Run("Any text doesn't span lines when substituting", func(t *testing.T) {
+		expected := "start <ANY> end"
+		actual := "start one\ntwo end"
+
+		if result := placeholders.Substitute(expected, actual); result != expected {
+			t.Errorf("Expected %q to be left untouched, got %q", expected, result)
+		}
+	})
+
+	t.Run("Substituting a partially matching output", func(t *testing.T) {
+		expected := "id: <GUID>\nstate: Succeeded"
+		actual := "id: 0a2c89a7-a44e-4cd0-b6ec-868432ad1d13\nstate: Failed"
+
+		result := placeholders.Substitute(expected, actual)
+		if result != "id: 0a2c89a7-a44e-4cd0-b6ec-868432ad1d13\nstate: Succeeded" {
+			t.Errorf("Unexpected substitution: %q", result)
+		}
+	})
+}
@@ -0,0 +1,164 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xrash/smetrics"
+)
+
+// The algorithms that can be used to compute how similar the actual output of
+// a command is to its expected output. All of them produce a score between 0
+// and 1.
+type SimilarityAlgorithm string
+
+const (
+	// 1 if both outputs are identical, 0 otherwise.
+	SimilarityExact SimilarityAlgorithm = "exact"
+	// The ratio of lines shared between both outputs, computed from a line diff.
+	SimilarityLineDiff SimilarityAlgorithm = "line_diff"
+	// 1 minus the Levenshtein distance divided by the length of the longest
+	// output.
+	SimilarityLevenshtein SimilarityAlgorithm = "levenshtein"
+	// The overlap between the sets of whitespace separated tokens of both
+	// outputs.
+	SimilarityTokenSet SimilarityAlgorithm = "token_set"
+	// The ratio of expected lines that appear somewhere in the actual output.
+	SimilarityContainsLines SimilarityAlgorithm = "contains_lines"
+	// The Jaro-Winkler similarity of both outputs.
+	SimilarityJaroWinkler SimilarityAlgorithm = "jaro_winkler"
+	// Structural comparison used for JSON and YAML outputs. See
+	// CompareJsonStrings.
+	SimilarityStructural SimilarityAlgorithm = "structural"
+)
+
+var textSimilarityAlgorithms = map[SimilarityAlgorithm]func(expected, actual string) float64{
+	SimilarityExact:         exactSimilarity,
+	SimilarityLineDiff:      lineDiffSimilarity,
+	SimilarityLevenshtein:   levenshteinSimilarity,
+	SimilarityTokenSet:      tokenSetSimilarity,
+	SimilarityContainsLines: containsLinesSimilarity,
+	SimilarityJaroWinkler: func(expected, actual string) float64 {
+		return smetrics.JaroWinkler(expected, actual, 0.7, 4)
+	},
+}
+
+// Converts a string into a similarity algorithm, returning an error if the
+// algorithm is unknown.
+func ParseSimilarityAlgorithm(algorithm string) (SimilarityAlgorithm, error) {
+	parsed := SimilarityAlgorithm(strings.ToLower(strings.TrimSpace(algorithm)))
+	if _, ok := textSimilarityAlgorithms[parsed]; ok || parsed == SimilarityStructural {
+		return parsed, nil
+	}
+
+	return "", fmt.Errorf(
+		"unknown similarity algorithm %q, valid options are 'exact', 'line_diff', 'levenshtein', 'token_set', 'contains_lines', 'jaro_winkler' and 'structural'",
+		algorithm,
+	)
+}
+
+// Computes the similarity between two text outputs using the given algorithm.
+// The structural algorithm isn't supported here as it requires parsing the
+// outputs, use CompareJsonStrings or CompareYamlStrings instead.
+func ComputeSimilarity(algorithm SimilarityAlgorithm, expected, actual string) (float64, error) {
+	compute, ok := textSimilarityAlgorithms[algorithm]
+	if !ok {
+		return 0, fmt.Errorf("similarity algorithm %q can't be used to compare text", algorithm)
+	}
+	return compute(expected, actual), nil
+}
+
+func exactSimilarity(expected, actual string) float64 {
+	if expected == actual {
+		return 1
+	}
+	return 0
+}
+
+func lineDiffSimilarity(expected, actual string) float64 {
+	expectedLines := strings.Split(expected, "\n")
+	actualLines := strings.Split(actual, "\n")
+
+	equalLines := longestCommonSubsequence(expectedLines, actualLines)
+	return 2 * float64(equalLines) / float64(len(expectedLines)+len(actualLines))
+}
+
+// Computes the length of the longest common subsequence of lines, which is the
+// number of lines a line diff would mark as unchanged.
+func longestCommonSubsequence(a, b []string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				current[j] = previous[j-1] + 1
+			} else {
+				current[j] = Max(previous[j], current[j-1])
+			}
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+func levenshteinSimilarity(expected, actual string) float64 {
+	longest := Max(len(expected), len(actual))
+	if longest == 0 {
+		return 1
+	}
+
+	distance := smetrics.WagnerFischer(expected, actual, 1, 1, 1)
+	return 1 - float64(distance)/float64(longest)
+}
+
+func tokenSetSimilarity(expected, actual string) float64 {
+	expectedTokens := make(map[string]bool)
+	for _, token := range strings.Fields(expected) {
+		expectedTokens[token] = true
+	}
+
+	actualTokens := make(map[string]bool)
+	for _, token := range strings.Fields(actual) {
+		actualTokens[token] = true
+	}
+
+	if len(expectedTokens) == 0 && len(actualTokens) == 0 {
+		return 1
+	}
+
+	shared := 0
+	for token := range expectedTokens {
+		if actualTokens[token] {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(expectedTokens)+len(actualTokens)-shared)
+}
+
+func containsLinesSimilarity(expected, actual string) float64 {
+	actualLines := make(map[string]bool)
+	for _, line := range strings.Split(actual, "\n") {
+		actualLines[strings.TrimSpace(line)] = true
+	}
+
+	total, found := 0, 0
+	for _, line := range strings.Split(expected, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		total++
+		if actualLines[line] {
+			found++
+		}
+	}
+
+	if total == 0 {
+		return 1
+	}
+	return float64(found) / float64(total)
+}
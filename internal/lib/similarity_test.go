@@ -0,0 +1,52 @@
+package lib
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSimilarityAlgorithms(t *testing.T) {
+	table := "Name    Location\nrg-1    eastus\nrg-2    westus"
+
+	testCases := []struct {
+		algorithm SimilarityAlgorithm
+		expected  string
+		actual    string
+		score     float64
+	}{
+		{SimilarityExact, "hello", "hello", 1},
+		{SimilarityExact, "hello", "hello!", 0},
+		{SimilarityLineDiff, table, table, 1},
+		{SimilarityLineDiff, "a\nb\nc\nd", "a\nb\nx\nd", 0.75},
+		{SimilarityLevenshtein, "kitten", "sitting", 1 - 3.0/7.0},
+		{SimilarityTokenSet, "a b c", "c b a", 1},
+		{SimilarityTokenSet, "a b", "b c", 1.0 / 3.0},
+		{SimilarityContainsLines, "rg-2    westus\nrg-1    eastus", table, 1},
+		{SimilarityContainsLines, "rg-3    eastus\nrg-1    eastus", table, 0.5},
+		{SimilarityJaroWinkler, "hello", "hello", 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.algorithm), func(t *testing.T) {
+			score, err := ComputeSimilarity(tc.algorithm, tc.expected, tc.actual)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if math.Abs(score-tc.score) > 0.0001 {
+				t.Errorf("Expected a score of %f, got %f", tc.score, score)
+			}
+		})
+	}
+
+	t.Run("Parsing similarity algorithms", func(t *testing.T) {
+		algorithm, err := ParseSimilarityAlgorithm(" Levenshtein ")
+		if err != nil || algorithm != SimilarityLevenshtein {
+			t.Errorf("Expected levenshtein, got %q (%v)", algorithm, err)
+		}
+
+		if _, err := ParseSimilarityAlgorithm("cosine"); err == nil {
+			t.Errorf("Expected an error for an unknown algorithm")
+		}
+	})
+}
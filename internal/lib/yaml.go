@@ -0,0 +1,102 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Compare two YAML strings structurally. Uses the same comparison as
+// CompareJsonStrings after normalizing both documents into their JSON
+// representation, so the ignore paths and scoring behave identically.
+func CompareYamlStrings(
+	actualYaml string,
+	expectedYaml string,
+	threshold float64,
+	options StructuralComparisonOptions,
+) (ComparisonResult, error) {
+	actual, err := decodeYamlAsJson(actualYaml)
+	if err != nil {
+		return ComparisonResult{}, fmt.Errorf("failed to parse the actual output as YAML: %w", err)
+	}
+
+	expected, err := decodeYamlAsJson(expectedYaml)
+	if err != nil {
+		return ComparisonResult{}, fmt.Errorf("failed to parse the expected output as YAML: %w", err)
+	}
+
+	return CompareStructuredValues(actual, expected, threshold, options)
+}
+
+// Decodes a YAML document into the same shape that encoding/json would
+// produce for the equivalent JSON document.
+func decodeYamlAsJson(yamlStr string) (interface{}, error) {
+	var decoded interface{}
+	if err := yaml.Unmarshal([]byte(yamlStr), &decoded); err != nil {
+		return nil, err
+	}
+
+	normalized, err := json.Marshal(StringifyYamlKeys(decoded))
+	if err != nil {
+		return nil, err
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(normalized, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// YAML allows non-string keys for mappings, which JSON doesn't. Convert any
+// of those keys into strings so the document can be represented as JSON.
+func StringifyYamlKeys(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, child := range value {
+			result[fmt.Sprintf("%v", key)] = StringifyYamlKeys(child)
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, child := range value {
+			result[key] = StringifyYamlKeys(child)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for index, child := range value {
+			result[index] = StringifyYamlKeys(child)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// Converts a JSON document into an equivalent YAML document. The order of the
+// fields is kept, so the YAML rendering of a value matches its JSON rendering.
+func JsonToYaml(jsonData []byte) ([]byte, error) {
+	// JSON is valid YAML, so the document can be parsed directly into a node
+	// that remembers the order of the fields.
+	var document yaml.Node
+	if err := yaml.Unmarshal(jsonData, &document); err != nil {
+		return nil, err
+	}
+
+	useBlockStyle(&document)
+
+	return yaml.Marshal(&document)
+}
+
+// Renders a node and its children in the block style instead of the flow style
+// used by JSON, leaving only strings that need quotes quoted.
+func useBlockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		useBlockStyle(child)
+	}
+}
@@ -0,0 +1,15 @@
+package lib
+
+import "testing"
+
+func TestJsonToYaml(t *testing.T) {
+	converted, err := JsonToYaml([]byte(`{"name": "scenario", "steps": [{"id": 1, "tags": []}], "empty": null, "text": "true"}`))
+	if err != nil {
+		t.Fatalf("Expected err to be nil, got %v", err)
+	}
+
+	expected := "name: scenario\nsteps:\n    - id: 1\n      tags: []\nempty: null\ntext: \"true\"\n"
+	if string(converted) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, converted)
+	}
+}
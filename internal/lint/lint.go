@@ -0,0 +1,278 @@
+package lint
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/yuin/goldmark/ast"
+)
+
+// How serious a problem found by the linter is. Only errors fail `ie lint`.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// A problem found within an executable document.
+type Diagnostic struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Message  string   `json:"message"`
+}
+
+// Renders the diagnostic the same way compilers do, I.E.
+// `doc.md:12: error: <message> (IE001)`.
+func (diagnostic Diagnostic) String() string {
+	return fmt.Sprintf(
+		"%s:%d: %s: %s (%s)",
+		diagnostic.File,
+		diagnostic.Line,
+		diagnostic.Severity,
+		diagnostic.Message,
+		diagnostic.Rule,
+	)
+}
+
+// A check performed by the linter.
+type Rule struct {
+	ID          string
+	Severity    Severity
+	Description string
+}
+
+const (
+	RuleOrphanExpectedOutput         = "IE001"
+	RuleMissingTitle                 = "IE002"
+	RuleInvalidExpectedOutputComment = "IE003"
+	RuleDuplicateHeader              = "IE004"
+	RuleUnknownLanguage              = "IE005"
+	RuleInvalidDirective             = "IE006"
+	RuleShellSyntax                  = "IE007"
+	RuleInvalidSimilarityAlgorithm   = "IE008"
+	RuleOptInLanguage                = "IE009"
+)
+
+// Every rule checked by the linter.
+var Rules = []Rule{
+	{RuleOrphanExpectedOutput, SeverityError, "An expected output has no code block before it to compare against."},
+	{RuleMissingTitle, SeverityWarning, "The document has no h1 header, so the name of the file is used as its title."},
+	{RuleInvalidExpectedOutputComment, SeverityError, "An expected_similarity comment has an invalid score, regex or attribute."},
+	{RuleDuplicateHeader, SeverityWarning, "Code blocks under headers with the same text are merged into a single step."},
+	{RuleUnknownLanguage, SeverityInfo, "A code block is written in a language that has no executor, so it is not executed."},
+	{RuleInvalidDirective, SeverityError, "An ie: directive or file attribute is invalid, or a directive has no code block before it."},
+	{RuleShellSyntax, SeverityError, "A shell code block has a syntax error, so it fails before any of its commands run."},
+	{RuleInvalidSimilarityAlgorithm, SeverityError, "The similarity_algorithm of the front matter is not a known algorithm."},
+	{RuleOptInLanguage, SeverityWarning, "A code block is written in a language that is only executed when it sets exec=true."},
+}
+
+func severityOf(rule string) Severity {
+	for _, candidate := range Rules {
+		if candidate.ID == rule {
+			return candidate.Severity
+		}
+	}
+	return SeverityError
+}
+
+// Checks whether any of the diagnostics is an error.
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Lints a markdown file on disk.
+func LintFile(path string) ([]Diagnostic, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return LintMarkdown(path, source), nil
+}
+
+// Finds the line of a property within the front matter of a document, or the
+// first line when it can't be found.
+func frontMatterLine(source []byte, property string) int {
+	for index, line := range strings.Split(string(source), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), property+":") {
+			return index + 1
+		}
+	}
+	return 1
+}
+
+// A header that code blocks are grouped under.
+type headerOccurrence struct {
+	line          int
+	hasCodeBlocks bool
+}
+
+// Lints the source of a markdown document. The diagnostics are sorted by line.
+func LintMarkdown(path string, source []byte) []Diagnostic {
+	var diagnostics []Diagnostic
+	report := func(rule string, line int, format string, args ...interface{}) {
+		diagnostics = append(diagnostics, Diagnostic{
+			Rule:     rule,
+			Severity: severityOf(rule),
+			File:     path,
+			Line:     line,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	document := parsers.ParseMarkdownIntoAst(source)
+
+	if _, err := parsers.ExtractScenarioTitleFromAst(document, source); err != nil {
+		report(RuleMissingTitle, 1, "the document has no h1 header to use as its title")
+	}
+
+	if algorithm, ok := parsers.ExtractYamlMetadataFromAst(document)[parsers.SimilarityAlgorithmProperty]; ok {
+		name, _ := algorithm.(string)
+		if _, err := lib.ParseSimilarityAlgorithm(name); err != nil {
+			report(RuleInvalidSimilarityAlgorithm, frontMatterLine(source, parsers.SimilarityAlgorithmProperty), "%s", err)
+		}
+	}
+
+	executable := make(map[string]bool)
+	for _, language := range shells.ExecutableLanguages() {
+		executable[language] = true
+	}
+
+	var headerOrder []string
+	headers := make(map[string][]*headerOccurrence)
+	var currentHeader *headerOccurrence
+	codeBlocks := 0
+	expectedOutputPending := false
+
+	ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		line := parsers.NodeStartLine(node, source)
+
+		switch n := node.(type) {
+		case *ast.Heading:
+			text := string(n.Text(source))
+			if _, ok := headers[text]; !ok {
+				headerOrder = append(headerOrder, text)
+			}
+			currentHeader = &headerOccurrence{line: line}
+			headers[text] = append(headers[text], currentHeader)
+		case *ast.HTMLBlock:
+			var content strings.Builder
+			lines := n.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				segment := lines.At(i)
+				content.Write(segment.Value(source))
+			}
+
+			hasDirectives, errs := parsers.ValidateCommentDirectives(content.String())
+			if hasDirectives {
+				for _, err := range errs {
+					report(RuleInvalidDirective, line, "%s", err)
+				}
+				if codeBlocks == 0 {
+					report(RuleInvalidDirective, line, "the directives have no code block before them")
+				}
+				break
+			}
+
+			isExpectedOutput, err := parsers.ValidateExpectedOutputComment(content.String())
+			if err != nil {
+				report(RuleInvalidExpectedOutputComment, line, "%s", err)
+			} else if isExpectedOutput {
+				expectedOutputPending = true
+			}
+		case *ast.FencedCodeBlock:
+			language := string(n.Language(source))
+			attributes := parsers.ExtractCodeBlockAttributes(n, source)
+			file, err := parsers.ParseFileTarget(attributes)
+
+			switch {
+			case err != nil:
+				report(RuleInvalidDirective, line, "%s", err)
+			case file == nil && shells.IsOptInLanguage(language) && !shells.ShouldExecute(language, attributes):
+				report(
+					RuleOptInLanguage,
+					line,
+					"the %s code block is not executed unless it sets %s=true",
+					language,
+					shells.ExecuteAttribute,
+				)
+			case executable[language] || file != nil:
+				codeBlocks++
+				if currentHeader != nil {
+					currentHeader.hasCodeBlocks = true
+				}
+				if file == nil && parsers.IsShellLanguage(language) {
+					var content strings.Builder
+					lines := n.Lines()
+					for i := 0; i < lines.Len(); i++ {
+						segment := lines.At(i)
+						content.Write(segment.Value(source))
+					}
+
+					// The content of the code block starts on the line after
+					// its opening fence.
+					if err := parsers.CheckShellSyntax(content.String(), language); err != nil {
+						report(RuleShellSyntax, line+err.Line, "syntax error at column %d: %s", err.Column, err.Message)
+					}
+				}
+			case expectedOutputPending:
+				expectedOutputPending = false
+				if codeBlocks == 0 {
+					report(RuleOrphanExpectedOutput, line, "the expected output has no code block before it")
+				}
+			case language != "":
+				report(
+					RuleUnknownLanguage,
+					line,
+					"the language %q has no executor, the code block is not executed",
+					language,
+				)
+			}
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	for _, text := range headerOrder {
+		var first *headerOccurrence
+		for _, occurrence := range headers[text] {
+			if !occurrence.hasCodeBlocks {
+				continue
+			}
+			if first == nil {
+				first = occurrence
+				continue
+			}
+			report(
+				RuleDuplicateHeader,
+				occurrence.line,
+				"the code blocks under %q are merged into the step of the same header on line %d",
+				text,
+				first.line,
+			)
+		}
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return diagnostics[i].Line < diagnostics[j].Line
+	})
+
+	return diagnostics
+}
@@ -0,0 +1,117 @@
+package lint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintMarkdown(t *testing.T) {
+	t.Run("Clean document", func(t *testing.T) {
+		source := "# Title\n\n## Step\n\nRun it:\n\n```bash\necho hi\n```\n\n<!-- expected_similarity=0.8 -->\n```text\nhi\n```\n"
+		assert.Empty(t, LintMarkdown("doc.md", []byte(source)))
+	})
+
+	t.Run("Reports every rule", func(t *testing.T) {
+		source := "## No title\n\n" + // 1
+			"<!-- expected_similarity=0.8 -->\n" + // 3
+			"```text\nhi\n```\n\n" + // 4
+			"## Step\n\nRun:\n\n```bash\necho hi\n```\n\n" + // 8, 12
+			"<!--\nie:assert stdout sometimes hi\n-->\n\n" + // 16
+			"<!-- expected_similarity=\"([\" -->\n\n" + // 20
+			"```bsh\necho typo\n```\n\n" + // 22
+			"## Step\n\nAgain:\n\n```bash\necho again\n```\n" // 26, 30
+
+		diagnostics := LintMarkdown("doc.md", []byte(source))
+
+		var rules []string
+		var lines []int
+		for _, diagnostic := range diagnostics {
+			rules = append(rules, diagnostic.Rule)
+			lines = append(lines, diagnostic.Line)
+		}
+
+		assert.Equal(
+			t,
+			[]string{
+				RuleMissingTitle,
+				RuleOrphanExpectedOutput,
+				RuleInvalidDirective,
+				RuleInvalidExpectedOutputComment,
+				RuleUnknownLanguage,
+				RuleDuplicateHeader,
+			},
+			rules,
+		)
+		assert.Equal(t, []int{1, 4, 16, 20, 22, 26}, lines)
+		assert.True(t, HasErrors(diagnostics))
+		assert.Equal(t, "doc.md:4: error: the expected output has no code block before it (IE001)", diagnostics[1].String())
+	})
+
+	t.Run("Misspelled assertions are errors", func(t *testing.T) {
+		source := "# Title\n\nRun it:\n\n```bash\necho hi\n```\n\n<!-- ie:assert stdout not contians Error -->\n"
+		diagnostics := LintMarkdown("doc.md", []byte(source))
+		if assert.Len(t, diagnostics, 1) {
+			assert.Equal(t, RuleInvalidDirective, diagnostics[0].Rule)
+			assert.True(t, HasErrors(diagnostics))
+		}
+	})
+
+	t.Run("Malformed wait conditions are errors", func(t *testing.T) {
+		source := "# Title\n\nRun it:\n\n```bash\necho hi\n```\n\n<!-- ie:wait-until interval=1m timeout=30s -->\n"
+		diagnostics := LintMarkdown("doc.md", []byte(source))
+		if assert.Len(t, diagnostics, 1) {
+			assert.Equal(t, RuleInvalidDirective, diagnostics[0].Rule)
+		}
+	})
+
+	t.Run("Unknown similarity algorithms are errors", func(t *testing.T) {
+		source := "---\ntitle: Doc\nsimilarity_algorithm: exactly\n---\n# Title\n\nRun it:\n\n```bash\necho hi\n```\n\n" +
+			"<!-- expected_similarity=1.0 similarity_algorithm=levenstein -->\n```text\nhi\n```\n"
+		diagnostics := LintMarkdown("doc.md", []byte(source))
+		if assert.GreaterOrEqual(t, len(diagnostics), 2) {
+			assert.Equal(t, RuleInvalidSimilarityAlgorithm, diagnostics[0].Rule)
+			assert.Equal(t, 3, diagnostics[0].Line)
+			assert.Equal(t, RuleInvalidExpectedOutputComment, diagnostics[1].Rule)
+		}
+	})
+
+	t.Run("Malformed file attributes are errors", func(t *testing.T) {
+		for _, fence := range []string{"```yaml file=\"\"", "```yaml file=app.yaml expand=maybe"} {
+			source := "# Title\n\nCreate the file:\n\n" + fence + "\nname: app\n```\n"
+			diagnostics := LintMarkdown("doc.md", []byte(source))
+			if assert.Len(t, diagnostics, 1, fence) {
+				assert.Equal(t, RuleInvalidDirective, diagnostics[0].Rule)
+				assert.Equal(t, 5, diagnostics[0].Line)
+				assert.True(t, HasErrors(diagnostics))
+			}
+		}
+	})
+
+	t.Run("Opt-in languages without exec are warnings", func(t *testing.T) {
+		source := "# Title\n\n```python\nprint('hi')\n```\n\n```http exec=true\nGET http://localhost\n```\n"
+		diagnostics := LintMarkdown("doc.md", []byte(source))
+		if assert.Len(t, diagnostics, 1) {
+			assert.Equal(t, RuleOptInLanguage, diagnostics[0].Rule)
+			assert.Equal(t, 3, diagnostics[0].Line)
+			assert.False(t, HasErrors(diagnostics))
+		}
+	})
+
+	t.Run("Warnings are not errors", func(t *testing.T) {
+		diagnostics := LintMarkdown("doc.md", []byte("No title\n"))
+		assert.Len(t, diagnostics, 1)
+		assert.False(t, HasErrors(diagnostics))
+	})
+
+	t.Run("Shell syntax errors are reported on the line of the markdown file", func(t *testing.T) {
+		source := "# Title\n\n```bash\necho one\nif true; then\n  echo two\n```\n\n" +
+			"```python exec=true\nif True:\n```\n\n```yaml file=app.yaml\nif: $(\n```\n"
+		diagnostics := LintMarkdown("doc.md", []byte(source))
+		if assert.Len(t, diagnostics, 1) {
+			assert.Equal(t, RuleShellSyntax, diagnostics[0].Rule)
+			assert.Equal(t, 5, diagnostics[0].Line)
+			assert.True(t, HasErrors(diagnostics))
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The size past which a log file is rotated.
+const MaxLogFileSize = 10 * 1024 * 1024
+
+// The number of rotated log files kept next to a log file, named after it
+// with .1 being the most recent.
+const MaxLogFileBackups = 3
+
+// The number of runs whose log files are kept in the log directory. The
+// oldest are deleted as new runs start.
+const MaxRunLogFiles = 50
+
+// The extension of the log files of runs.
+const runLogExtension = ".log"
+
+// Creates the ID of a run. IDs start with the time the run started, so that
+// they sort in the order the runs started.
+func NewRunId() string {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return time.Now().UTC().Format("20060102T150405.000000000Z")
+	}
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// Gets the directory that the log files of runs are written to, which is
+// within $XDG_STATE_HOME, or ~/.local/state when it isn't set.
+func LogDirectory() string {
+	stateDirectory := os.Getenv("XDG_STATE_HOME")
+	if stateDirectory == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return filepath.Join(os.TempDir(), "ie", "logs")
+		}
+		stateDirectory = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateDirectory, "ie", "logs")
+}
+
+// Opens the file that the logs of a run are written to. Without a file, the
+// run logs to a file named after its ID within the log directory, or within
+// the temporary directory when the log directory can't be written to.
+func openLogFile(path string, runId string) (*rotatingFile, error) {
+	if path != "" {
+		file, err := openRotatingFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the log file %s: %w", path, err)
+		}
+		return file, nil
+	}
+
+	var errs []string
+	for _, directory := range []string{LogDirectory(), filepath.Join(os.TempDir(), "ie", "logs")} {
+		if err := os.MkdirAll(directory, 0755); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		pruneRunLogFiles(directory, MaxRunLogFiles-1)
+		file, err := openRotatingFile(filepath.Join(directory, runId+runLogExtension))
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		return file, nil
+	}
+
+	return nil, fmt.Errorf("failed to create the log file of the run: %s", strings.Join(errs, "; "))
+}
+
+// Deletes the log files of the oldest runs in a directory, along with their
+// rotated files, so that at most a number of runs are kept.
+func pruneRunLogFiles(directory string, keep int) {
+	logFiles, err := filepath.Glob(filepath.Join(directory, "*"+runLogExtension))
+	if err != nil || len(logFiles) <= keep {
+		return
+	}
+
+	sort.Strings(logFiles)
+	for _, logFile := range logFiles[:len(logFiles)-keep] {
+		rotated, _ := filepath.Glob(logFile + ".*")
+		for _, file := range append(rotated, logFile) {
+			os.Remove(file)
+		}
+	}
+}
+
+// A log file that is rotated once it grows past MaxLogFileSize. The file is
+// renamed to <path>.1, the previous <path>.1 to <path>.2 and so on, and the
+// oldest beyond MaxLogFileBackups is deleted.
+type rotatingFile struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+	size  int64
+	// The size past which the file is rotated.
+	maxSize int64
+}
+
+func openRotatingFile(path string) (*rotatingFile, error) {
+	rotating := &rotatingFile{path: path, maxSize: MaxLogFileSize}
+	if err := rotating.open(); err != nil {
+		return nil, err
+	}
+	return rotating, nil
+}
+
+func (rotating *rotatingFile) open() error {
+	file, err := os.OpenFile(rotating.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	rotating.file = file
+	rotating.size = info.Size()
+	return nil
+}
+
+// Moves the file to its first backup and starts a new one. The mutex must be
+// held.
+func (rotating *rotatingFile) rotate() error {
+	rotating.file.Close()
+	rotating.file = nil
+
+	os.Remove(fmt.Sprintf("%s.%d", rotating.path, MaxLogFileBackups))
+	for backup := MaxLogFileBackups - 1; backup >= 1; backup-- {
+		os.Rename(
+			fmt.Sprintf("%s.%d", rotating.path, backup),
+			fmt.Sprintf("%s.%d", rotating.path, backup+1),
+		)
+	}
+	renameErr := os.Rename(rotating.path, rotating.path+".1")
+
+	if err := rotating.open(); err != nil {
+		return err
+	}
+	return renameErr
+}
+
+func (rotating *rotatingFile) Write(data []byte) (int, error) {
+	rotating.mutex.Lock()
+	defer rotating.mutex.Unlock()
+
+	// A file that can't be rotated keeps growing rather than losing entries.
+	if rotating.size > 0 && rotating.size+int64(len(data)) > rotating.maxSize {
+		if err := rotating.rotate(); err != nil && rotating.file == nil {
+			return 0, err
+		}
+	}
+
+	written, err := rotating.file.Write(data)
+	rotating.size += int64(written)
+	return written, err
+}
+
+func (rotating *rotatingFile) Close() error {
+	rotating.mutex.Lock()
+	defer rotating.mutex.Unlock()
+
+	if rotating.file == nil {
+		return nil
+	}
+	return rotating.file.Close()
+}
@@ -0,0 +1,135 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ie.log")
+	file, err := openRotatingFile(path)
+	if err != nil {
+		t.Fatalf("Failed to open the log file: %s", err)
+	}
+	defer file.Close()
+	file.maxSize = 10
+
+	for entry := 0; entry < MaxLogFileBackups+3; entry++ {
+		if _, err := file.Write([]byte(fmt.Sprintf("entry %d\n", entry))); err != nil {
+			t.Fatalf("Failed to write entry %d: %s", entry, err)
+		}
+	}
+
+	current, _ := os.ReadFile(path)
+	if string(current) != fmt.Sprintf("entry %d\n", MaxLogFileBackups+2) {
+		t.Errorf("Expected the log file to only hold the last entry, got %q", current)
+	}
+
+	latest, _ := os.ReadFile(path + ".1")
+	if string(latest) != fmt.Sprintf("entry %d\n", MaxLogFileBackups+1) {
+		t.Errorf("Expected the first backup to hold the entry before it, got %q", latest)
+	}
+
+	if _, err := os.Stat(fmt.Sprintf("%s.%d", path, MaxLogFileBackups)); err != nil {
+		t.Errorf("Expected %d backups to be kept: %s", MaxLogFileBackups, err)
+	}
+	if _, err := os.Stat(fmt.Sprintf("%s.%d", path, MaxLogFileBackups+1)); !os.IsNotExist(err) {
+		t.Errorf("Expected no more than %d backups to be kept", MaxLogFileBackups)
+	}
+}
+
+func TestPruneRunLogFiles(t *testing.T) {
+	directory := t.TempDir()
+	for _, name := range []string{"20240101T000000Z-aaaaaa.log", "20240102T000000Z-bbbbbb.log", "20240103T000000Z-cccccc.log"} {
+		os.WriteFile(filepath.Join(directory, name), []byte("entry\n"), 0644)
+	}
+	os.WriteFile(filepath.Join(directory, "20240101T000000Z-aaaaaa.log.1"), []byte("entry\n"), 0644)
+
+	pruneRunLogFiles(directory, 2)
+
+	remaining, _ := filepath.Glob(filepath.Join(directory, "*"))
+	if len(remaining) != 2 {
+		t.Fatalf("Expected 2 log files to remain, got %v", remaining)
+	}
+	for _, file := range remaining {
+		if strings.Contains(file, "aaaaaa") {
+			t.Errorf("Expected the oldest run and its backups to be deleted, found %s", file)
+		}
+	}
+}
+
+func TestInit(t *testing.T) {
+	t.Run("Each run logs to a file named after its ID", func(t *testing.T) {
+		stateDirectory := t.TempDir()
+		t.Setenv("XDG_STATE_HOME", stateDirectory)
+
+		if err := Init(Configuration{Level: Info, Format: FormatJson}); err != nil {
+			t.Fatalf("Failed to set up the logs: %s", err)
+		}
+		GlobalLogger.Info("Hello")
+
+		expected := filepath.Join(stateDirectory, "ie", "logs", RunId+".log")
+		if File() != expected {
+			t.Errorf("Expected the logs to be written to %s, got %s", expected, File())
+		}
+
+		content, err := os.ReadFile(expected)
+		if err != nil {
+			t.Fatalf("Failed to read the log file: %s", err)
+		}
+
+		var entry map[string]interface{}
+		if err := json.Unmarshal(content, &entry); err != nil {
+			t.Fatalf("Expected a JSON log entry, got %q: %s", content, err)
+		}
+		if entry["runId"] != RunId || entry["msg"] != "Hello" {
+			t.Errorf("Expected the entry to carry the run ID %s, got %v", RunId, entry)
+		}
+	})
+
+	t.Run("Runs get IDs of their own", func(t *testing.T) {
+		t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+		Init(Configuration{Level: Info})
+		first := RunId
+		Init(Configuration{Level: Info})
+
+		if first == RunId {
+			t.Errorf("Expected a new run ID, got %s twice", RunId)
+		}
+	})
+
+	t.Run("Log files are appended to", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "ie.log")
+		os.WriteFile(path, []byte("previous run\n"), 0644)
+
+		if err := Init(Configuration{Level: Info, Format: FormatText, File: path}); err != nil {
+			t.Fatalf("Failed to set up the logs: %s", err)
+		}
+		GlobalLogger.Info("Hello")
+
+		content, _ := os.ReadFile(path)
+		if !strings.HasPrefix(string(content), "previous run\n") ||
+			!strings.Contains(string(content), "runId="+RunId) {
+			t.Errorf("Expected the entry to be appended with the run ID, got %q", content)
+		}
+	})
+
+	t.Run("Invalid formats and files are rejected", func(t *testing.T) {
+		if err := Init(Configuration{Level: Info, Format: "xml"}); err == nil {
+			t.Error("Expected an invalid format to be rejected")
+		}
+
+		missing := filepath.Join(t.TempDir(), "missing", "ie.log")
+		if err := Init(Configuration{Level: Info, File: missing}); err == nil {
+			t.Error("Expected a log file that can't be created to be rejected")
+		}
+	})
+
+	output.Close()
+	output = nil
+}
@@ -1,7 +1,7 @@
 package logging
 
 import (
-	"os"
+	"fmt"
 
 	"github.com/sirupsen/logrus"
 )
@@ -59,22 +59,86 @@ func LevelFromString(level string) Level {
 
 var GlobalLogger = logrus.New()
 
-func Init(level Level) {
-	GlobalLogger.SetFormatter(&logrus.TextFormatter{
-		DisableColors: false,
-		FullTimestamp: true,
-		DisableQuote:  true,
-	})
+// The formats that log entries are written in.
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJson Format = "json"
+)
+
+// Configuration for the logs of a run.
+type Configuration struct {
+	Level  Level
+	Format Format
+	// The file that the logs are appended to. When it is empty, each run logs
+	// to a file of its own named after its run ID within LogDirectory().
+	File string
+}
+
+// The ID of the current run, which is attached to every log entry.
+var RunId = ""
+
+// The file that the logs of the current run are written to.
+var output *rotatingFile = nil
+
+// Attaches the ID of the run to every log entry, so that the logs of a run can
+// be told apart from others written to the same file.
+type runIdHook struct {
+	runId string
+}
+
+func (hook runIdHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (hook runIdHook) Fire(entry *logrus.Entry) error {
+	entry.Data["runId"] = hook.runId
+	return nil
+}
+
+// Sets up the logs of a run, which gets a new run ID.
+func Init(configuration Configuration) error {
+	switch configuration.Format {
+	case FormatJson:
+		GlobalLogger.SetFormatter(&logrus.JSONFormatter{})
+	case FormatText, "":
+		GlobalLogger.SetFormatter(&logrus.TextFormatter{
+			DisableColors: false,
+			FullTimestamp: true,
+			DisableQuote:  true,
+		})
+	default:
+		return fmt.Errorf(
+			"invalid log format %q, valid options are 'text' and 'json'",
+			configuration.Format,
+		)
+	}
 
 	GlobalLogger.SetReportCaller(false)
-	GlobalLogger.SetLevel(level.Integer())
+	GlobalLogger.SetLevel(configuration.Level.Integer())
 
-	file, err := os.OpenFile("ie.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	RunId = NewRunId()
+	GlobalLogger.ReplaceHooks(make(logrus.LevelHooks))
+	GlobalLogger.AddHook(runIdHook{runId: RunId})
+
+	file, err := openLogFile(configuration.File, RunId)
+	if err != nil {
+		return err
+	}
+
+	if output != nil {
+		output.Close()
+	}
+	output = file
+	GlobalLogger.SetOutput(file)
+	return nil
+}
 
-	if err == nil {
-		GlobalLogger.SetOutput(file)
-	} else {
-		GlobalLogger.SetOutput(os.Stdout)
-		GlobalLogger.Warn("Failed to log to file, using default stderr")
+// Gets the path of the file that the logs of the current run are written to.
+func File() string {
+	if output == nil {
+		return ""
 	}
+	return output.path
 }
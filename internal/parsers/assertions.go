@@ -0,0 +1,127 @@
+package parsers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const assertDirective = "assert"
+
+// The operators that can be used within an output assertion.
+const (
+	AssertionOperatorContains = "contains"
+	AssertionOperatorEquals   = "equals"
+	AssertionOperatorMatches  = "matches"
+)
+
+// The parts of the command output that an assertion can check.
+const (
+	AssertionSourceStdout = "stdout"
+	AssertionSourceStderr = "stderr"
+	AssertionSourceJson   = "json"
+	AssertionSourceStatus = "status"
+	AssertionSourceHeader = "header"
+)
+
+// An assertion about the output of a code block. All of the assertions of a
+// code block must pass for the block to succeed. The syntax is
+//
+//	ie:assert <stdout|stderr|json <path>> [not] <contains|equals|matches> <value>
+//
+// where the value can be quoted to include spaces. The responses of ```http```
+// code blocks can also be checked with the `status` and `header <name>`
+// sources.
+type OutputAssertion struct {
+	Source   string         `json:"source"`
+	Path     string         `json:"path,omitempty"`
+	Negated  bool           `json:"negated"`
+	Operator string         `json:"operator"`
+	Value    string         `json:"value"`
+	Regex    *regexp.Regexp `json:"-"`
+	// The line of the directive within the markdown file.
+	Position SourcePosition `json:"position"`
+}
+
+// Renders the assertion back into the syntax it was parsed from.
+func (assertion OutputAssertion) String() string {
+	var parts []string
+
+	parts = append(parts, assertion.Source)
+	if assertion.Source == AssertionSourceJson || assertion.Source == AssertionSourceHeader {
+		parts = append(parts, assertion.Path)
+	}
+	if assertion.Negated {
+		parts = append(parts, "not")
+	}
+	parts = append(parts, assertion.Operator, strconv.Quote(assertion.Value))
+
+	return strings.Join(parts, " ")
+}
+
+// Parses the arguments of an `ie:assert` directive into an output assertion.
+func ParseOutputAssertion(arguments string) (OutputAssertion, error) {
+	tokens, err := tokenizeDirective(arguments)
+	if err != nil {
+		return OutputAssertion{}, err
+	}
+
+	assertion := OutputAssertion{}
+	if len(tokens) == 0 {
+		return assertion, fmt.Errorf("assertion is empty")
+	}
+
+	assertion.Source = strings.ToLower(tokens[0])
+	tokens = tokens[1:]
+
+	switch assertion.Source {
+	case AssertionSourceStdout, AssertionSourceStderr, AssertionSourceStatus:
+	case AssertionSourceJson, AssertionSourceHeader:
+		if len(tokens) == 0 {
+			return assertion, fmt.Errorf(
+				"%s assertion %q is missing a path",
+				assertion.Source,
+				arguments,
+			)
+		}
+		assertion.Path = tokens[0]
+		tokens = tokens[1:]
+	default:
+		return assertion, fmt.Errorf(
+			"unknown assertion source %q, valid options are 'stdout', 'stderr', 'json', 'status' and 'header'",
+			assertion.Source,
+		)
+	}
+
+	if len(tokens) > 0 && strings.ToLower(tokens[0]) == "not" {
+		assertion.Negated = true
+		tokens = tokens[1:]
+	}
+
+	if len(tokens) != 2 {
+		return assertion, fmt.Errorf(
+			"assertion %q must have an operator followed by a single value",
+			arguments,
+		)
+	}
+
+	assertion.Operator = strings.ToLower(tokens[0])
+	assertion.Value = tokens[1]
+
+	switch assertion.Operator {
+	case AssertionOperatorContains, AssertionOperatorEquals:
+	case AssertionOperatorMatches:
+		assertion.Regex, err = regexp.Compile(assertion.Value)
+		if err != nil {
+			return assertion, fmt.Errorf("cannot compile the regex %q: %w", assertion.Value, err)
+		}
+	default:
+		return assertion, fmt.Errorf(
+			"unknown assertion operator %q, valid options are 'contains', 'equals' and 'matches'",
+			assertion.Operator,
+		)
+	}
+
+	return assertion, nil
+}
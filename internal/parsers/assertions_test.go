@@ -0,0 +1,98 @@
+package parsers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsingOutputAssertions(t *testing.T) {
+	t.Run("Stdout assertion with a quoted value", func(t *testing.T) {
+		assertion, err := ParseOutputAssertion(`stdout contains "Provisioning \"Succeeded\""`)
+		if err != nil {
+			t.Fatalf("Error parsing assertion: %s", err)
+		}
+
+		if assertion.Source != AssertionSourceStdout || assertion.Operator != AssertionOperatorContains {
+			t.Errorf("Assertion is wrong: %+v", assertion)
+		}
+
+		if assertion.Value != `Provisioning "Succeeded"` {
+			t.Errorf("Value is wrong: %q", assertion.Value)
+		}
+	})
+
+	t.Run("Negated JSON assertion", func(t *testing.T) {
+		assertion, err := ParseOutputAssertion(`json $.properties.state not equals Failed`)
+		if err != nil {
+			t.Fatalf("Error parsing assertion: %s", err)
+		}
+
+		if assertion.Path != "$.properties.state" || !assertion.Negated {
+			t.Errorf("Assertion is wrong: %+v", assertion)
+		}
+
+		if assertion.String() != `json $.properties.state not equals "Failed"` {
+			t.Errorf("Assertion rendered incorrectly: %s", assertion.String())
+		}
+	})
+
+	t.Run("Regex assertions are compiled", func(t *testing.T) {
+		assertion, err := ParseOutputAssertion(`stderr not matches "(?i)error"`)
+		if err != nil {
+			t.Fatalf("Error parsing assertion: %s", err)
+		}
+
+		if assertion.Regex == nil || !assertion.Regex.MatchString("ERROR") {
+			t.Errorf("Regex was not compiled: %+v", assertion)
+		}
+	})
+
+	t.Run("Invalid assertions", func(t *testing.T) {
+		invalid := []string{
+			``,
+			`stdin contains foo`,
+			`json`,
+			`stdout startswith foo`,
+			`stdout contains`,
+			`stdout contains "unterminated`,
+			`stdout matches "("`,
+		}
+
+		for _, arguments := range invalid {
+			if _, err := ParseOutputAssertion(arguments); err == nil {
+				t.Errorf("Expected an error parsing %q", arguments)
+			}
+		}
+	})
+}
+
+func TestParsingMarkdownAssertions(t *testing.T) {
+	markdown := []byte("```bash\necho hello\n```\n\n" +
+		"<!--\nie:assert stdout contains hello\nie:assert stderr not contains \"error\"\nie:assert stdout invalid\n-->\n\n" +
+		"<!--expected_similarity=0.8-->\n```text\nhello\n```\n")
+
+	document := ParseMarkdownIntoAst(markdown)
+	codeBlocks, err := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+
+	// Invalid assertions are reported rather than silently dropped.
+	if err == nil || !strings.Contains(err.Error(), "line 8: Invalid assertion") {
+		t.Errorf("Expected the invalid assertion on line 8 to be reported, got %v", err)
+	}
+
+	if len(codeBlocks) != 1 {
+		t.Fatalf("Code block count is wrong: %d", len(codeBlocks))
+	}
+
+	assertions := codeBlocks[0].Assertions
+	if len(assertions) != 2 {
+		t.Fatalf("Assertion count is wrong: %d", len(assertions))
+	}
+
+	if assertions[1].Source != AssertionSourceStderr || !assertions[1].Negated {
+		t.Errorf("Assertion is wrong: %+v", assertions[1])
+	}
+
+	if codeBlocks[0].ExpectedOutput.ExpectedSimilarity != 0.8 {
+		t.Errorf("Expected output was not attached: %+v", codeBlocks[0].ExpectedOutput)
+	}
+}
@@ -0,0 +1,263 @@
+package parsers
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The prefix for directives that are embedded in HTML comments, I.E.
+// `<!-- ie:assert stdout contains "Succeeded" -->`.
+const directivePrefix = "ie:"
+
+const (
+	waitUntilDirective  = "wait-until"
+	backgroundDirective = "background"
+)
+
+// The defaults used when a wait-until directive doesn't specify an interval
+// or a timeout.
+const (
+	DefaultWaitInterval = 10 * time.Second
+	DefaultWaitTimeout  = 5 * time.Minute
+)
+
+// Configures a code block to be executed repeatedly until its expected output
+// and assertions pass, or until the timeout is reached. The syntax is
+//
+//	ie:wait-until interval=10s timeout=10m
+type WaitCondition struct {
+	Interval time.Duration `json:"interval"`
+	Timeout  time.Duration `json:"timeout"`
+	// The line of the directive within the markdown file.
+	Position SourcePosition `json:"position"`
+}
+
+// Parses the arguments of an `ie:wait-until` directive into a wait condition.
+func ParseWaitCondition(arguments string) (WaitCondition, error) {
+	condition := WaitCondition{
+		Interval: DefaultWaitInterval,
+		Timeout:  DefaultWaitTimeout,
+	}
+
+	for key, value := range parseCommentAttributes(arguments) {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return condition, fmt.Errorf("invalid duration for %s: %q", key, value)
+		}
+
+		switch key {
+		case "interval":
+			condition.Interval = duration
+		case "timeout":
+			condition.Timeout = duration
+		default:
+			return condition, fmt.Errorf(
+				"unknown wait-until attribute %q, valid options are 'interval' and 'timeout'",
+				key,
+			)
+		}
+	}
+
+	if condition.Interval <= 0 {
+		return condition, fmt.Errorf("the wait-until interval must be positive")
+	}
+
+	if condition.Timeout < condition.Interval {
+		return condition, fmt.Errorf(
+			"the wait-until timeout %s must be at least the interval %s",
+			condition.Timeout,
+			condition.Interval,
+		)
+	}
+
+	return condition, nil
+}
+
+// The default time to wait for a background process to become ready.
+const DefaultReadinessTimeout = 60 * time.Second
+
+// Marks a code block as a process that keeps running in the background, such as
+// a local server. The code block is considered done once any of its readiness
+// conditions are met, and the process is terminated when the scenario ends. The
+// syntax is
+//
+//	ie:background ready_regex="Listening on" ready_port=3000 ready_file=/tmp/ready timeout=60s
+//
+// When no readiness condition is set, the process is ready as soon as it
+// starts.
+type BackgroundProcess struct {
+	ReadyRegex   *regexp.Regexp `json:"readyRegex,omitempty"`
+	ReadyAddress string         `json:"readyAddress,omitempty"`
+	ReadyFile    string         `json:"readyFile,omitempty"`
+	Timeout      time.Duration  `json:"timeout"`
+	// The line of the directive within the markdown file.
+	Position SourcePosition `json:"position"`
+}
+
+// Parses the arguments of an `ie:background` directive.
+func ParseBackgroundProcess(arguments string) (BackgroundProcess, error) {
+	process := BackgroundProcess{Timeout: DefaultReadinessTimeout}
+
+	var err error
+	for key, value := range parseCommentAttributes(arguments) {
+		switch key {
+		case "ready_regex":
+			process.ReadyRegex, err = regexp.Compile(value)
+			if err != nil {
+				return process, fmt.Errorf("cannot compile the regex %q: %w", value, err)
+			}
+		case "ready_port":
+			process.ReadyAddress = value
+			if !strings.Contains(value, ":") {
+				process.ReadyAddress = net.JoinHostPort("localhost", value)
+			}
+
+			if _, port, err := net.SplitHostPort(process.ReadyAddress); err != nil || port == "" {
+				return process, fmt.Errorf("invalid value for ready_port: %q", value)
+			}
+		case "ready_file":
+			process.ReadyFile = value
+		case "timeout":
+			process.Timeout, err = time.ParseDuration(value)
+			if err != nil || process.Timeout <= 0 {
+				return process, fmt.Errorf("invalid duration for timeout: %q", value)
+			}
+		default:
+			return process, fmt.Errorf(
+				"unknown background attribute %q, valid options are 'ready_regex', 'ready_port', 'ready_file' and 'timeout'",
+				key,
+			)
+		}
+	}
+
+	return process, nil
+}
+
+// Splits the arguments of a directive on whitespace. Double quoted arguments
+// can contain whitespace and use Go escape sequences (I.E. `\"`).
+func tokenizeDirective(arguments string) ([]string, error) {
+	var tokens []string
+	remaining := strings.TrimSpace(arguments)
+
+	for remaining != "" {
+		if remaining[0] == '"' {
+			end := 1
+			for ; end < len(remaining); end++ {
+				if remaining[end] == '\\' {
+					end++
+					continue
+				}
+				if remaining[end] == '"' {
+					break
+				}
+			}
+
+			if end >= len(remaining) {
+				return nil, fmt.Errorf("unterminated quote in %q", arguments)
+			}
+
+			token, err := strconv.Unquote(remaining[:end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted value %s: %w", remaining[:end+1], err)
+			}
+			tokens = append(tokens, token)
+			remaining = strings.TrimSpace(remaining[end+1:])
+			continue
+		}
+
+		end := strings.IndexAny(remaining, " \t")
+		if end == -1 {
+			end = len(remaining)
+		}
+		tokens = append(tokens, remaining[:end])
+		remaining = strings.TrimSpace(remaining[end:])
+	}
+
+	return tokens, nil
+}
+
+// A directive found within an HTML comment, such as `ie:assert`.
+type commentDirective struct {
+	name      string
+	arguments string
+	// The line of the directive within the comment, starting at 0.
+	line int
+	// The line of the directive within the markdown file, which is only known
+	// once the comment is part of a document.
+	position SourcePosition
+}
+
+// Extracts the `ie:` directives from an HTML comment. Each directive must be
+// on its own line.
+func extractCommentDirectives(comment string) []commentDirective {
+	var directives []commentDirective
+	for index, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimPrefix(line, "<!--")
+		line = strings.TrimSuffix(line, "-->")
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, directivePrefix) {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, directivePrefix)
+		name, arguments, _ := strings.Cut(line, " ")
+		directives = append(directives, commentDirective{
+			name:      name,
+			arguments: strings.TrimSpace(arguments),
+			line:      index,
+		})
+	}
+
+	return directives
+}
+
+// Applies a directive to the code block that precedes it.
+func applyCommentDirective(codeBlock *CodeBlock, directive commentDirective) error {
+	switch directive.name {
+	case assertDirective:
+		assertion, err := ParseOutputAssertion(directive.arguments)
+		if err != nil {
+			return fmt.Errorf("Invalid assertion: %w", err)
+		}
+		assertion.Position = directive.position
+		codeBlock.Assertions = append(codeBlock.Assertions, assertion)
+	case waitUntilDirective:
+		condition, err := ParseWaitCondition(directive.arguments)
+		if err != nil {
+			return fmt.Errorf("Invalid wait-until directive: %w", err)
+		}
+		condition.Position = directive.position
+		codeBlock.WaitUntil = &condition
+	case backgroundDirective:
+		process, err := ParseBackgroundProcess(directive.arguments)
+		if err != nil {
+			return fmt.Errorf("Invalid background directive: %w", err)
+		}
+		process.Position = directive.position
+		codeBlock.Background = &process
+	default:
+		return fmt.Errorf("Unknown directive: %s%s", directivePrefix, directive.name)
+	}
+
+	return nil
+}
+
+// Checks the directives within an HTML comment, returning whether the comment
+// contains any directives along with an error for each invalid directive.
+func ValidateCommentDirectives(comment string) (bool, []error) {
+	directives := extractCommentDirectives(comment)
+
+	var errs []error
+	for _, directive := range directives {
+		if err := applyCommentDirective(&CodeBlock{}, directive); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return len(directives) > 0, errs
+}
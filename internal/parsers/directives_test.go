@@ -0,0 +1,119 @@
+package parsers
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsingWaitConditions(t *testing.T) {
+	t.Run("Interval and timeout", func(t *testing.T) {
+		condition, err := ParseWaitCondition("interval=10s timeout=10m")
+		if err != nil {
+			t.Fatalf("Error parsing wait condition: %s", err)
+		}
+
+		if condition.Interval != 10*time.Second || condition.Timeout != 10*time.Minute {
+			t.Errorf("Wait condition is wrong: %+v", condition)
+		}
+	})
+
+	t.Run("Defaults", func(t *testing.T) {
+		condition, err := ParseWaitCondition("")
+		if err != nil {
+			t.Fatalf("Error parsing wait condition: %s", err)
+		}
+
+		if condition.Interval != DefaultWaitInterval || condition.Timeout != DefaultWaitTimeout {
+			t.Errorf("Wait condition is wrong: %+v", condition)
+		}
+	})
+
+	t.Run("Invalid conditions", func(t *testing.T) {
+		invalid := []string{
+			"interval=soon",
+			"interval=0s",
+			"interval=1m timeout=30s",
+			"retries=3",
+		}
+
+		for _, arguments := range invalid {
+			if _, err := ParseWaitCondition(arguments); err == nil {
+				t.Errorf("Expected an error parsing %q", arguments)
+			}
+		}
+	})
+
+	t.Run("Wait conditions are attached to the previous code block", func(t *testing.T) {
+		markdown := []byte("```bash\ncurl -s http://localhost\n```\n\n" +
+			"<!-- ie:wait-until interval=5s timeout=1m -->\n\n" +
+			"<!--expected_similarity=0.8-->\n```text\nhello\n```\n")
+
+		document := ParseMarkdownIntoAst(markdown)
+		codeBlocks, err := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+		if err != nil {
+			t.Fatalf("Error extracting code blocks: %s", err)
+		}
+
+		if len(codeBlocks) != 1 || codeBlocks[0].WaitUntil == nil {
+			t.Fatalf("Wait condition was not attached: %+v", codeBlocks)
+		}
+
+		if codeBlocks[0].WaitUntil.Interval != 5*time.Second {
+			t.Errorf("Wait condition is wrong: %+v", codeBlocks[0].WaitUntil)
+		}
+	})
+
+	t.Run("Malformed wait conditions are reported", func(t *testing.T) {
+		markdown := []byte("```bash\ncurl -s http://localhost\n```\n\n" +
+			"<!-- ie:wait-until interval=soon -->\n")
+
+		document := ParseMarkdownIntoAst(markdown)
+		codeBlocks, err := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+
+		if err == nil || !strings.Contains(err.Error(), "line 5: Invalid wait-until directive") {
+			t.Errorf("Expected the wait condition on line 5 to be reported, got %v", err)
+		}
+		if len(codeBlocks) != 1 || codeBlocks[0].WaitUntil != nil {
+			t.Errorf("Expected the wait condition not to be attached: %+v", codeBlocks)
+		}
+	})
+}
+
+func TestParsingBackgroundProcesses(t *testing.T) {
+	t.Run("Readiness conditions", func(t *testing.T) {
+		process, err := ParseBackgroundProcess(
+			`ready_regex="Listening on \d+" ready_port=3000 ready_file=/tmp/ready timeout=2m`,
+		)
+		if err != nil {
+			t.Fatalf("Error parsing background process: %s", err)
+		}
+
+		if process.ReadyRegex == nil || !process.ReadyRegex.MatchString("Listening on 3000") {
+			t.Errorf("Ready regex is wrong: %v", process.ReadyRegex)
+		}
+
+		if process.ReadyAddress != "localhost:3000" {
+			t.Errorf("Ready address is wrong: %s", process.ReadyAddress)
+		}
+
+		if process.ReadyFile != "/tmp/ready" || process.Timeout != 2*time.Minute {
+			t.Errorf("Background process is wrong: %+v", process)
+		}
+	})
+
+	t.Run("Invalid background processes", func(t *testing.T) {
+		invalid := []string{
+			`ready_regex="("`,
+			`ready_port=localhost:`,
+			`timeout=forever`,
+			`ready_url=http://localhost`,
+		}
+
+		for _, arguments := range invalid {
+			if _, err := ParseBackgroundProcess(arguments); err == nil {
+				t.Errorf("Expected an error parsing %q", arguments)
+			}
+		}
+	})
+}
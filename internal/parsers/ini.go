@@ -2,10 +2,24 @@ package parsers
 
 import (
 	"fmt"
+	"os"
+	"strings"
 
+	"github.com/Azure/InnovationEngine/internal/logging"
 	"gopkg.in/ini.v1"
 )
 
+// The section of an INI file that the other sections are layered on top of.
+// Keys that come before the first section belong to it too.
+const DefaultINISection = "default"
+
+// A variable of an INI file along with the section and line that set it.
+type INIVariable struct {
+	Value   string
+	Section string
+	Line    int
+}
+
 // Parses an INI file into a flat map of keys mapped to values. This reduces
 // the complexity of the INI file to a simple key/value store and ignores the
 // sections.
@@ -25,3 +39,107 @@ func ParseINIFile(filePath string) (map[string]string, error) {
 	}
 	return data, nil
 }
+
+// Parses an INI file whose sections are profiles into the variables of a
+// profile. The keys of the default section are layered with the keys of the
+// selected section, which win when both set a key, and the other sections are
+// ignored. Files without a [default] section predate profiles, so when no
+// section is selected the keys of all their sections are used, the same way
+// ParseINIFile flattens them.
+func ParseINIProfile(filePath string, section string) (map[string]INIVariable, error) {
+	iniFile, err := ini.Load(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the INI file %s because %v", filePath, err)
+	}
+
+	lines, err := FindINISectionKeyLines(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var sections []string
+	switch {
+	case section == "" && !iniFile.HasSection(DefaultINISection):
+		sections = iniFile.SectionStrings()
+		if len(sections) > 2 {
+			logging.GlobalLogger.Warnf(
+				"The INI file %s has no [%s] section, so the keys of all of its sections are used. "+
+					"Add a [%s] section to select the others with --var-profile.",
+				filePath,
+				DefaultINISection,
+				DefaultINISection,
+			)
+		}
+	case section == "" || section == DefaultINISection:
+		sections = []string{ini.DefaultSection, DefaultINISection}
+	default:
+		if !iniFile.HasSection(section) {
+			return nil, fmt.Errorf("the INI file %s has no [%s] section", filePath, section)
+		}
+		sections = []string{ini.DefaultSection, DefaultINISection, section}
+	}
+
+	data := make(map[string]INIVariable)
+	for _, name := range sections {
+		iniSection, err := iniFile.GetSection(name)
+		if err != nil {
+			continue
+		}
+
+		for key, value := range iniSection.KeysHash() {
+			data[key] = INIVariable{
+				Value:   value,
+				Section: iniSectionName(name),
+				Line:    lines[name][key],
+			}
+		}
+	}
+	return data, nil
+}
+
+// Keys that come before the first section are reported as belonging to the
+// default section.
+func iniSectionName(section string) string {
+	if section == ini.DefaultSection {
+		return DefaultINISection
+	}
+	return section
+}
+
+// Finds the line each key of an INI file is declared on within each section,
+// starting at 1. Keys that come before the first section are within
+// ini.DefaultSection. Keys declared more than once within a section keep
+// their last line, matching the value returned by ParseINIProfile.
+func FindINISectionKeyLines(filePath string) (map[string]map[string]int, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the INI file %s because %v", filePath, err)
+	}
+
+	section := ini.DefaultSection
+	lines := map[string]map[string]int{section: {}}
+	for index, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if end := strings.Index(line, "]"); end > 0 {
+				section = strings.TrimSpace(line[1:end])
+				if _, ok := lines[section]; !ok {
+					lines[section] = make(map[string]int)
+				}
+			}
+			continue
+		}
+
+		separator := strings.IndexAny(line, "=:")
+		if separator <= 0 {
+			continue
+		}
+		lines[section][strings.TrimSpace(line[:separator])] = index + 1
+	}
+
+	return lines, nil
+}
@@ -39,3 +39,74 @@ func TestParsingINIFiles(t *testing.T) {
 	})
 
 }
+
+func TestParsingINIProfiles(t *testing.T) {
+	path := t.TempDir() + "/test.ini"
+	contents := "NAME = unsectioned\n[default]\nREGION = eastus\nSIZE = small\n[westus]\nREGION = westus\n[ci]\nSIZE = large\n"
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("The default section is used alone without a selection", func(t *testing.T) {
+		data, err := ParseINIProfile(path, "")
+		if err != nil {
+			t.Fatalf("Error parsing INI file: %s", err)
+		}
+		if len(data) != 3 || data["REGION"].Value != "eastus" || data["SIZE"].Value != "small" {
+			t.Errorf("Expected only the default section to be used, got %v", data)
+		}
+		if data["NAME"].Section != DefaultINISection || data["NAME"].Line != 1 {
+			t.Errorf("Expected keys before the first section to belong to the default section, got %v", data["NAME"])
+		}
+	})
+
+	t.Run("The selected section is layered on top of default", func(t *testing.T) {
+		data, err := ParseINIProfile(path, "westus")
+		if err != nil {
+			t.Fatalf("Error parsing INI file: %s", err)
+		}
+		expected := INIVariable{Value: "westus", Section: "westus", Line: 6}
+		if data["REGION"] != expected {
+			t.Errorf("Expected the section to be layered on top of default, got %v", data["REGION"])
+		}
+		if data["SIZE"] != (INIVariable{Value: "small", Section: DefaultINISection, Line: 4}) {
+			t.Errorf("Expected the keys of default to be kept, got %v", data["SIZE"])
+		}
+
+		if _, err := ParseINIProfile(path, "eastus"); err == nil {
+			t.Error("Expected a section that doesn't exist to be rejected")
+		}
+	})
+
+	t.Run("Files without a default section are flattened", func(t *testing.T) {
+		legacyPath := t.TempDir() + "/legacy.ini"
+		if err := os.WriteFile(legacyPath, []byte("[azure]\nREGION = eastus\nSIZE = small\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := ParseINIProfile(legacyPath, "")
+		if err != nil {
+			t.Fatalf("Error parsing INI file: %s", err)
+		}
+		if data["REGION"] != (INIVariable{Value: "eastus", Section: "azure", Line: 2}) || len(data) != 2 {
+			t.Errorf("Expected the keys of every section to be used, got %v", data)
+		}
+	})
+}
+
+func TestFindingINISectionKeyLines(t *testing.T) {
+	path := t.TempDir() + "/test.ini"
+	contents := "; comment\n[section]\nNAME = first\n\nREGION: eastus\n[other]\nNAME=second\n"
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lines, err := FindINISectionKeyLines(path)
+	if err != nil {
+		t.Fatalf("Expected err to be nil, got %v", err)
+	}
+
+	if lines["section"]["NAME"] != 3 || lines["section"]["REGION"] != 5 || lines["other"]["NAME"] != 7 {
+		t.Errorf("Lines are wrong: %v", lines)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
 	"github.com/yuin/goldmark"
 	meta "github.com/yuin/goldmark-meta"
@@ -34,6 +35,10 @@ func ParseMarkdownIntoAst(source []byte) ast.Node {
 	return document
 }
 
+// The YAML metadata property used to set the default similarity algorithm for
+// every expected output within a scenario.
+const SimilarityAlgorithmProperty = "similarity_algorithm"
+
 // Extract the metadata from the AST of a markdown document.
 func ExtractYamlMetadataFromAst(node ast.Node) map[string]interface{} {
 	return node.OwnerDocument().Meta()
@@ -43,10 +48,15 @@ func ExtractYamlMetadataFromAst(node ast.Node) map[string]interface{} {
 // for scenarios that have expected output that should be validated against the
 // actual output.
 type ExpectedOutputBlock struct {
-	Language           string         `json:"language"`
-	Content            string         `json:"content"`
-	ExpectedSimilarity float64        `json:"expectedSimilarityScore"`
-	ExpectedRegex      *regexp.Regexp `json:"expectedRegexPattern"`
+	Language            string         `json:"language"`
+	Content             string         `json:"content"`
+	ExpectedSimilarity  float64        `json:"expectedSimilarityScore"`
+	ExpectedRegex       *regexp.Regexp `json:"expectedRegexPattern"`
+	IgnorePaths         []string       `json:"ignorePaths"`
+	UnorderedArrays     bool           `json:"unorderedArrays"`
+	SimilarityAlgorithm string         `json:"similarityAlgorithm"`
+	// The position of the code block holding the expected output.
+	Position SourcePosition `json:"position"`
 }
 
 // The representation of a code block in a markdown file.
@@ -56,6 +66,54 @@ type CodeBlock struct {
 	Header         string              `json:"header"`
 	Description    string              `json:"description"`
 	ExpectedOutput ExpectedOutputBlock `json:"resultBlock"`
+	Assertions     []OutputAssertion   `json:"assertions"`
+	WaitUntil      *WaitCondition      `json:"waitUntil,omitempty"`
+	Background     *BackgroundProcess  `json:"background,omitempty"`
+	Attributes     map[string]string   `json:"attributes,omitempty"`
+	File           *FileTarget         `json:"file,omitempty"`
+	// The file is only known once the code block is part of a scenario.
+	Position SourcePosition `json:"position"`
+}
+
+// The file that a code block is written to instead of being executed, declared
+// with the `file` attribute, I.E. ```yaml file=deployment.yaml```.
+type FileTarget struct {
+	// The path of the file, relative to the current working directory of the
+	// scenario unless it is absolute.
+	Path string `json:"path"`
+	// Whether environment variables within the content of the code block are
+	// expanded before it is written, declared with `expand=true`.
+	ExpandVariables bool `json:"expandVariables"`
+}
+
+// Attributes of a code block that writes its content to a file.
+const (
+	fileAttribute   = "file"
+	expandAttribute = "expand"
+)
+
+// Parses the file target of a code block from its attributes, returning nil if
+// the code block isn't written to a file.
+func ParseFileTarget(attributes map[string]string) (*FileTarget, error) {
+	path, ok := attributes[fileAttribute]
+	if !ok {
+		return nil, nil
+	}
+
+	if strings.TrimSpace(path) == "" {
+		return nil, errors.New("the file attribute requires a path")
+	}
+
+	target := FileTarget{Path: path}
+	if expand, ok := attributes[expandAttribute]; ok {
+		value, err := strconv.ParseBool(expand)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %q", expandAttribute, expand)
+		}
+		target.ExpandVariables = value
+	}
+
+	return &target, nil
 }
 
 // Assumes the title of the scenario is the first h1 header in the
@@ -86,18 +144,145 @@ var expectedSimilarityRegex = regexp.MustCompile(
 	`<!--\s*expected_similarity=\s*(\d+\.?\d*)|"(.*)"\s*-->`,
 )
 
+// Matches the additional key/value attributes that can follow the
+// expected_similarity score, I.E. `ignore_paths="$.id,$..etag"`.
+var commentAttributeRegex = regexp.MustCompile(`(\w+)\s*=\s*(?:"([^"]*)"|([^\s"]+))`)
+
+// Parses the key/value attributes contained within an HTML comment.
+func parseCommentAttributes(comment string) map[string]string {
+	comment = strings.TrimSpace(comment)
+	comment = strings.TrimPrefix(comment, "<!--")
+	comment = strings.TrimSuffix(comment, "-->")
+
+	attributes := make(map[string]string)
+	for _, match := range commentAttributeRegex.FindAllStringSubmatch(comment, -1) {
+		if match[2] != "" {
+			attributes[match[1]] = match[2]
+		} else {
+			attributes[match[1]] = match[3]
+		}
+	}
+
+	return attributes
+}
+
+// How the expected output that follows an expected_similarity comment is
+// compared to the actual output. Comments either declare a similarity score
+// along with its attributes or a regex.
+type expectedOutputComment struct {
+	similarity          float64
+	ignorePaths         []string
+	unorderedArrays     *bool
+	similarityAlgorithm string
+	regex               *regexp.Regexp
+}
+
+// Parses an HTML comment that declares how the expected output that follows it
+// is compared, returning nil if the comment doesn't declare one.
+func parseExpectedOutputComment(content string) (*expectedOutputComment, error) {
+	matches := expectedSimilarityRegex.FindStringSubmatch(content)
+	if len(matches) < 3 {
+		return nil, nil
+	}
+
+	var comment expectedOutputComment
+	if match := matches[1]; match != "" {
+		score, err := strconv.ParseFloat(match, 64)
+		if err != nil {
+			return nil, err
+		}
+		comment.similarity = score
+
+		attributes := parseCommentAttributes(content)
+		if ignorePaths, ok := attributes["ignore_paths"]; ok {
+			comment.ignorePaths = splitAttributeList(ignorePaths)
+		}
+		if unorderedArrays, ok := attributes["unordered_arrays"]; ok {
+			value, err := strconv.ParseBool(unorderedArrays)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"Invalid value for unordered_arrays: %q",
+					unorderedArrays,
+				)
+			}
+			comment.unorderedArrays = &value
+		}
+		if algorithm, ok := attributes["similarity_algorithm"]; ok {
+			if _, err := lib.ParseSimilarityAlgorithm(algorithm); err != nil {
+				return nil, err
+			}
+			comment.similarityAlgorithm = algorithm
+		}
+		return &comment, nil
+	}
+
+	match := matches[2]
+	if match == "" {
+		return nil, errors.New("No regex found")
+	}
+
+	re, err := regexp.Compile(match)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot compile the following regex: %q", match)
+	}
+	comment.regex = re
+
+	return &comment, nil
+}
+
+// Checks whether an HTML comment declares how the expected output that follows
+// it is compared, returning an error if the declaration is invalid.
+func ValidateExpectedOutputComment(content string) (bool, error) {
+	comment, err := parseExpectedOutputComment(content)
+	return comment != nil || err != nil, err
+}
+
+// Extracts the attributes that follow the language in the info string of a
+// fenced code block, I.E. ```http timeout=10s retries=3```.
+func ExtractCodeBlockAttributes(block *ast.FencedCodeBlock, source []byte) map[string]string {
+	if block.Info == nil {
+		return nil
+	}
+
+	info := string(block.Info.Segment.Value(source))
+	_, attributes, found := strings.Cut(strings.TrimSpace(info), " ")
+	if !found {
+		return nil
+	}
+
+	return parseCommentAttributes(attributes)
+}
+
+// Splits a comma separated attribute value into its trimmed, non-empty parts.
+func splitAttributeList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // Extracts the code blocks from a provided markdown AST that match the
-// languagesToExtract.
+// languagesToExtract. Directives and expected_similarity comments that can't
+// be parsed are reported in the error, along with their line, so that a typo
+// doesn't silently drop an assertion.
 func ExtractCodeBlocksFromAst(
 	node ast.Node,
 	source []byte,
 	languagesToExtract []string,
-) []CodeBlock {
+) ([]CodeBlock, error) {
+	var errs []error
 	var lastHeader string
 	var commands []CodeBlock
 	var nextBlockIsExpectedOutput bool
 	var lastExpectedSimilarityScore float64
 	var lastExpectedRegex *regexp.Regexp
+	var lastIgnorePaths []string
+	var lastUnorderedArrays bool
+	var lastSimilarityAlgorithm string
 	var lastNode ast.Node
 	var currentParagraphs string
 
@@ -117,34 +302,55 @@ func ExtractCodeBlocksFromAst(
 			// Extract the code block if it matches the language.
 			case *ast.HTMLBlock:
 				content := extractTextFromMarkdown(&n.BaseBlock, source)
-				matches := expectedSimilarityRegex.FindStringSubmatch(content)
 
-				if len(matches) < 3 {
+				// Directives apply to the code block that precedes them and
+				// must be handled before the expected_similarity comments.
+				if directives := extractCommentDirectives(content); len(directives) > 0 {
+					if len(commands) == 0 {
+						logging.GlobalLogger.Warnf(
+							"Ignoring the directives in %q because there is no code block before them",
+							content,
+						)
+						break
+					}
+
+					lastCommand := &commands[len(commands)-1]
+					commentLine := NodeStartLine(n, source)
+					for _, directive := range directives {
+						directive.position = SourcePosition{
+							StartLine: commentLine + directive.line,
+							EndLine:   commentLine + directive.line,
+						}
+						if err := applyCommentDirective(lastCommand, directive); err != nil {
+							logging.GlobalLogger.Errorf("%s", err)
+							errs = append(errs, fmt.Errorf("line %d: %w", directive.position.StartLine, err))
+						}
+					}
 					break
 				}
 
-				match := matches[1]
-				if match != "" {
-					score, err := strconv.ParseFloat(match, 64)
-					logging.GlobalLogger.Debugf("Simalrity score of %f found", score)
-					if err != nil {
-						return ast.WalkStop, err
-					}
-					lastExpectedSimilarityScore = score
-				} else {
-					match = matches[2]
-					logging.GlobalLogger.Debugf("Regex %q found", match)
+				comment, err := parseExpectedOutputComment(content)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("line %d: %w", NodeStartLine(n, source), err))
+					break
+				}
+				if comment == nil {
+					break
+				}
 
-					if match == "" {
-						return ast.WalkStop, errors.New("No regex found")
+				if comment.regex != nil {
+					logging.GlobalLogger.Debugf("Regex %q found", comment.regex)
+					lastExpectedRegex = comment.regex
+				} else {
+					logging.GlobalLogger.Debugf("Simalrity score of %f found", comment.similarity)
+					lastExpectedSimilarityScore = comment.similarity
+					if comment.ignorePaths != nil {
+						lastIgnorePaths = comment.ignorePaths
 					}
-
-					re, err := regexp.Compile(match)
-					if err != nil {
-						return ast.WalkStop, fmt.Errorf("Cannot compile the following regex: %q", match)
+					if comment.unorderedArrays != nil {
+						lastUnorderedArrays = *comment.unorderedArrays
 					}
-
-					lastExpectedRegex = re
+					lastSimilarityAlgorithm = comment.similarityAlgorithm
 				}
 
 				nextBlockIsExpectedOutput = true
@@ -166,6 +372,29 @@ func ExtractCodeBlocksFromAst(
 
 				currentParagraphs = ""
 				lastNode = node
+
+				// Code blocks that are written to a file are extracted
+				// regardless of their language.
+				attributes := ExtractCodeBlockAttributes(n, source)
+				file, err := ParseFileTarget(attributes)
+				if err != nil {
+					logging.GlobalLogger.Errorf("Invalid file attribute on the code block `%s`: %s", content, err)
+					errs = append(errs, fmt.Errorf("line %d: %w", fencedCodeBlockPosition(n, source).StartLine, err))
+					break
+				}
+				if file != nil {
+					commands = append(commands, CodeBlock{
+						Language:    language,
+						Content:     content,
+						Header:      lastHeader,
+						Description: description,
+						Attributes:  attributes,
+						File:        file,
+						Position:    fencedCodeBlockPosition(n, source),
+					})
+					break
+				}
+
 				for _, desiredLanguage := range languagesToExtract {
 					if language == desiredLanguage {
 						command := CodeBlock{
@@ -173,6 +402,8 @@ func ExtractCodeBlocksFromAst(
 							Content:     content,
 							Header:      lastHeader,
 							Description: description,
+							Attributes:  attributes,
+							Position:    fencedCodeBlockPosition(n, source),
 						}
 						commands = append(commands, command)
 						break
@@ -181,10 +412,14 @@ func ExtractCodeBlocksFromAst(
 						// are no commands, then we ignore the expected output.
 						if len(commands) > 0 {
 							expectedOutputBlock := ExpectedOutputBlock{
-								Language:           language,
-								Content:            extractTextFromMarkdown(&n.BaseBlock, source),
-								ExpectedSimilarity: lastExpectedSimilarityScore,
-								ExpectedRegex:      lastExpectedRegex,
+								Language:            language,
+								Content:             extractTextFromMarkdown(&n.BaseBlock, source),
+								ExpectedSimilarity:  lastExpectedSimilarityScore,
+								ExpectedRegex:       lastExpectedRegex,
+								IgnorePaths:         lastIgnorePaths,
+								UnorderedArrays:     lastUnorderedArrays,
+								SimilarityAlgorithm: lastSimilarityAlgorithm,
+								Position:            fencedCodeBlockPosition(n, source),
 							}
 							commands[len(commands)-1].ExpectedOutput = expectedOutputBlock
 
@@ -192,6 +427,9 @@ func ExtractCodeBlocksFromAst(
 							nextBlockIsExpectedOutput = false
 							lastExpectedSimilarityScore = 0
 							lastExpectedRegex = nil
+							lastIgnorePaths = nil
+							lastUnorderedArrays = false
+							lastSimilarityAlgorithm = ""
 						}
 						break
 					}
@@ -201,36 +439,71 @@ func ExtractCodeBlocksFromAst(
 		return ast.WalkContinue, nil
 	})
 
-	return commands
+	return commands, errors.Join(errs...)
 }
 
-// This regex matches HTML comments within markdown blocks that contain
-// variables to use within the scenario.
-var variableCommentBlockRegex = regexp.MustCompile("(?s)<!--.*?```variables(.*?)```.*?")
+// A variable declared by an `export` statement within a ```variables```
+// comment.
+type VariableDeclaration struct {
+	Name  string
+	Value string
+	// The line of the markdown file the variable is declared on.
+	Line int
+}
 
 // Extracts the variables from a provided markdown AST.
 func ExtractScenarioVariablesFromAst(node ast.Node, source []byte) map[string]string {
 	scenarioVariables := make(map[string]string)
+	for _, declaration := range ExtractScenarioVariableDeclarationsFromAst(node, source) {
+		scenarioVariables[declaration.Name] = declaration.Value
+	}
+	return scenarioVariables
+}
+
+// Extracts the variables from a provided markdown AST along with the lines
+// they are declared on, in the order they are declared.
+func ExtractScenarioVariableDeclarationsFromAst(node ast.Node, source []byte) []VariableDeclaration {
+	var declarations []VariableDeclaration
 
 	ast.Walk(node, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
 		if entering && node.Kind() == ast.KindHTMLBlock {
 			htmlNode := node.(*ast.HTMLBlock)
 			blockContent := extractTextFromMarkdown(&htmlNode.BaseBlock, source)
 			logging.GlobalLogger.Debugf("Found HTML block with the content: %s\n", blockContent)
-			match := variableCommentBlockRegex.FindStringSubmatch(blockContent)
+			if !strings.Contains(blockContent, "<!--") {
+				return ast.WalkContinue, nil
+			}
+
+			// Extract the variables from the lines between the opening
+			// ```variables fence and the closing fence of the comment.
+			inVariables := false
+			lines := htmlNode.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				segment := lines.At(i)
+				line := strings.TrimSuffix(string(segment.Value(source)), "\n")
+
+				if !inVariables {
+					inVariables = strings.Contains(line, "```variables")
+					continue
+				}
+				if strings.Contains(line, "```") {
+					inVariables = false
+					continue
+				}
 
-			// Extract the variables from the comment block.
-			if len(match) > 1 {
-				variables := convertScenarioVariablesToMap(match[1])
-				for key, value := range variables {
-					scenarioVariables[key] = value
+				if name, value, ok := parseVariableExport(line); ok {
+					declarations = append(declarations, VariableDeclaration{
+						Name:  name,
+						Value: value,
+						Line:  lineAtOffset(source, segment.Start),
+					})
 				}
 			}
 		}
 		return ast.WalkContinue, nil
 	})
 
-	return scenarioVariables
+	return declarations
 }
 
 // Extracts a list of markdown URLs that are contained within the section that has the title "Prerequisites".
@@ -271,25 +544,22 @@ func ExtractPrerequisiteUrlsFromAst(node ast.Node, source []byte) ([]string, err
 	return urls, nil
 }
 
-// Converts a string of shell variable exports into a map of key/value pairs.
-// I.E. `export FOO=bar\nexport BAZ=qux` becomes `{"FOO": "bar", "BAZ": "qux"}`
-func convertScenarioVariablesToMap(variableBlock string) map[string]string {
-	variableMap := make(map[string]string)
-
-	// Only process statements that begin with export.
-	for _, variable := range strings.Split(variableBlock, "\n") {
-		if strings.HasPrefix(variable, "export") {
-			parts := strings.SplitN(variable, "=", 2)
-			if len(parts) == 2 {
-				key := strings.TrimPrefix(parts[0], "export ")
-				value := parts[1]
-				logging.GlobalLogger.Debugf("Found variable: %s=%s\n", key, value)
-				variableMap[key] = value
-			}
-		}
+// Parses a shell variable export, I.E. `export FOO=bar`. Only statements that
+// begin with export are processed.
+func parseVariableExport(line string) (string, string, bool) {
+	if !strings.HasPrefix(line, "export") {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(line, "=", 2)
+	if len(parts) != 2 {
+		return "", "", false
 	}
 
-	return variableMap
+	key := strings.TrimPrefix(parts[0], "export ")
+	value := parts[1]
+	logging.GlobalLogger.Debugf("Found variable: %s=%s\n", key, value)
+	return key, value, true
 }
 
 // Extract the text from a code blocks base block and return it as a string.
@@ -2,6 +2,7 @@ package parsers
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -106,7 +107,10 @@ func TestParsingMarkdownCodeBlocks(t *testing.T) {
 		markdown := []byte(fmt.Sprintf("# Hello World\n ```bash\n%s\n```", "echo Hello"))
 
 		document := ParseMarkdownIntoAst(markdown)
-		codeBlocks := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+		codeBlocks, err := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+		if err != nil {
+			t.Fatalf("Error extracting code blocks: %s", err)
+		}
 
 		if len(codeBlocks) != 1 {
 			t.Errorf("Code block count is wrong: %d", len(codeBlocks))
@@ -136,7 +140,10 @@ func TestParsingMarkdownExpectedSimilarty(t *testing.T) {
 		)
 
 		document := ParseMarkdownIntoAst(markdown)
-		codeBlocks := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+		codeBlocks, err := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+		if err != nil {
+			t.Fatalf("Error extracting code blocks: %s", err)
+		}
 
 		if len(codeBlocks) != 1 {
 			t.Errorf("Code block count is wrong: %d", len(codeBlocks))
@@ -164,7 +171,10 @@ func TestParsingMarkdownExpectedRegex(t *testing.T) {
 		)
 
 		document := ParseMarkdownIntoAst(markdown)
-		codeBlocks := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+		codeBlocks, err := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+		if err != nil {
+			t.Fatalf("Error extracting code blocks: %s", err)
+		}
 
 		if len(codeBlocks) != 1 {
 			t.Errorf("Code block count is wrong: %d", len(codeBlocks))
@@ -182,3 +192,207 @@ func TestParsingMarkdownExpectedRegex(t *testing.T) {
 		}
 	})
 }
+
+func TestParsingMarkdownStructuralComparisonAttributes(t *testing.T) {
+	t.Run("Markdown with ignore_paths and unordered_arrays", func(t *testing.T) {
+		markdown := []byte(
+			"```bash\necho '{}'\n```\n" +
+				"<!-- expected_similarity=1.0 ignore_paths=\"$.id, $..etag\" unordered_arrays=true -->\n" +
+				"```json\n{}\n```\n",
+		)
+
+		document := ParseMarkdownIntoAst(markdown)
+		codeBlocks, err := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+		if err != nil {
+			t.Fatalf("Error extracting code blocks: %s", err)
+		}
+
+		if len(codeBlocks) != 1 {
+			t.Fatalf("Code block count is wrong: %d", len(codeBlocks))
+		}
+
+		block := codeBlocks[0].ExpectedOutput
+		if len(block.IgnorePaths) != 2 ||
+			block.IgnorePaths[0] != "$.id" ||
+			block.IgnorePaths[1] != "$..etag" {
+			t.Errorf("IgnorePaths is wrong: %v", block.IgnorePaths)
+		}
+
+		if !block.UnorderedArrays {
+			t.Errorf("UnorderedArrays should be true")
+		}
+	})
+}
+
+func TestParsingMarkdownCodeBlockAttributes(t *testing.T) {
+	markdown := []byte("Check the endpoint:\n\n```http timeout=10s retries=3\nGET http://localhost/health\n```\n")
+
+	document := ParseMarkdownIntoAst(markdown)
+	codeBlocks, err := ExtractCodeBlocksFromAst(document, markdown, []string{"http"})
+	if err != nil {
+		t.Fatalf("Error extracting code blocks: %s", err)
+	}
+
+	if len(codeBlocks) != 1 {
+		t.Fatalf("Code block count is wrong: %d", len(codeBlocks))
+	}
+
+	if codeBlocks[0].Language != "http" {
+		t.Errorf("Language is wrong: %s", codeBlocks[0].Language)
+	}
+
+	attributes := codeBlocks[0].Attributes
+	if attributes["timeout"] != "10s" || attributes["retries"] != "3" {
+		t.Errorf("Attributes are wrong: %v", attributes)
+	}
+}
+
+func TestParsingMarkdownFileCodeBlocks(t *testing.T) {
+	markdown := []byte(
+		"Create the deployment:\n\n```yaml file=deployment.yaml expand=true\nname: $APP\n```\n\n" +
+			"Create the config:\n\n```json file=config.json\n{}\n```\n\n" +
+			"Not executed:\n\n```yaml\nname: ignored\n```\n",
+	)
+
+	document := ParseMarkdownIntoAst(markdown)
+	codeBlocks, err := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+	if err != nil {
+		t.Fatalf("Error extracting code blocks: %s", err)
+	}
+
+	if len(codeBlocks) != 2 {
+		t.Fatalf("Code block count is wrong: %d", len(codeBlocks))
+	}
+
+	file := codeBlocks[0].File
+	if file == nil || file.Path != "deployment.yaml" || !file.ExpandVariables {
+		t.Errorf("File target is wrong: %+v", file)
+	}
+
+	file = codeBlocks[1].File
+	if file == nil || file.Path != "config.json" || file.ExpandVariables {
+		t.Errorf("File target is wrong: %+v", file)
+	}
+
+	if codeBlocks[1].Content != "{}\n" {
+		t.Errorf("Content is wrong: %q", codeBlocks[1].Content)
+	}
+}
+
+func TestParsingMarkdownInvalidFileCodeBlocks(t *testing.T) {
+	invalid := map[string]string{
+		"Empty path":               "```yaml file=\"\"\nname: app\n```\n",
+		"Invalid expand attribute": "```yaml file=app.yaml expand=maybe\nname: app\n```\n",
+	}
+
+	for name, fence := range invalid {
+		t.Run(name, func(t *testing.T) {
+			markdown := []byte("Create the file:\n\n" + fence)
+
+			document := ParseMarkdownIntoAst(markdown)
+			codeBlocks, err := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+
+			if err == nil || !strings.Contains(err.Error(), "line 3:") {
+				t.Errorf("Expected the file attribute on line 3 to be reported, got %v", err)
+			}
+			if len(codeBlocks) != 0 {
+				t.Errorf("Expected the code block not to be extracted: %+v", codeBlocks)
+			}
+		})
+	}
+}
+
+func TestParsingFileTargets(t *testing.T) {
+	t.Run("No file attribute", func(t *testing.T) {
+		target, err := ParseFileTarget(map[string]string{"timeout": "10s"})
+		if err != nil || target != nil {
+			t.Errorf("Expected no file target, got %+v (%v)", target, err)
+		}
+	})
+
+	t.Run("Invalid expand attribute", func(t *testing.T) {
+		_, err := ParseFileTarget(map[string]string{"file": "a.yaml", "expand": "maybe"})
+		if err == nil {
+			t.Errorf("Expected an error for an invalid expand attribute")
+		}
+	})
+
+	t.Run("Empty path", func(t *testing.T) {
+		_, err := ParseFileTarget(map[string]string{"file": " "})
+		if err == nil {
+			t.Errorf("Expected an error for an empty path")
+		}
+	})
+}
+
+func TestParsingMarkdownCodeBlockPositions(t *testing.T) {
+	markdown := []byte("---\ntitle: Positions\n---\n# Title\n\nFirst:\n\n```bash\necho one\necho two\n```\n\nEmpty:\n\n```bash\n```\n")
+
+	document := ParseMarkdownIntoAst(markdown)
+	codeBlocks, err := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+	if err != nil {
+		t.Fatalf("Error extracting code blocks: %s", err)
+	}
+
+	if len(codeBlocks) != 2 {
+		t.Fatalf("Code block count is wrong: %d", len(codeBlocks))
+	}
+
+	if position := codeBlocks[0].Position; position.StartLine != 8 || position.EndLine != 11 {
+		t.Errorf("Position is wrong: %+v", position)
+	}
+
+	if position := codeBlocks[1].Position; position.StartLine != 15 || position.EndLine != 16 {
+		t.Errorf("Position is wrong: %+v", position)
+	}
+}
+
+func TestParsingMarkdownExpectedOutputAndDirectivePositions(t *testing.T) {
+	markdown := []byte("# Title\n\n```bash\necho hello\n```\n\n" +
+		"<!--\nie:assert stdout contains \"hello\"\nie:wait-until interval=1s timeout=2s\n-->\n\n" +
+		"<!-- expected_similarity=1.0 -->\n\n```text\nhello\n```\n")
+
+	document := ParseMarkdownIntoAst(markdown)
+	codeBlocks, err := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+	if err != nil {
+		t.Fatalf("Error extracting code blocks: %s", err)
+	}
+
+	if len(codeBlocks) != 1 {
+		t.Fatalf("Code block count is wrong: %d", len(codeBlocks))
+	}
+	block := codeBlocks[0]
+
+	if position := block.ExpectedOutput.Position; position.StartLine != 14 || position.EndLine != 16 {
+		t.Errorf("Expected output position is wrong: %+v", position)
+	}
+
+	if len(block.Assertions) != 1 {
+		t.Fatalf("Assertion count is wrong: %d", len(block.Assertions))
+	}
+	if position := block.Assertions[0].Position; position.StartLine != 8 || position.EndLine != 8 {
+		t.Errorf("Assertion position is wrong: %+v", position)
+	}
+
+	if block.WaitUntil == nil {
+		t.Fatalf("Expected a wait-until condition")
+	}
+	if position := block.WaitUntil.Position; position.StartLine != 9 || position.EndLine != 9 {
+		t.Errorf("Wait-until position is wrong: %+v", position)
+	}
+}
+
+func TestSourcePositionString(t *testing.T) {
+	testCases := map[string]SourcePosition{
+		"":          {},
+		"line 3":    {StartLine: 3, EndLine: 5},
+		"doc.md:3":  {File: "doc.md", StartLine: 3, EndLine: 5},
+		"remote.md": {File: "remote.md"},
+	}
+
+	for expected, position := range testCases {
+		if position.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, position.String())
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package parsers
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// A replacement of the value assigned to a variable, as byte offsets into the
+// script the assignment was found in.
+type variableOverride struct {
+	name  string
+	start int
+	end   int
+	value string
+}
+
+// Finds the assignments to the variables of overrides within a shell script.
+// Assignments made through export, declare and the other declaration builtins
+// are overridden along with plain assignments, so that `A=1; export A` is
+// handled the same way as `export A=1`. Assignments that prefix a command,
+// I.E. `A=1 command`, only apply to that command and are left alone, as are
+// appends and array assignments.
+func findVariableOverrides(script string, overrides map[string]string) ([]variableOverride, error) {
+	file, err := ParseShellScript(script)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []variableOverride
+	override := func(assign *syntax.Assign) {
+		if assign.Name == nil || assign.Naked || assign.Append || assign.Array != nil || assign.Index != nil {
+			return
+		}
+
+		value, ok := overrides[assign.Name.Value]
+		if !ok {
+			return
+		}
+
+		// Quote the value so that it is assigned as is, no matter what it
+		// contains.
+		quoted, err := syntax.Quote(value, syntax.LangBash)
+		if err != nil {
+			return
+		}
+
+		// An empty assignment, I.E. `A=`, has no value to replace so the new
+		// value is inserted after the equals sign.
+		start, end := int(assign.End().Offset()), int(assign.End().Offset())
+		if assign.Value != nil {
+			start, end = int(assign.Value.Pos().Offset()), int(assign.Value.End().Offset())
+		}
+
+		// Overrides have always been rendered with a space between the value
+		// and a `;` or `&&` that follows it, I.E. `export A=value ; echo $A`.
+		rest := strings.TrimLeft(script[end:], " \t")
+		if strings.HasPrefix(rest, ";") || strings.HasPrefix(rest, "&&") {
+			end = len(script) - len(rest)
+			quoted += " "
+		}
+
+		found = append(found, variableOverride{
+			name:  assign.Name.Value,
+			start: start,
+			end:   end,
+			value: quoted,
+		})
+	}
+
+	syntax.Walk(file, func(node syntax.Node) bool {
+		switch node := node.(type) {
+		case *syntax.DeclClause:
+			for _, arg := range node.Args {
+				override(arg)
+			}
+		case *syntax.CallExpr:
+			if len(node.Args) == 0 {
+				for _, assign := range node.Assigns {
+					override(assign)
+				}
+			}
+		}
+		return true
+	})
+
+	return found, nil
+}
+
+// Replaces the values of the overrides within text, starting from the end so
+// that the offsets of the earlier overrides stay valid.
+func applyVariableOverrides(text string, found []variableOverride) string {
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].start > found[j].start
+	})
+
+	for _, override := range found {
+		text = text[:override.start] + override.value + text[override.end:]
+	}
+
+	return text
+}
+
+// Counts how many assignments of each variable were overridden.
+func countVariableOverrides(found []variableOverride, matches map[string]int) {
+	for _, override := range found {
+		matches[override.name]++
+	}
+}
+
+// Replaces the values assigned to variables within a shell script with the
+// values of overrides. Returns the new script along with the number of
+// assignments that were replaced for each variable. Variables that are never
+// assigned are left out of the counts.
+func OverrideShellVariables(
+	script string,
+	overrides map[string]string,
+) (string, map[string]int, error) {
+	matches := make(map[string]int)
+
+	found, err := findVariableOverrides(script, overrides)
+	if err != nil {
+		return script, matches, err
+	}
+
+	countVariableOverrides(found, matches)
+	return applyVariableOverrides(script, found), matches, nil
+}
+
+// Replaces the values assigned to variables within the shell code blocks and
+// the variables comment of a markdown document, leaving the rest of the
+// document untouched. Code blocks that fail to parse are skipped. Returns the
+// new document along with the number of assignments that were replaced for
+// each variable.
+func OverrideMarkdownVariables(
+	markdown string,
+	overrides map[string]string,
+) (string, map[string]int) {
+	source := []byte(markdown)
+	matches := make(map[string]int)
+
+	// The lines of each shell script within the document. The lines of a
+	// script aren't contiguous when the code block is indented, I.E. within a
+	// list, so offsets into the script are mapped back to the document
+	// through them.
+	var scripts [][]text.Segment
+
+	ast.Walk(ParseMarkdownIntoAst(source), func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := node.(type) {
+		case *ast.FencedCodeBlock:
+			language := string(n.Language(source))
+			if language == "" || !IsShellLanguage(language) {
+				break
+			}
+
+			var lines []text.Segment
+			for i := 0; i < n.Lines().Len(); i++ {
+				lines = append(lines, n.Lines().At(i))
+			}
+			scripts = append(scripts, lines)
+		case *ast.HTMLBlock:
+			var lines []text.Segment
+			inVariables := false
+			for i := 0; i < n.Lines().Len(); i++ {
+				segment := n.Lines().At(i)
+				line := string(segment.Value(source))
+
+				if !inVariables {
+					inVariables = strings.Contains(line, "```variables")
+					continue
+				}
+				if strings.Contains(line, "```") {
+					break
+				}
+				lines = append(lines, segment)
+			}
+			if len(lines) > 0 {
+				scripts = append(scripts, lines)
+			}
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	var found []variableOverride
+	for _, lines := range scripts {
+		var script strings.Builder
+		offsets := make([]int, 0, len(lines))
+		for _, line := range lines {
+			offsets = append(offsets, script.Len())
+			script.Write(source[line.Start:line.Stop])
+		}
+
+		scriptOverrides, err := findVariableOverrides(script.String(), overrides)
+		if err != nil {
+			continue
+		}
+
+		toDocumentOffset := func(offset int) int {
+			line := sort.Search(len(offsets), func(i int) bool {
+				return offsets[i] > offset
+			}) - 1
+			return lines[line].Start + offset - offsets[line]
+		}
+
+		for _, override := range scriptOverrides {
+			override.start = toDocumentOffset(override.start)
+			override.end = toDocumentOffset(override.end)
+			found = append(found, override)
+		}
+	}
+
+	countVariableOverrides(found, matches)
+	return applyVariableOverrides(markdown, found), matches
+}
@@ -0,0 +1,98 @@
+package parsers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOverrideShellVariables(t *testing.T) {
+	testCases := []struct {
+		name     string
+		script   string
+		expected string
+		matches  map[string]int
+	}{
+		{
+			name:     "Multiple exports on one line",
+			script:   "export A=1 B=2\necho $A $B\n",
+			expected: "export A=one B=two\necho $A $B\n",
+			matches:  map[string]int{"A": 1, "B": 1},
+		},
+		{
+			name:     "declare -x",
+			script:   "declare -x A=\"old\"\n",
+			expected: "declare -x A=one\n",
+			matches:  map[string]int{"A": 1},
+		},
+		{
+			name:     "Quoted values containing a separator",
+			script:   "export A=\"x; y\" && export C='a;b'; echo done\n",
+			expected: "export A=one && export C='with space' ; echo done\n",
+			matches:  map[string]int{"A": 1, "C": 1},
+		},
+		{
+			name:     "Multi-line values",
+			script:   "export A=\"first\nsecond\"\necho $A\n",
+			expected: "export A=one\necho $A\n",
+			matches:  map[string]int{"A": 1},
+		},
+		{
+			name:     "Assignments that are exported later",
+			script:   "A=$(date)\nexport A\n",
+			expected: "A=one\nexport A\n",
+			matches:  map[string]int{"A": 1},
+		},
+		{
+			name:     "Assignments scoped to a command are left alone",
+			script:   "A=1 command\nA+=2\nexport B=\n",
+			expected: "A=1 command\nA+=2\nexport B=two\n",
+			matches:  map[string]int{"B": 1},
+		},
+		{
+			name:     "Assignments within heredocs are left alone",
+			script:   "cat <<EOF\nexport A=1\nEOF\n",
+			expected: "cat <<EOF\nexport A=1\nEOF\n",
+			matches:  map[string]int{},
+		},
+	}
+
+	overrides := map[string]string{"A": "one", "B": "two", "C": "with space"}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			script, matches, err := OverrideShellVariables(testCase.script, overrides)
+			if err != nil {
+				t.Fatalf("Expected err to be nil, got %v", err)
+			}
+			if script != testCase.expected {
+				t.Errorf("Expected the script\n%q\ngot\n%q", testCase.expected, script)
+			}
+			if !reflect.DeepEqual(matches, testCase.matches) {
+				t.Errorf("Expected the matches %v, got %v", testCase.matches, matches)
+			}
+		})
+	}
+}
+
+func TestOverrideMarkdownVariables(t *testing.T) {
+	markdown := "# Title\n\n<!--\n```variables\nexport REGION=eastus\n```\n-->\n\n" +
+		"1. Create the group:\n\n   ```bash\n   export GROUP=\"rg\n   name\" REGION=westus\n   ```\n\n" +
+		"```text\nexport GROUP=ignored\n```\n"
+
+	overridden, matches := OverrideMarkdownVariables(
+		markdown,
+		map[string]string{"REGION": "westeurope", "GROUP": "my group", "MISSING": "value"},
+	)
+
+	expected := "# Title\n\n<!--\n```variables\nexport REGION=westeurope\n```\n-->\n\n" +
+		"1. Create the group:\n\n   ```bash\n   export GROUP='my group' REGION=westeurope\n   ```\n\n" +
+		"```text\nexport GROUP=ignored\n```\n"
+	if overridden != expected {
+		t.Errorf("Expected the markdown\n%q\ngot\n%q", expected, overridden)
+	}
+
+	expectedMatches := map[string]int{"REGION": 2, "GROUP": 1}
+	if !reflect.DeepEqual(matches, expectedMatches) {
+		t.Errorf("Expected the matches %v, got %v", expectedMatches, matches)
+	}
+}
@@ -0,0 +1,73 @@
+package parsers
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// The location of an element within a markdown file. Lines start at 1, and a
+// line of 0 means that the position is unknown.
+type SourcePosition struct {
+	File      string `json:"file"`
+	StartLine int    `json:"startLine"`
+	EndLine   int    `json:"endLine"`
+}
+
+// Renders the position the same way compilers do, I.E. `docs/deploy.md:12`.
+// Returns an empty string when the position is unknown.
+func (position SourcePosition) String() string {
+	if position.StartLine == 0 {
+		return position.File
+	}
+	if position.File == "" {
+		return fmt.Sprintf("line %d", position.StartLine)
+	}
+	return fmt.Sprintf("%s:%d", position.File, position.StartLine)
+}
+
+// Gets the line number of a byte offset within a markdown file.
+func lineAtOffset(source []byte, offset int) int {
+	if offset > len(source) {
+		offset = len(source)
+	}
+	return bytes.Count(source[:offset], []byte("\n")) + 1
+}
+
+// Gets the position of a fenced code block, from its opening fence to its
+// closing fence.
+func fencedCodeBlockPosition(block *ast.FencedCodeBlock, source []byte) SourcePosition {
+	var position SourcePosition
+
+	lines := block.Lines()
+	if lines.Len() > 0 {
+		// The content starts on the line after the opening fence.
+		position.StartLine = lineAtOffset(source, lines.At(0).Start) - 1
+		position.EndLine = lineAtOffset(source, lines.At(lines.Len()-1).Start) + 1
+	} else if block.Info != nil {
+		position.StartLine = lineAtOffset(source, block.Info.Segment.Start)
+		position.EndLine = position.StartLine + 1
+	}
+
+	return position
+}
+
+// Gets the line a block level node of a markdown document starts on, or 0 if
+// it is unknown.
+func NodeStartLine(node ast.Node, source []byte) int {
+	if block, ok := node.(*ast.FencedCodeBlock); ok {
+		return fencedCodeBlockPosition(block, source).StartLine
+	}
+
+	// Inline nodes don't keep track of their lines.
+	if node.Type() != ast.TypeBlock {
+		return 0
+	}
+
+	lines := node.Lines()
+	if lines == nil || lines.Len() == 0 {
+		return 0
+	}
+	return lineAtOffset(source, lines.At(0).Start)
+}
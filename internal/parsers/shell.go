@@ -0,0 +1,184 @@
+package parsers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// A variable that is read or written by a shell script.
+type ShellVariableAccess struct {
+	Name string
+	// The line of the script the variable is accessed on, starting at 1.
+	Line int
+	// The value assigned to the variable, only set for writes. Literal values
+	// are unquoted while other values are kept as written, I.E. `$(date)`.
+	Value string
+	// Whether the variable is exported by the write.
+	Exported bool
+}
+
+// The variables that a shell script reads and writes, in the order they
+// appear within the script.
+type ShellVariableUsage struct {
+	Reads  []ShellVariableAccess
+	Writes []ShellVariableAccess
+}
+
+// A syntax error found within a shell script.
+type ShellSyntaxError struct {
+	// The position of the error within the script, starting at 1.
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *ShellSyntaxError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+var shellVariableName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// The languages of the code blocks that are executed by a shell. Code blocks
+// without a language are treated as bash.
+var shellLanguages = map[string]bool{
+	"":                     true,
+	"bash":                 true,
+	"azurecli":             true,
+	"azurecli-interactive": true,
+	"sh":                   true,
+}
+
+// Checks whether code blocks of a language are executed by a shell.
+func IsShellLanguage(language string) bool {
+	return shellLanguages[language]
+}
+
+// Parses a bash script into its syntax tree.
+func ParseShellScript(script string) (*syntax.File, error) {
+	return syntax.NewParser(syntax.Variant(syntax.LangBash)).Parse(strings.NewReader(script), "")
+}
+
+// Checks the syntax of a shell script without executing it. Scripts written
+// in `sh` are checked against POSIX, everything else against bash. Returns
+// nil when the script is valid.
+func CheckShellSyntax(script string, language string) *ShellSyntaxError {
+	variant := syntax.LangBash
+	if language == "sh" {
+		variant = syntax.LangPOSIX
+	}
+
+	_, err := syntax.NewParser(syntax.Variant(variant)).Parse(strings.NewReader(script), "")
+	if err == nil {
+		return nil
+	}
+
+	var position syntax.Pos
+	var parseError syntax.ParseError
+	var langError syntax.LangError
+	switch {
+	case errors.As(err, &parseError):
+		position = parseError.Pos
+	case errors.As(err, &langError):
+		position = langError.Pos
+	default:
+		return &ShellSyntaxError{Line: 1, Column: 1, Message: err.Error()}
+	}
+
+	return &ShellSyntaxError{
+		Line:    int(position.Line()),
+		Column:  int(position.Col()),
+		Message: strings.TrimPrefix(err.Error(), position.String()+": "),
+	}
+}
+
+// Finds the variables that a shell script reads and writes. Special
+// parameters such as `$1` and `$?` are ignored.
+func AnalyzeShellVariables(script string) (ShellVariableUsage, error) {
+	var usage ShellVariableUsage
+
+	file, err := ParseShellScript(script)
+	if err != nil {
+		return usage, err
+	}
+
+	write := func(assign *syntax.Assign, exported bool) {
+		if assign.Name == nil || assign.Naked {
+			return
+		}
+
+		usage.Writes = append(usage.Writes, ShellVariableAccess{
+			Name:     assign.Name.Value,
+			Line:     int(assign.Pos().Line()),
+			Value:    shellWordValue(assign.Value, script),
+			Exported: exported,
+		})
+	}
+
+	syntax.Walk(file, func(node syntax.Node) bool {
+		switch node := node.(type) {
+		case *syntax.DeclClause:
+			exported := node.Variant.Value == "export"
+			for _, arg := range node.Args {
+				if arg.Naked && arg.Name == nil && arg.Value != nil && strings.Contains(arg.Value.Lit(), "x") {
+					exported = true
+				}
+			}
+			for _, arg := range node.Args {
+				write(arg, exported)
+			}
+		case *syntax.CallExpr:
+			for _, assign := range node.Assigns {
+				write(assign, false)
+			}
+		case *syntax.WordIter:
+			usage.Writes = append(usage.Writes, ShellVariableAccess{
+				Name: node.Name.Value,
+				Line: int(node.Pos().Line()),
+			})
+		case *syntax.ParamExp:
+			if node.Param != nil && shellVariableName.MatchString(node.Param.Value) {
+				usage.Reads = append(usage.Reads, ShellVariableAccess{
+					Name: node.Param.Value,
+					Line: int(node.Pos().Line()),
+				})
+			}
+		}
+		return true
+	})
+
+	return usage, nil
+}
+
+// Gets the value of a shell word. Words made of literal and quoted text are
+// unquoted, everything else is returned as written in the script.
+func shellWordValue(word *syntax.Word, script string) string {
+	if word == nil {
+		return ""
+	}
+
+	var value strings.Builder
+	for _, part := range word.Parts {
+		switch part := part.(type) {
+		case *syntax.Lit:
+			value.WriteString(part.Value)
+		case *syntax.SglQuoted:
+			value.WriteString(part.Value)
+		case *syntax.DblQuoted:
+			for _, quotedPart := range part.Parts {
+				lit, ok := quotedPart.(*syntax.Lit)
+				if !ok {
+					return script[word.Pos().Offset():word.End().Offset()]
+				}
+				value.WriteString(lit.Value)
+			}
+		default:
+			return script[word.Pos().Offset():word.End().Offset()]
+		}
+	}
+
+	return value.String()
+}
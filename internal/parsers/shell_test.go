@@ -0,0 +1,78 @@
+package parsers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeShellVariables(t *testing.T) {
+	script := `export RESOURCE_GROUP="rg-$SUFFIX"
+LOCATION=eastus
+declare -x SIZE='Standard B1'
+export A=1 B=2
+IP=$(az vm show --name "$VM_NAME" --query ip -o tsv)
+for ZONE in 1 2; do echo "${ZONE} $1 $?"; done
+cat <<'EOF'
+$NOT_READ
+EOF
+export LOCATION
+`
+
+	usage, err := AnalyzeShellVariables(script)
+	if err != nil {
+		t.Fatalf("Expected err to be nil, got %v", err)
+	}
+
+	expectedWrites := []ShellVariableAccess{
+		{Name: "RESOURCE_GROUP", Line: 1, Value: `"rg-$SUFFIX"`, Exported: true},
+		{Name: "LOCATION", Line: 2, Value: "eastus"},
+		{Name: "SIZE", Line: 3, Value: "Standard B1", Exported: true},
+		{Name: "A", Line: 4, Value: "1", Exported: true},
+		{Name: "B", Line: 4, Value: "2", Exported: true},
+		{Name: "IP", Line: 5, Value: `$(az vm show --name "$VM_NAME" --query ip -o tsv)`},
+		{Name: "ZONE", Line: 6},
+	}
+	if !reflect.DeepEqual(usage.Writes, expectedWrites) {
+		t.Errorf("Expected the writes\n%+v\ngot\n%+v", expectedWrites, usage.Writes)
+	}
+
+	expectedReads := []ShellVariableAccess{
+		{Name: "SUFFIX", Line: 1},
+		{Name: "VM_NAME", Line: 5},
+		{Name: "ZONE", Line: 6},
+	}
+	if !reflect.DeepEqual(usage.Reads, expectedReads) {
+		t.Errorf("Expected the reads\n%+v\ngot\n%+v", expectedReads, usage.Reads)
+	}
+
+	t.Run("Syntax errors are reported", func(t *testing.T) {
+		if _, err := AnalyzeShellVariables("if true; then echo"); err == nil {
+			t.Errorf("Expected a syntax error")
+		}
+	})
+}
+
+func TestCheckShellSyntax(t *testing.T) {
+	if err := CheckShellSyntax("echo hello\nif true; then echo yes; fi\n", "bash"); err != nil {
+		t.Errorf("Expected a valid script, got %v", err)
+	}
+
+	err := CheckShellSyntax("echo hello\nif true; then\n  echo yes\n", "bash")
+	if err == nil {
+		t.Fatalf("Expected a syntax error for an unterminated if")
+	}
+	if err.Line != 2 || err.Column != 1 {
+		t.Errorf("Expected the error to be at 2:1, got %d:%d", err.Line, err.Column)
+	}
+	if !strings.Contains(err.Message, "if") {
+		t.Errorf("Expected the message to mention the if clause, got %q", err.Message)
+	}
+
+	if err := CheckShellSyntax("NAMES=(a b)\n", "bash"); err != nil {
+		t.Errorf("Expected bash arrays to be valid, got %v", err)
+	}
+	if err := CheckShellSyntax("NAMES=(a b)\n", "sh"); err == nil {
+		t.Errorf("Expected bash arrays to be invalid in sh")
+	}
+}
@@ -1,7 +1,6 @@
 package patterns
 
 import (
-	"fmt"
 	"regexp"
 )
 
@@ -21,8 +20,4 @@ var (
 	// ARM regex
 	AzResourceURI       = regexp.MustCompile(`\"id\": \"(/subscriptions/[^\"]+)\"`)
 	AzResourceGroupName = regexp.MustCompile(`resourceGroups/([^\"\\/\ ]+)`)
-
-	ExportVariableRegex = func(key string) *regexp.Regexp {
-		return regexp.MustCompile(fmt.Sprintf(`(?m)export %s\s*=\s*(.*?)(;|&&|$)`, key))
-	}
 )
@@ -0,0 +1,163 @@
+package shells
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// How long a background command has to exit after being asked to terminate
+// before it is killed.
+const backgroundTerminationGracePeriod = 5 * time.Second
+
+// How often a terminated process group is checked for processes that are
+// still running.
+const backgroundPollInterval = 50 * time.Millisecond
+
+// A buffer that can be written to by a running process while being read.
+type synchronizedBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *synchronizedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *synchronizedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+// A bash command running in the background within its own process group.
+type BackgroundCommand struct {
+	Command string
+	process *exec.Cmd
+	logs    *synchronizedBuffer
+	done    chan struct{}
+	// Closed once every process writing to the logs has closed them, which
+	// can be after the command itself exits, I.E. for `npm start &`.
+	logsClosed chan struct{}
+	err        error
+}
+
+var StartBackgroundCommand = startBackgroundCommandImpl
+
+// Starts a bash command in the background. The command runs in its own process
+// group so that any processes it spawns can be terminated along with it.
+func startBackgroundCommandImpl(
+	command string,
+	config BashCommandConfiguration,
+) (*BackgroundCommand, error) {
+	commandToExecute := exec.Command("bash", "-c", command)
+	commandToExecute.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	// The output is read from a pipe of our own rather than one managed by
+	// exec, so that processes left running by the command keep writing to the
+	// logs after it exits instead of being cut off.
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start background command: %w", err)
+	}
+	commandToExecute.Stdout = writer
+	commandToExecute.Stderr = writer
+
+	restoreCommandState(commandToExecute, config)
+
+	err = commandToExecute.Start()
+	writer.Close()
+	if err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("failed to start background command: %w", err)
+	}
+
+	background := &BackgroundCommand{
+		Command:    command,
+		process:    commandToExecute,
+		logs:       &synchronizedBuffer{},
+		done:       make(chan struct{}),
+		logsClosed: make(chan struct{}),
+	}
+
+	go func() {
+		io.Copy(background.logs, reader)
+		reader.Close()
+		close(background.logsClosed)
+	}()
+
+	go func() {
+		background.err = commandToExecute.Wait()
+		close(background.done)
+	}()
+
+	return background, nil
+}
+
+// The process ID of the background command.
+func (b *BackgroundCommand) Pid() int {
+	return b.process.Process.Pid
+}
+
+// The combined standard output and error of the background command so far.
+func (b *BackgroundCommand) Logs() string {
+	return b.logs.String()
+}
+
+// Checks if the background command has exited, and returns the error it exited
+// with if it has. Processes it started in the background may still be running.
+func (b *BackgroundCommand) Exited() (bool, error) {
+	select {
+	case <-b.done:
+		return true, b.err
+	default:
+		return false, nil
+	}
+}
+
+// Checks if any process of the process group of the background command is
+// still running.
+func (b *BackgroundCommand) groupRunning() bool {
+	err := syscall.Kill(-b.process.Process.Pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// Terminates the process group of the background command, killing it if it
+// doesn't exit within the grace period. The group is terminated even when the
+// command itself has exited, as the processes it started in the background
+// are still part of it.
+func (b *BackgroundCommand) Stop() error {
+	processGroup := -b.process.Process.Pid
+	if err := syscall.Kill(processGroup, syscall.SIGTERM); err != nil &&
+		!errors.Is(err, syscall.ESRCH) {
+		return fmt.Errorf("failed to terminate background command: %w", err)
+	}
+
+	deadline := time.Now().Add(backgroundTerminationGracePeriod)
+	for b.groupRunning() && time.Now().Before(deadline) {
+		time.Sleep(backgroundPollInterval)
+	}
+
+	if err := syscall.Kill(processGroup, syscall.SIGKILL); err != nil &&
+		!errors.Is(err, syscall.ESRCH) {
+		return fmt.Errorf("failed to kill background command: %w", err)
+	}
+
+	<-b.done
+
+	// Processes that escaped the process group could keep the logs open, so
+	// don't wait on them forever.
+	select {
+	case <-b.logsClosed:
+	case <-time.After(backgroundTerminationGracePeriod):
+	}
+	return nil
+}
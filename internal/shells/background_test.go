@@ -0,0 +1,90 @@
+package shells
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBackgroundCommandExecution(t *testing.T) {
+	// Ensures that background commands keep running until they are stopped,
+	// including the processes they spawn.
+	t.Run("Stopping a background command", func(t *testing.T) {
+		background, err := StartBackgroundCommand(
+			"echo started; sleep 60 & wait",
+			BashCommandConfiguration{
+				EnvironmentVariables: nil,
+				InheritEnvironment:   true,
+				InteractiveCommand:   false,
+				WriteToHistory:       false,
+			},
+		)
+		if err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(background.Logs(), "started") && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if exited, _ := background.Exited(); exited {
+			t.Errorf("Expected the background command to still be running")
+		}
+
+		if err := background.Stop(); err != nil {
+			t.Errorf("Expected err to be nil, got %v", err)
+		}
+
+		if exited, _ := background.Exited(); !exited {
+			t.Errorf("Expected the background command to have exited")
+		}
+
+		if background.Logs() != "started\n" {
+			t.Errorf("Expected the logs to be captured, got '%s'", background.Logs())
+		}
+	})
+
+	t.Run("Stopping the processes a background command leaves running", func(t *testing.T) {
+		pidFile := filepath.Join(t.TempDir(), "pid")
+		background, err := StartBackgroundCommand(
+			"sleep 60 & echo $! > "+pidFile,
+			BashCommandConfiguration{
+				EnvironmentVariables: nil,
+				InheritEnvironment:   true,
+				InteractiveCommand:   false,
+				WriteToHistory:       false,
+			},
+		)
+		if err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if exited, _ := background.Exited(); exited {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		content, err := os.ReadFile(pidFile)
+		if err != nil {
+			t.Fatalf("Expected the pid of the background process to be written, got %v", err)
+		}
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(content)))
+
+		if err := background.Stop(); err != nil {
+			t.Errorf("Expected err to be nil, got %v", err)
+		}
+
+		if err := syscall.Kill(pid, 0); !errors.Is(err, syscall.ESRCH) {
+			t.Errorf("Expected the process left running by the command to be stopped, got %v", err)
+		}
+	})
+}
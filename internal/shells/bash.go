@@ -3,6 +3,7 @@ package shells
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
@@ -38,6 +39,9 @@ func appendToBashHistory(command string, filePath string) error {
 type CommandOutput struct {
 	StdOut string
 	StdErr string
+	// Only set for HTTP requests.
+	StatusCode int
+	Headers    map[string][]string
 }
 
 type BashCommandConfiguration struct {
@@ -45,6 +49,50 @@ type BashCommandConfiguration struct {
 	InheritEnvironment   bool
 	InteractiveCommand   bool
 	WriteToHistory       bool
+	// Receive the output of the command as it is produced, on top of it being
+	// captured. Interactive commands write straight to the terminal instead.
+	StdOutWriter io.Writer
+	StdErrWriter io.Writer
+}
+
+// Writes to the buffer that captures a stream, and to the writer that streams
+// it when there is one.
+func captureOutput(buffer *bytes.Buffer, writer io.Writer) io.Writer {
+	if writer == nil {
+		return buffer
+	}
+	return io.MultiWriter(buffer, writer)
+}
+
+// Sharing environment variables and the working directory between isolated
+// shell executions is a bit tough, but how we handle it is by storing the
+// environment variables after a command is executed within a file and then
+// loading that file before executing the next command. This allows us to
+// share state between isolated command calls.
+func restoreCommandState(command *exec.Cmd, config BashCommandConfiguration) {
+	if config.InheritEnvironment {
+		command.Env = os.Environ()
+	}
+
+	// Restore env variables
+	envFromPreviousStep, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+	if err == nil {
+		merged := lib.MergeMaps(config.EnvironmentVariables, envFromPreviousStep)
+		for k, v := range merged {
+			command.Env = append(command.Env, fmt.Sprintf("%s=%s", k, v))
+		}
+	} else {
+		for k, v := range config.EnvironmentVariables {
+			command.Env = append(command.Env, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+	// Restore working directory
+	workingDirFromPreviousStep, err := lib.LoadWorkingDirectoryStateFile(lib.DefaultWorkingDirectoryStateFile)
+	if err == nil {
+		command.Dir = workingDirFromPreviousStep
+	} else {
+		command.Dir = ""
+	}
 }
 
 var ExecuteBashCommand = executeBashCommandImpl
@@ -64,7 +112,17 @@ func executeBashCommandImpl(
 	}
 
 	commandToExecute := exec.Command("bash", "-c", strings.Join(commandWithStateSaved, "\n"))
+	return runCommand(commandToExecute, command, config)
+}
 
+// Runs a command with the state of the previous command restored, capturing its
+// output unless it is interactive. The script is what gets written to the bash
+// history when requested.
+func runCommand(
+	commandToExecute *exec.Cmd,
+	script string,
+	config BashCommandConfiguration,
+) (CommandOutput, error) {
 	var stdoutBuffer, stderrBuffer bytes.Buffer
 
 	// If the command requires interaction, we provide the user with the ability
@@ -75,39 +133,11 @@ func executeBashCommandImpl(
 		commandToExecute.Stderr = os.Stderr
 		commandToExecute.Stdin = os.Stdin
 	} else {
-		commandToExecute.Stdout = &stdoutBuffer
-		commandToExecute.Stderr = &stderrBuffer
-	}
-
-	if config.InheritEnvironment {
-		commandToExecute.Env = os.Environ()
+		commandToExecute.Stdout = captureOutput(&stdoutBuffer, config.StdOutWriter)
+		commandToExecute.Stderr = captureOutput(&stderrBuffer, config.StdErrWriter)
 	}
 
-	// Sharing environment variables and the working directory between isolated
-	// shell executions is a bit tough, but how we handle it is by storing the
-	// environment variables after a command is executed within a file and then
-	// loading that file before executing the next command. This allows us to
-	// share state between isolated command calls.
-
-	// Restore env variables
-	envFromPreviousStep, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
-	if err == nil {
-		merged := lib.MergeMaps(config.EnvironmentVariables, envFromPreviousStep)
-		for k, v := range merged {
-			commandToExecute.Env = append(commandToExecute.Env, fmt.Sprintf("%s=%s", k, v))
-		}
-	} else {
-		for k, v := range config.EnvironmentVariables {
-			commandToExecute.Env = append(commandToExecute.Env, fmt.Sprintf("%s=%s", k, v))
-		}
-	}
-	// Restore working directory
-	workingDirFromPreviousStep, err := lib.LoadWorkingDirectoryStateFile(lib.DefaultWorkingDirectoryStateFile)
-	if err == nil {
-		commandToExecute.Dir = workingDirFromPreviousStep
-	} else {
-		commandToExecute.Dir = ""
-	}
+	restoreCommandState(commandToExecute, config)
 
 	if config.WriteToHistory {
 
@@ -116,13 +146,13 @@ func executeBashCommandImpl(
 			return CommandOutput{}, fmt.Errorf("failed to get home directory: %w", err)
 		}
 
-		err = appendToBashHistory(command, homeDir+"/.bash_history")
+		err = appendToBashHistory(script, homeDir+"/.bash_history")
 		if err != nil {
 			return CommandOutput{}, fmt.Errorf("failed to write command to history: %w", err)
 		}
 	}
 
-	err = commandToExecute.Run()
+	err := commandToExecute.Run()
 
 	// TODO(vmarcella): Find a better way to handle this.
 	if config.InteractiveCommand {
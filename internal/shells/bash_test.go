@@ -1,6 +1,7 @@
 package shells
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -106,3 +107,24 @@ func TestBashCommandExecution(t *testing.T) {
 		}
 	})
 }
+
+func TestBashCommandOutputWriters(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	result, err := ExecuteBashCommand(
+		"printf out; printf err >&2",
+		BashCommandConfiguration{
+			InheritEnvironment: true,
+			StdOutWriter:       &stdout,
+			StdErrWriter:       &stderr,
+		},
+	)
+	if err != nil {
+		t.Errorf("Expected err to be nil, got %v", err)
+	}
+	if result.StdOut != "out" || stdout.String() != "out" {
+		t.Errorf("Expected stdout to be captured and streamed, got '%s' and '%s'", result.StdOut, stdout.String())
+	}
+	if result.StdErr != "err" || stderr.String() != "err" {
+		t.Errorf("Expected stderr to be captured and streamed, got '%s' and '%s'", result.StdErr, stderr.String())
+	}
+}
@@ -0,0 +1,271 @@
+package shells
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+)
+
+// The configuration used to execute a code block with an executor.
+type ExecutorConfiguration struct {
+	BashCommandConfiguration
+	// The attributes from the info string of the code block, I.E. `timeout=10s`.
+	Attributes map[string]string
+}
+
+// Executes the code blocks of one or more fence languages.
+type Executor interface {
+	// Executes a script and returns its output. The environment variables and
+	// working directory left behind by the script are saved so that they are
+	// visible to the next code block, regardless of its language.
+	Execute(script string, config ExecutorConfiguration) (CommandOutput, error)
+	// Converts a script into a command that can be run by bash, used when
+	// exporting a scenario as a shell script.
+	ToShellCommand(script string) string
+}
+
+// The language used for code blocks that don't specify one.
+const DefaultExecutorLanguage = "bash"
+
+// The fence attribute that opts a code block written in an opt-in language
+// into being executed, I.E. ```python exec=true```.
+const ExecuteAttribute = "exec"
+
+// Maps fence languages to the executor used to run them.
+var executors = map[string]Executor{}
+
+// The fence languages whose code blocks are only executed when they opt in
+// with the exec attribute.
+var optInLanguages = map[string]bool{}
+
+// Registers an executor for the given fence languages, replacing any executor
+// previously registered for them.
+func RegisterExecutor(executor Executor, languages ...string) {
+	for _, language := range languages {
+		executors[language] = executor
+		delete(optInLanguages, language)
+	}
+}
+
+// Registers an executor for fence languages that documents commonly use for
+// illustration, such as python or http. Their code blocks are only executed
+// when they opt in with the exec attribute, so that existing documents keep
+// working as they did before the languages could be executed.
+func RegisterOptInExecutor(executor Executor, languages ...string) {
+	RegisterExecutor(executor, languages...)
+	for _, language := range languages {
+		optInLanguages[language] = true
+	}
+}
+
+// Checks whether the code blocks of a fence language are only executed when
+// they opt in with the exec attribute.
+func IsOptInLanguage(language string) bool {
+	return optInLanguages[language]
+}
+
+// Checks whether a code block is executed given its language and the
+// attributes of its fence.
+func ShouldExecute(language string, attributes map[string]string) bool {
+	if _, ok := executors[language]; !ok {
+		return false
+	}
+	if !optInLanguages[language] {
+		return true
+	}
+
+	execute, _ := strconv.ParseBool(attributes[ExecuteAttribute])
+	return execute
+}
+
+// Gets the executor registered for a fence language.
+func GetExecutor(language string) (Executor, error) {
+	executor, ok := executors[language]
+	if !ok {
+		return nil, fmt.Errorf("no executor is registered for the language '%s'", language)
+	}
+	return executor, nil
+}
+
+// Lists the fence languages that have a registered executor.
+func ExecutableLanguages() []string {
+	languages := make([]string, 0, len(executors))
+	for language := range executors {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Options for tearing down executors at the end of a scenario.
+type TeardownOptions struct {
+	// Keep the resources created by the scenario instead of deleting them.
+	PreserveResources bool
+}
+
+// Implemented by executors that keep state between code blocks, such as an
+// interpreter that is kept alive or resources that were deployed, which must
+// be released at the end of a scenario.
+type TeardownExecutor interface {
+	Teardown(options TeardownOptions) error
+}
+
+// Implemented by executors whose code blocks behave differently once they are
+// converted into shell commands, such as an interpreter whose state no longer
+// carries over between code blocks.
+type ShellCommandWarner interface {
+	ShellCommandWarning() string
+}
+
+// Tears down every registered executor that keeps state between code blocks.
+func TeardownExecutors(options TeardownOptions) error {
+	tornDown := make(map[Executor]bool)
+	var errs []error
+
+	for _, language := range ExecutableLanguages() {
+		executor := executors[language]
+		teardownExecutor, ok := executor.(TeardownExecutor)
+		if !ok || tornDown[executor] {
+			continue
+		}
+
+		tornDown[executor] = true
+		if err := teardownExecutor.Teardown(options); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func init() {
+	RegisterExecutor(bashExecutor{}, "bash", "azurecli", "azurecli-interactive")
+	RegisterExecutor(newTerraformExecutor(), "terraform")
+	RegisterOptInExecutor(shExecutor{}, "sh")
+	RegisterOptInExecutor(newPersistentPythonExecutor(), "python", "python3")
+	RegisterOptInExecutor(nodeExecutor, "javascript", "js", "node")
+	RegisterOptInExecutor(powershellExecutor, "powershell", "pwsh")
+	RegisterOptInExecutor(httpExecutor{}, "http")
+}
+
+// Executes code blocks with bash, sharing state between them through the
+// environment state files.
+type bashExecutor struct{}
+
+func (bashExecutor) Execute(script string, config ExecutorConfiguration) (CommandOutput, error) {
+	return ExecuteBashCommand(script, config.BashCommandConfiguration)
+}
+
+func (bashExecutor) ToShellCommand(script string) string {
+	return script
+}
+
+// Executes code blocks with a POSIX shell.
+type shExecutor struct{}
+
+func (shExecutor) Execute(script string, config ExecutorConfiguration) (CommandOutput, error) {
+	scriptWithStateSaved := strings.Join([]string{
+		"set -e",
+		script,
+		"IE_LAST_COMMAND_EXIT_CODE=\"$?\"",
+		"env > " + lib.DefaultEnvironmentStateFile,
+		"pwd > " + lib.DefaultWorkingDirectoryStateFile,
+		"exit $IE_LAST_COMMAND_EXIT_CODE",
+	}, "\n")
+
+	return runCommand(exec.Command("sh", "-c", scriptWithStateSaved), script, config.BashCommandConfiguration)
+}
+
+func (shExecutor) ToShellCommand(script string) string {
+	return heredocCommand("sh", script)
+}
+
+// Executes code blocks by writing them to a file and running an interpreter on
+// it. The prologue and epilogue are rendered with the paths of the environment
+// and working directory state files, and are responsible for saving the state
+// of the interpreter when the script finishes.
+type interpreterExecutor struct {
+	program   string
+	extension string
+	prologue  string
+	epilogue  string
+}
+
+var nodeExecutor = interpreterExecutor{
+	program:   "node",
+	extension: ".js",
+	prologue: `process.on("exit", () => {
+  const fs = require("fs");
+  fs.writeFileSync(%[1]q, Object.entries(process.env).map(([key, value]) => key + "=" + value + "\n").join(""));
+  fs.writeFileSync(%[2]q, process.cwd() + "\n");
+});
+`,
+}
+
+var powershellExecutor = interpreterExecutor{
+	program:   "pwsh",
+	extension: ".ps1",
+	prologue:  "$ErrorActionPreference = 'Stop'\n",
+	epilogue: `
+Get-ChildItem env: | ForEach-Object { "$($_.Name)=$($_.Value)" } | Set-Content -Path %[1]q
+(Get-Location).Path | Set-Content -Path %[2]q
+`,
+}
+
+func (executor interpreterExecutor) Execute(
+	script string,
+	config ExecutorConfiguration,
+) (CommandOutput, error) {
+	if _, err := exec.LookPath(executor.program); err != nil {
+		return CommandOutput{}, fmt.Errorf("'%s' is required to execute this code block: %w", executor.program, err)
+	}
+
+	file, err := os.CreateTemp("", "ie-*"+executor.extension)
+	if err != nil {
+		return CommandOutput{}, fmt.Errorf("failed to create a temporary script: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(executor.wrap(script))
+	file.Close()
+	if err != nil {
+		return CommandOutput{}, fmt.Errorf("failed to write the temporary script: %w", err)
+	}
+
+	// Interpreter scripts can't be replayed from the bash history.
+	config.WriteToHistory = false
+
+	return runCommand(exec.Command(executor.program, file.Name()), script, config.BashCommandConfiguration)
+}
+
+// Surrounds a script with the code that saves the state of the interpreter.
+func (executor interpreterExecutor) wrap(script string) string {
+	render := func(template string) string {
+		if template == "" {
+			return ""
+		}
+		return fmt.Sprintf(
+			template,
+			lib.DefaultEnvironmentStateFile,
+			lib.DefaultWorkingDirectoryStateFile,
+		)
+	}
+
+	return render(executor.prologue) + script + "\n" + render(executor.epilogue)
+}
+
+func (executor interpreterExecutor) ToShellCommand(script string) string {
+	return heredocCommand(executor.program, script)
+}
+
+// Renders a command that passes a script to a program through a quoted heredoc
+// so that bash doesn't expand it.
+func heredocCommand(program string, script string) string {
+	return fmt.Sprintf("%s <<'IE_EOF'\n%s\nIE_EOF", program, strings.TrimSuffix(script, "\n"))
+}
@@ -0,0 +1,106 @@
+package shells
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func executeWithRegistry(t *testing.T, language string, script string) CommandOutput {
+	executor, err := GetExecutor(language)
+	if err != nil {
+		t.Fatalf("Expected an executor for %s, got %v", language, err)
+	}
+
+	output, err := executor.Execute(script, ExecutorConfiguration{
+		BashCommandConfiguration: BashCommandConfiguration{
+			EnvironmentVariables: nil,
+			InheritEnvironment:   true,
+			InteractiveCommand:   false,
+			WriteToHistory:       false,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected err to be nil, got %v", err)
+	}
+
+	return output
+}
+
+func TestExecutorRegistry(t *testing.T) {
+	t.Run("Languages are registered", func(t *testing.T) {
+		languages := strings.Join(ExecutableLanguages(), ",")
+		for _, language := range []string{"bash", "azurecli", "sh", "python3", "node", "pwsh", "http"} {
+			if !strings.Contains(languages, language) {
+				t.Errorf("Expected %s to be registered, got %s", language, languages)
+			}
+		}
+
+		if _, err := GetExecutor("cobol"); err == nil {
+			t.Errorf("Expected an error for an unregistered language")
+		}
+	})
+
+	// Ensures that environment variables set by one language are visible to
+	// code blocks of another language.
+	t.Run("Environment variables flow between languages", func(t *testing.T) {
+		for _, program := range []string{"python3", "node"} {
+			if _, err := exec.LookPath(program); err != nil {
+				t.Skipf("%s is not installed", program)
+			}
+		}
+		defer TeardownExecutors(TeardownOptions{})
+
+		executeWithRegistry(t, "bash", "export IE_FROM_BASH=bash")
+
+		output := executeWithRegistry(t, "python3",
+			"import os\nprint(os.environ['IE_FROM_BASH'])\nos.environ['IE_FROM_PYTHON'] = 'python'")
+		if output.StdOut != "bash\n" {
+			t.Errorf("Expected python to see the bash variable, got '%s'", output.StdOut)
+		}
+
+		output = executeWithRegistry(t, "node",
+			"console.log(process.env.IE_FROM_PYTHON)\nprocess.env.IE_FROM_NODE = 'node'")
+		if output.StdOut != "python\n" {
+			t.Errorf("Expected node to see the python variable, got '%s'", output.StdOut)
+		}
+
+		output = executeWithRegistry(t, "sh", "echo $IE_FROM_NODE")
+		if output.StdOut != "node\n" {
+			t.Errorf("Expected sh to see the node variable, got '%s'", output.StdOut)
+		}
+	})
+
+	t.Run("Illustration languages only execute when they opt in", func(t *testing.T) {
+		if !ShouldExecute("bash", nil) || !ShouldExecute("terraform", nil) {
+			t.Errorf("Expected bash and terraform to execute without opting in")
+		}
+
+		for _, language := range []string{"sh", "python", "node", "pwsh", "http"} {
+			if ShouldExecute(language, nil) || ShouldExecute(language, map[string]string{"exec": "false"}) {
+				t.Errorf("Expected %s not to execute without exec=true", language)
+			}
+			if !ShouldExecute(language, map[string]string{"exec": "true"}) {
+				t.Errorf("Expected %s to execute with exec=true", language)
+			}
+		}
+
+		if ShouldExecute("cobol", map[string]string{"exec": "true"}) {
+			t.Errorf("Expected an unregistered language not to execute")
+		}
+	})
+
+	t.Run("Scripts are converted to shell commands", func(t *testing.T) {
+		executor, _ := GetExecutor("python3")
+		command := executor.ToShellCommand("print('$HOME')\n")
+		if command != "python3 <<'IE_EOF'\nprint('$HOME')\nIE_EOF" {
+			t.Errorf("Unexpected shell command '%s'", command)
+		}
+
+		executor, _ = GetExecutor("http")
+		command = executor.ToShellCommand("POST $HOST/items\nContent-Type: application/json\n\n{\"a\": 1}\n")
+		if command != `curl -sS -X POST "$HOST/items" -H "Content-Type: application/json" --data "{\"a\": 1}"` {
+			t.Errorf("Unexpected shell command '%s'", command)
+		}
+	})
+}
@@ -0,0 +1,272 @@
+package shells
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+)
+
+// The defaults used for HTTP requests that don't configure a timeout or
+// retries.
+const (
+	DefaultHttpTimeout       = 30 * time.Second
+	DefaultHttpRetries       = 0
+	DefaultHttpRetryInterval = time.Second
+)
+
+// The configuration used to execute an HTTP request.
+type HttpRequestConfiguration struct {
+	EnvironmentVariables map[string]string
+	InheritEnvironment   bool
+	// The time to wait for each attempt of the request.
+	Timeout time.Duration
+	// The number of times a request is retried when it can't be sent or the
+	// server responds with a 5xx status code.
+	Retries       int
+	RetryInterval time.Duration
+}
+
+var ExecuteHttpRequest = executeHttpRequestImpl
+
+// Executes an HTTP request written in the format of an ```http``` code block:
+//
+//	POST https://$HOST/api/items
+//	Content-Type: application/json
+//
+//	{"name": "$ITEM_NAME"}
+//
+// The method defaults to GET when only a URL is provided. Environment
+// variables are expanded in the request line, headers and body. The body of
+// the response is returned as the standard output, along with its status code
+// and headers.
+func executeHttpRequestImpl(
+	request string,
+	config HttpRequestConfiguration,
+) (CommandOutput, error) {
+	env := lib.GetCurrentEnvironment(config.EnvironmentVariables)
+	expanded := os.Expand(request, func(name string) string {
+		if value, ok := env[name]; ok {
+			return value
+		}
+		if config.InheritEnvironment {
+			return os.Getenv(name)
+		}
+		return ""
+	})
+
+	method, url, headers, body, err := parseHttpRequest(expanded)
+	if err != nil {
+		return CommandOutput{}, err
+	}
+
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHttpTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+
+	var output CommandOutput
+	for attempt := 0; ; attempt++ {
+		output, err = sendHttpRequest(client, method, url, headers, body)
+		retryable := err != nil || output.StatusCode >= http.StatusInternalServerError
+
+		if !retryable || attempt >= config.Retries {
+			return output, err
+		}
+
+		logging.GlobalLogger.Warnf(
+			"HTTP request %s %s failed (attempt %d of %d), retrying: %v",
+			method,
+			url,
+			attempt+1,
+			config.Retries+1,
+			describeHttpFailure(output, err),
+		)
+
+		if config.RetryInterval > 0 {
+			time.Sleep(config.RetryInterval)
+		}
+	}
+}
+
+func describeHttpFailure(output CommandOutput, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("status %d", output.StatusCode)
+}
+
+func sendHttpRequest(
+	client *http.Client,
+	method string,
+	url string,
+	headers http.Header,
+	body string,
+) (CommandOutput, error) {
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		return CommandOutput{}, fmt.Errorf("invalid HTTP request: %w", err)
+	}
+	request.Header = headers.Clone()
+
+	logging.GlobalLogger.Infof("Sending HTTP request %s %s", method, url)
+	response, err := client.Do(request)
+	if err != nil {
+		return CommandOutput{}, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return CommandOutput{}, fmt.Errorf("failed to read the HTTP response: %w", err)
+	}
+
+	return CommandOutput{
+		StdOut:     string(responseBody),
+		StatusCode: response.StatusCode,
+		Headers:    response.Header,
+	}, nil
+}
+
+// Splits an HTTP request into its method, URL, headers and body.
+func parseHttpRequest(request string) (string, string, http.Header, string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(request))
+	headers := http.Header{}
+
+	// Skip blank lines and comments before the request line.
+	var requestLine string
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		requestLine = line
+		break
+	}
+
+	fields := strings.Fields(requestLine)
+	var method, url string
+	switch len(fields) {
+	case 0:
+		return "", "", nil, "", fmt.Errorf("HTTP request is missing a URL")
+	case 1:
+		method, url = http.MethodGet, fields[0]
+	default:
+		// The HTTP version (I.E. HTTP/1.1) is optional and ignored.
+		method, url = strings.ToUpper(fields[0]), fields[1]
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			return "", "", nil, "", fmt.Errorf("invalid HTTP header %q", line)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	var bodyLines []string
+	for scanner.Scan() {
+		bodyLines = append(bodyLines, scanner.Text())
+	}
+
+	return method, url, headers, strings.TrimSpace(strings.Join(bodyLines, "\n")), scanner.Err()
+}
+
+// Executes ```http``` code blocks. The timeout and retries of the request can
+// be configured with the attributes of the code block, I.E.
+// ```http timeout=10s retries=3 retry_interval=5s```.
+type httpExecutor struct{}
+
+func (httpExecutor) Execute(request string, config ExecutorConfiguration) (CommandOutput, error) {
+	httpConfig, err := httpRequestConfiguration(config.Attributes)
+	if err != nil {
+		return CommandOutput{}, err
+	}
+
+	httpConfig.EnvironmentVariables = config.EnvironmentVariables
+	httpConfig.InheritEnvironment = config.InheritEnvironment
+
+	return ExecuteHttpRequest(request, httpConfig)
+}
+
+// Renders the request as a curl command. Environment variables are left for
+// bash to expand.
+func (httpExecutor) ToShellCommand(request string) string {
+	method, url, headers, body, err := parseHttpRequest(request)
+	if err != nil {
+		return "# " + strings.ReplaceAll(strings.TrimSpace(request), "\n", "\n# ")
+	}
+
+	command := []string{"curl", "-sS", "-X", method, shellDoubleQuote(url)}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range headers[name] {
+			command = append(command, "-H", shellDoubleQuote(name+": "+value))
+		}
+	}
+
+	if body != "" {
+		command = append(command, "--data", shellDoubleQuote(body))
+	}
+
+	return strings.Join(command, " ")
+}
+
+func httpRequestConfiguration(attributes map[string]string) (HttpRequestConfiguration, error) {
+	config := HttpRequestConfiguration{
+		Timeout:       DefaultHttpTimeout,
+		Retries:       DefaultHttpRetries,
+		RetryInterval: DefaultHttpRetryInterval,
+	}
+
+	var err error
+	if timeout, ok := attributes["timeout"]; ok {
+		config.Timeout, err = time.ParseDuration(timeout)
+		if err != nil || config.Timeout <= 0 {
+			return config, fmt.Errorf("invalid duration for timeout: %q", timeout)
+		}
+	}
+
+	if retries, ok := attributes["retries"]; ok {
+		config.Retries, err = strconv.Atoi(retries)
+		if err != nil || config.Retries < 0 {
+			return config, fmt.Errorf("invalid value for retries: %q", retries)
+		}
+	}
+
+	if retryInterval, ok := attributes["retry_interval"]; ok {
+		config.RetryInterval, err = time.ParseDuration(retryInterval)
+		if err != nil || config.RetryInterval < 0 {
+			return config, fmt.Errorf("invalid duration for retry_interval: %q", retryInterval)
+		}
+	}
+
+	return config, nil
+}
+
+// Quotes a value for bash while still allowing environment variables to be
+// expanded.
+func shellDoubleQuote(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`")
+	return `"` + replacer.Replace(value) + `"`
+}
@@ -0,0 +1,110 @@
+package shells
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHttpRequestExecution(t *testing.T) {
+	// Ensures that the request line, headers and body are sent with the
+	// environment variables expanded.
+	t.Run("Sending a request", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if r.Method != http.MethodPost || r.URL.Path != "/items/42" {
+				t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			}
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				t.Errorf("Unexpected authorization header '%s'", r.Header.Get("Authorization"))
+			}
+			if string(body) != `{"name": "widget"}` {
+				t.Errorf("Unexpected body '%s'", body)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": 42}`))
+		}))
+		defer server.Close()
+
+		output, err := ExecuteHttpRequest(
+			"POST $SERVER/items/$ITEM_ID HTTP/1.1\n"+
+				"Authorization: Bearer $TOKEN\n"+
+				"\n"+
+				`{"name": "$ITEM_NAME"}`+"\n",
+			HttpRequestConfiguration{
+				EnvironmentVariables: map[string]string{
+					"SERVER":    server.URL,
+					"ITEM_ID":   "42",
+					"TOKEN":     "secret",
+					"ITEM_NAME": "widget",
+				},
+			},
+		)
+		if err != nil {
+			t.Errorf("Expected err to be nil, got %v", err)
+		}
+		if output.StatusCode != http.StatusCreated {
+			t.Errorf("Expected status 201, got %d", output.StatusCode)
+		}
+		if output.StdOut != `{"id": 42}` {
+			t.Errorf("Expected the response body, got '%s'", output.StdOut)
+		}
+		if http.Header(output.Headers).Get("Content-Type") != "application/json" {
+			t.Errorf("Expected the response headers, got %v", output.Headers)
+		}
+	})
+
+	// Ensures that server errors are retried.
+	t.Run("Retrying a request", func(t *testing.T) {
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			if attempts < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+
+		output, err := ExecuteHttpRequest(
+			server.URL,
+			HttpRequestConfiguration{Retries: 2, RetryInterval: time.Millisecond},
+		)
+		if err != nil {
+			t.Errorf("Expected err to be nil, got %v", err)
+		}
+		if attempts != 3 || output.StatusCode != http.StatusOK {
+			t.Errorf("Expected 3 attempts ending in a 200, got %d attempts and %d", attempts, output.StatusCode)
+		}
+	})
+
+	// Ensures that requests which take too long fail.
+	t.Run("Timing out a request", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer server.Close()
+
+		_, err := ExecuteHttpRequest(
+			"GET "+server.URL,
+			HttpRequestConfiguration{Timeout: 20 * time.Millisecond},
+		)
+		if err == nil {
+			t.Errorf("Expected the request to time out")
+		}
+	})
+
+	// Ensures that malformed requests are rejected.
+	t.Run("Invalid requests", func(t *testing.T) {
+		for _, request := range []string{"", "GET http://localhost\nnot a header\n"} {
+			if _, err := ExecuteHttpRequest(request, HttpRequestConfiguration{}); err == nil {
+				t.Errorf("Expected an error for the request %q", request)
+			}
+		}
+	})
+}
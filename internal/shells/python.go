@@ -0,0 +1,305 @@
+package shells
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+)
+
+// The program that runs within the persistent python interpreter. It reads one
+// JSON request per code block from file descriptor 4, executes the code within
+// a namespace that is shared by every code block, and writes the result to
+// file descriptor 3. The output of each code block is captured at the file
+// descriptor level so that the output of subprocesses is captured as well.
+const pythonDriver = `
+import json, os, sys, tempfile, traceback
+
+requests = os.fdopen(4, "r")
+responses = os.fdopen(3, "w")
+namespace = {"__name__": "__main__"}
+
+
+def read(capture):
+    capture.seek(0)
+    return capture.read().decode("utf-8", "replace")
+
+
+for line in requests:
+    request = json.loads(line)
+    os.environ.clear()
+    os.environ.update(request["env"])
+    if request["cwd"]:
+        os.chdir(request["cwd"])
+
+    stdout, stderr = tempfile.TemporaryFile(), tempfile.TemporaryFile()
+    sys.stdout.flush()
+    sys.stderr.flush()
+    saved_stdout, saved_stderr = os.dup(1), os.dup(2)
+    os.dup2(stdout.fileno(), 1)
+    os.dup2(stderr.fileno(), 2)
+
+    error = None
+    try:
+        exec(compile(request["code"], "<code block>", "exec"), namespace)
+    except SystemExit as exit:
+        if exit.code not in (None, 0):
+            error = "SystemExit: %s" % exit.code
+    except BaseException:
+        error = traceback.format_exc()
+    finally:
+        sys.stdout.flush()
+        sys.stderr.flush()
+        os.dup2(saved_stdout, 1)
+        os.dup2(saved_stderr, 2)
+        os.close(saved_stdout)
+        os.close(saved_stderr)
+
+    missing = []
+    for name in request["export"]:
+        if name in namespace:
+            os.environ[name] = str(namespace[name])
+        else:
+            missing.append(name)
+
+    with open(request["environmentFile"], "w") as state:
+        state.writelines("%s=%s\n" % item for item in os.environ.items())
+    with open(request["workingDirectoryFile"], "w") as state:
+        state.write(os.getcwd() + "\n")
+
+    responses.write(json.dumps({
+        "stdout": read(stdout),
+        "stderr": read(stderr),
+        "error": error,
+        "missing": missing,
+    }) + "\n")
+    responses.flush()
+`
+
+type pythonRequest struct {
+	Code                 string            `json:"code"`
+	Env                  map[string]string `json:"env"`
+	Cwd                  string            `json:"cwd"`
+	Export               []string          `json:"export"`
+	EnvironmentFile      string            `json:"environmentFile"`
+	WorkingDirectoryFile string            `json:"workingDirectoryFile"`
+}
+
+type pythonResponse struct {
+	StdOut  string   `json:"stdout"`
+	StdErr  string   `json:"stderr"`
+	Error   *string  `json:"error"`
+	Missing []string `json:"missing"`
+}
+
+// Executes python code blocks within a single interpreter that is kept alive
+// until the executor is closed, so that imports and variables carry over
+// between code blocks. Variables can be exported to the environment of later
+// code blocks with the `export` attribute, I.E. ```python export=ROW_COUNT```.
+type persistentPythonExecutor struct {
+	mutex     sync.Mutex
+	process   *exec.Cmd
+	requests  io.WriteCloser
+	responses *bufio.Reader
+	done      chan struct{}
+	output    *synchronizedBuffer
+}
+
+func newPersistentPythonExecutor() *persistentPythonExecutor {
+	return &persistentPythonExecutor{}
+}
+
+// Starts the interpreter if it isn't already running.
+func (executor *persistentPythonExecutor) start() error {
+	if executor.process != nil {
+		select {
+		case <-executor.done:
+			logging.GlobalLogger.Warn("The python interpreter exited, starting a new one")
+		default:
+			return nil
+		}
+	}
+
+	if _, err := exec.LookPath("python3"); err != nil {
+		return fmt.Errorf("'python3' is required to execute this code block: %w", err)
+	}
+
+	requestReader, requestWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create the python request pipe: %w", err)
+	}
+
+	responseReader, responseWriter, err := os.Pipe()
+	if err != nil {
+		requestReader.Close()
+		requestWriter.Close()
+		return fmt.Errorf("failed to create the python response pipe: %w", err)
+	}
+
+	process := exec.Command("python3", "-u", "-c", pythonDriver)
+	process.ExtraFiles = []*os.File{responseWriter, requestReader}
+
+	// The output of code blocks is captured by the driver, so anything written
+	// here comes from the interpreter itself.
+	interpreterOutput := &synchronizedBuffer{}
+	process.Stdout = interpreterOutput
+	process.Stderr = interpreterOutput
+
+	err = process.Start()
+	// The interpreter holds its own copies of these ends of the pipes.
+	requestReader.Close()
+	responseWriter.Close()
+	if err != nil {
+		requestWriter.Close()
+		responseReader.Close()
+		return fmt.Errorf("failed to start the python interpreter: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		process.Wait()
+		responseReader.Close()
+		close(done)
+	}()
+
+	logging.GlobalLogger.Infof("Started a python interpreter with the pid %d", process.Process.Pid)
+
+	executor.process = process
+	executor.requests = requestWriter
+	executor.responses = bufio.NewReader(responseReader)
+	executor.done = done
+	executor.output = interpreterOutput
+
+	return nil
+}
+
+func (executor *persistentPythonExecutor) Execute(
+	script string,
+	config ExecutorConfiguration,
+) (CommandOutput, error) {
+	executor.mutex.Lock()
+	defer executor.mutex.Unlock()
+
+	if err := executor.start(); err != nil {
+		return CommandOutput{}, err
+	}
+
+	env := lib.GetCurrentEnvironment(config.EnvironmentVariables)
+	if config.InheritEnvironment {
+		env = lib.MergeMaps(lib.GetEnvironmentVariables(), env)
+	}
+
+	workingDirectory, _ := lib.LoadWorkingDirectoryStateFile(lib.DefaultWorkingDirectoryStateFile)
+
+	export := []string{}
+	for _, name := range strings.Split(config.Attributes["export"], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			export = append(export, name)
+		}
+	}
+
+	request, err := json.Marshal(pythonRequest{
+		Code:                 script,
+		Env:                  env,
+		Cwd:                  workingDirectory,
+		Export:               export,
+		EnvironmentFile:      lib.DefaultEnvironmentStateFile,
+		WorkingDirectoryFile: lib.DefaultWorkingDirectoryStateFile,
+	})
+	if err != nil {
+		return CommandOutput{}, err
+	}
+
+	if _, err := executor.requests.Write(append(request, '\n')); err != nil {
+		return CommandOutput{}, fmt.Errorf("failed to send the code block to python: %w", err)
+	}
+
+	line, err := executor.responses.ReadBytes('\n')
+	if err != nil {
+		<-executor.done
+		return CommandOutput{}, fmt.Errorf(
+			"the python interpreter exited unexpectedly: %w\n%s",
+			err,
+			executor.output.String(),
+		)
+	}
+
+	var response pythonResponse
+	if err := json.Unmarshal(line, &response); err != nil {
+		return CommandOutput{}, fmt.Errorf("invalid response from the python interpreter: %w", err)
+	}
+
+	output := CommandOutput{StdOut: response.StdOut, StdErr: response.StdErr}
+
+	if len(response.Missing) > 0 {
+		logging.GlobalLogger.Warnf(
+			"Could not export the python variables %s because they are not defined",
+			strings.Join(response.Missing, ", "),
+		)
+	}
+
+	if response.Error != nil {
+		output.StdErr += *response.Error
+		return output, fmt.Errorf(
+			"command exited with '%s' and the message '%s'",
+			"python exception",
+			*response.Error,
+		)
+	}
+
+	return output, nil
+}
+
+func (executor *persistentPythonExecutor) ToShellCommand(script string) string {
+	return heredocCommand("python3", script)
+}
+
+// Each code block is converted into its own python3 command, so the state of
+// the interpreter isn't shared between them like it is when they are executed.
+func (executor *persistentPythonExecutor) ShellCommandWarning() string {
+	return "Python code blocks run in separate python3 processes in this script, " +
+		"so imports and variables don't carry over between them like they do " +
+		"when the scenario is executed. Export values through environment variables instead."
+}
+
+// Stops the interpreter at the end of a scenario.
+func (executor *persistentPythonExecutor) Teardown(options TeardownOptions) error {
+	return executor.Close()
+}
+
+// Stops the interpreter, discarding its state. The next code block starts a
+// new interpreter.
+func (executor *persistentPythonExecutor) Close() error {
+	executor.mutex.Lock()
+	defer executor.mutex.Unlock()
+
+	if executor.process == nil {
+		return nil
+	}
+
+	// Closing the requests ends the loop of the driver.
+	executor.requests.Close()
+
+	var err error
+	select {
+	case <-executor.done:
+	case <-time.After(backgroundTerminationGracePeriod):
+		err = errors.Join(
+			errors.New("the python interpreter did not exit, killing it"),
+			executor.process.Process.Kill(),
+		)
+		<-executor.done
+	}
+
+	executor.process = nil
+	return err
+}
@@ -0,0 +1,102 @@
+package shells
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestPersistentPythonExecution(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is not installed")
+	}
+
+	executor := newPersistentPythonExecutor()
+	defer executor.Close()
+
+	execute := func(script string, attributes map[string]string) (CommandOutput, error) {
+		return executor.Execute(script, ExecutorConfiguration{
+			BashCommandConfiguration: BashCommandConfiguration{
+				EnvironmentVariables: nil,
+				InheritEnvironment:   true,
+				InteractiveCommand:   false,
+				WriteToHistory:       false,
+			},
+			Attributes: attributes,
+		})
+	}
+
+	// Ensures that imports and variables carry over between code blocks.
+	t.Run("State is kept between code blocks", func(t *testing.T) {
+		if _, err := execute("import math\nradius = 2", nil); err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+
+		output, err := execute("print(round(math.pi * radius ** 2, 2))", nil)
+		if err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+		if output.StdOut != "12.57\n" {
+			t.Errorf("Expected the area, got '%s'", output.StdOut)
+		}
+	})
+
+	// Ensures that output is captured per code block, including the output of
+	// subprocesses.
+	t.Run("Output is captured per code block", func(t *testing.T) {
+		output, err := execute(
+			"import os, sys\nprint('out')\nprint('err', file=sys.stderr)\nos.system('echo child')",
+			nil,
+		)
+		if err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+		if output.StdOut != "out\nchild\n" || output.StdErr != "err\n" {
+			t.Errorf("Unexpected output '%s' and '%s'", output.StdOut, output.StdErr)
+		}
+	})
+
+	// Ensures that exceptions fail the code block without losing the state of
+	// the interpreter.
+	t.Run("Exceptions are captured", func(t *testing.T) {
+		output, err := execute("print('before')\nraise ValueError('bad value')", nil)
+		if err == nil {
+			t.Fatalf("Expected an error for the exception")
+		}
+		if output.StdOut != "before\n" || !strings.Contains(output.StdErr, "ValueError: bad value") {
+			t.Errorf("Unexpected output '%s' and '%s'", output.StdOut, output.StdErr)
+		}
+
+		output, err = execute("print(radius)", nil)
+		if err != nil || output.StdOut != "2\n" {
+			t.Errorf("Expected the state to be kept, got '%s' (%v)", output.StdOut, err)
+		}
+	})
+
+	// Ensures that exported variables are visible to bash code blocks.
+	t.Run("Variables are exported to the environment", func(t *testing.T) {
+		_, err := execute("row_count = 42", map[string]string{"export": "row_count, undefined"})
+		if err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+
+		output, err := ExecuteBashCommand("echo $row_count", BashCommandConfiguration{
+			InheritEnvironment: true,
+		})
+		if err != nil || output.StdOut != "42\n" {
+			t.Errorf("Expected bash to see the exported variable, got '%s' (%v)", output.StdOut, err)
+		}
+	})
+
+	// Ensures that closing the executor discards the state of the interpreter.
+	t.Run("Closing the executor", func(t *testing.T) {
+		if err := executor.Close(); err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+
+		_, err := execute("print(radius)", nil)
+		if err == nil {
+			t.Errorf("Expected the state to be discarded")
+		}
+	})
+}
@@ -0,0 +1,218 @@
+package shells
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+)
+
+// The directory that terraform code blocks are written to when a scenario is
+// exported as a shell script.
+const terraformShellDirectory = "ie-terraform"
+
+// Executes terraform code blocks. The HCL of every code block in a scenario is
+// written into a single working directory and applied with init, plan and
+// apply, so that later code blocks can reference the resources of earlier
+// ones. The outputs of the configuration are exported as upper case
+// environment variables, and the resources are destroyed when the scenario is
+// torn down.
+type terraformExecutor struct {
+	mutex     sync.Mutex
+	directory string
+	blocks    int
+	// The configuration the last code block was applied with. The resources
+	// are destroyed with it, as the state files holding the variables of the
+	// scenario may have been cleaned up by the time the scenario is torn down.
+	applyConfig BashCommandConfiguration
+}
+
+func newTerraformExecutor() *terraformExecutor {
+	return &terraformExecutor{}
+}
+
+// The JSON rendered by `terraform output -json`.
+type terraformOutput struct {
+	Value json.RawMessage `json:"value"`
+}
+
+func (executor *terraformExecutor) Execute(
+	script string,
+	config ExecutorConfiguration,
+) (CommandOutput, error) {
+	if _, err := exec.LookPath("terraform"); err != nil {
+		return CommandOutput{}, fmt.Errorf("'terraform' is required to execute this code block: %w", err)
+	}
+
+	executor.mutex.Lock()
+	defer executor.mutex.Unlock()
+
+	if executor.directory == "" {
+		directory, err := os.MkdirTemp("", "ie-terraform-*")
+		if err != nil {
+			return CommandOutput{}, fmt.Errorf("failed to create the terraform working directory: %w", err)
+		}
+		executor.directory = directory
+		executor.blocks = 0
+		logging.GlobalLogger.Infof("Using %s as the terraform working directory", directory)
+	}
+
+	executor.blocks++
+	file := filepath.Join(executor.directory, fmt.Sprintf("block-%02d.tf", executor.blocks))
+	if err := os.WriteFile(file, []byte(script), 0644); err != nil {
+		return CommandOutput{}, fmt.Errorf("failed to write the terraform configuration: %w", err)
+	}
+
+	environment := config.EnvironmentVariables
+	if state, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile); err == nil {
+		environment = lib.MergeMaps(environment, state)
+	}
+	executor.applyConfig = BashCommandConfiguration{
+		EnvironmentVariables: environment,
+		InheritEnvironment:   config.InheritEnvironment,
+	}
+
+	var output CommandOutput
+	for _, arguments := range [][]string{
+		{"init", "-input=false", "-no-color"},
+		{"plan", "-input=false", "-no-color", "-out=tfplan"},
+		{"apply", "-input=false", "-no-color", "-auto-approve", "tfplan"},
+	} {
+		stepOutput, err := runTerraform(executor.directory, arguments, config)
+		// The output of init is noise unless it fails.
+		if arguments[0] != "init" || err != nil {
+			output.StdOut += stepOutput.StdOut
+		}
+		output.StdErr += stepOutput.StdErr
+		if err != nil {
+			return output, fmt.Errorf("terraform %s failed: %w", arguments[0], err)
+		}
+	}
+
+	outputs, err := executor.outputs(config)
+	if err != nil {
+		return output, err
+	}
+
+	env := lib.GetCurrentEnvironment(config.EnvironmentVariables)
+	if config.InheritEnvironment {
+		env = lib.MergeMaps(lib.GetEnvironmentVariables(), env)
+	}
+	env = lib.MergeMaps(env, outputs)
+
+	if err := lib.WriteEnvironmentStateFile(lib.DefaultEnvironmentStateFile, env); err != nil {
+		return output, fmt.Errorf("failed to save the terraform outputs: %w", err)
+	}
+
+	return output, nil
+}
+
+// Runs a terraform command within a terraform working directory.
+func runTerraform(
+	directory string,
+	arguments []string,
+	config ExecutorConfiguration,
+) (CommandOutput, error) {
+	commandConfig := config.BashCommandConfiguration
+	commandConfig.EnvironmentVariables = lib.MergeMaps(
+		config.EnvironmentVariables,
+		map[string]string{"TF_IN_AUTOMATION": "1", "TF_INPUT": "0"},
+	)
+	commandConfig.InteractiveCommand = false
+	commandConfig.WriteToHistory = false
+
+	// -chdir is used because the working directory of the command is restored
+	// from the previous code block.
+	command := exec.Command(
+		"terraform",
+		append([]string{"-chdir=" + directory}, arguments...)...,
+	)
+	return runCommand(command, "terraform "+strings.Join(arguments, " "), commandConfig)
+}
+
+// Reads the outputs of the applied configuration as environment variables.
+// Strings are used as is while other values are rendered as JSON.
+func (executor *terraformExecutor) outputs(config ExecutorConfiguration) (map[string]string, error) {
+	commandOutput, err := runTerraform(executor.directory, []string{"output", "-json", "-no-color"}, config)
+	if err != nil {
+		return nil, fmt.Errorf("terraform output failed: %w", err)
+	}
+
+	var outputs map[string]terraformOutput
+	if err := json.Unmarshal([]byte(commandOutput.StdOut), &outputs); err != nil {
+		return nil, fmt.Errorf("invalid terraform outputs: %w", err)
+	}
+
+	env := make(map[string]string, len(outputs))
+	for name, output := range outputs {
+		var value string
+		if err := json.Unmarshal(output.Value, &value); err != nil {
+			var compacted bytes.Buffer
+			if err := json.Compact(&compacted, output.Value); err != nil {
+				return nil, fmt.Errorf("invalid value for the terraform output '%s': %w", name, err)
+			}
+			value = compacted.String()
+		}
+		env[strings.ToUpper(name)] = value
+	}
+
+	return env, nil
+}
+
+func (executor *terraformExecutor) ToShellCommand(script string) string {
+	// Files are named after their content so that exporting a scenario twice
+	// produces the same script.
+	hash := sha256.Sum256([]byte(script))
+	file := fmt.Sprintf("%s/%x.tf", terraformShellDirectory, hash[:6])
+
+	return strings.Join([]string{
+		"mkdir -p " + terraformShellDirectory,
+		fmt.Sprintf("cat > %s <<'IE_EOF'\n%s\nIE_EOF", file, strings.TrimSuffix(script, "\n")),
+		fmt.Sprintf("terraform -chdir=%s init -input=false", terraformShellDirectory),
+		fmt.Sprintf("terraform -chdir=%s apply -input=false -auto-approve", terraformShellDirectory),
+	}, "\n")
+}
+
+// Destroys the resources created by the scenario unless they should be
+// preserved. The working directory is kept when the resources are preserved or
+// can't be destroyed so that they can be managed by hand.
+func (executor *terraformExecutor) Teardown(options TeardownOptions) error {
+	executor.mutex.Lock()
+	defer executor.mutex.Unlock()
+
+	if executor.directory == "" {
+		return nil
+	}
+
+	directory := executor.directory
+	applyConfig := executor.applyConfig
+	executor.directory = ""
+	executor.applyConfig = BashCommandConfiguration{}
+
+	if options.PreserveResources {
+		logging.GlobalLogger.Infof(
+			"Skipping terraform destroy, the state is kept in %s",
+			directory,
+		)
+		return nil
+	}
+
+	_, err := runTerraform(
+		directory,
+		[]string{"destroy", "-input=false", "-no-color", "-auto-approve"},
+		ExecutorConfiguration{BashCommandConfiguration: applyConfig},
+	)
+	if err != nil {
+		return fmt.Errorf("terraform destroy failed, the state is kept in %s: %w", directory, err)
+	}
+
+	return os.RemoveAll(directory)
+}
@@ -0,0 +1,175 @@
+package shells
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+)
+
+// A fake terraform binary that records its invocations and reports outputs.
+const fakeTerraform = `#!/bin/sh
+echo "$*" >> "$TERRAFORM_LOG"
+case "$2" in
+  output) echo '{"resource_group": {"value": "rg-test"}, "ports": {"value": [80, 443]}}' ;;
+  apply) echo "Apply complete!" ;;
+  plan) echo "Plan: 1 to add" ;;
+  destroy) env > "$TERRAFORM_LOG.env" ;;
+esac
+`
+
+// Puts the fake terraform binary first on the PATH and returns the path of the
+// log of its invocations.
+func installFakeTerraform(t *testing.T) string {
+	binDirectory := t.TempDir()
+	err := os.WriteFile(filepath.Join(binDirectory, "terraform"), []byte(fakeTerraform), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The state saved by a previous test would override the variables.
+	lib.DeleteEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+
+	log := filepath.Join(t.TempDir(), "terraform.log")
+	t.Setenv("PATH", binDirectory+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("TERRAFORM_LOG", log)
+	return log
+}
+
+func readTerraformLog(t *testing.T, log string) []string {
+	content, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var commands []string
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		// Drop the -chdir flag, which points to a temporary directory.
+		commands = append(commands, strings.SplitN(line, " ", 2)[1])
+	}
+	return commands
+}
+
+func TestTerraformExecution(t *testing.T) {
+	defer lib.DeleteEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+
+	config := ExecutorConfiguration{
+		BashCommandConfiguration: BashCommandConfiguration{
+			EnvironmentVariables: map[string]string{"EXISTING": "value"},
+			InheritEnvironment:   true,
+		},
+	}
+
+	// Ensures that the configuration is applied and its outputs are exported,
+	// and that the resources are destroyed when the scenario is torn down.
+	t.Run("Applies the configuration and destroys it", func(t *testing.T) {
+		log := installFakeTerraform(t)
+		executor := newTerraformExecutor()
+
+		output, err := executor.Execute(`resource "null_resource" "test" {}`, config)
+		if err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+		if output.StdOut != "Plan: 1 to add\nApply complete!\n" {
+			t.Errorf("Unexpected output '%s'", output.StdOut)
+		}
+
+		content, err := os.ReadFile(filepath.Join(executor.directory, "block-01.tf"))
+		if err != nil || string(content) != `resource "null_resource" "test" {}` {
+			t.Errorf("Expected the code block to be written, got '%s' (%v)", content, err)
+		}
+
+		env, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env["RESOURCE_GROUP"] != "rg-test" || env["PORTS"] != "[80,443]" {
+			t.Errorf("Expected the outputs to be exported, got '%s' and '%s'", env["RESOURCE_GROUP"], env["PORTS"])
+		}
+		if env["EXISTING"] != "value" {
+			t.Errorf("Expected existing variables to be kept, got '%s'", env["EXISTING"])
+		}
+
+		directory := executor.directory
+		if err := executor.Teardown(TeardownOptions{}); err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+
+		expected := []string{
+			"init -input=false -no-color",
+			"plan -input=false -no-color -out=tfplan",
+			"apply -input=false -no-color -auto-approve tfplan",
+			"output -json -no-color",
+			"destroy -input=false -no-color -auto-approve",
+		}
+		if commands := readTerraformLog(t, log); strings.Join(commands, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("Expected the commands %v, got %v", expected, commands)
+		}
+
+		if _, err := os.Stat(directory); !os.IsNotExist(err) {
+			t.Errorf("Expected the working directory to be removed, got %v", err)
+		}
+	})
+
+	// Ensures that the resources are destroyed with the variables they were
+	// applied with, even after the state files of the scenario are removed.
+	t.Run("Destroys with the environment of apply", func(t *testing.T) {
+		log := installFakeTerraform(t)
+		executor := newTerraformExecutor()
+
+		err := lib.WriteEnvironmentStateFile(
+			lib.DefaultEnvironmentStateFile,
+			map[string]string{"TF_VAR_location": "eastus"},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := executor.Execute(`resource "null_resource" "test" {}`, config); err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+
+		lib.DeleteEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+		if err := executor.Teardown(TeardownOptions{}); err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+
+		env, err := os.ReadFile(log + ".env")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, variable := range []string{"TF_VAR_location=eastus", "EXISTING=value"} {
+			if !strings.Contains(string(env), variable+"\n") {
+				t.Errorf("Expected destroy to be run with %s", variable)
+			}
+		}
+	})
+
+	// Ensures that destroy is skipped when the resources are preserved.
+	t.Run("Preserves the resources", func(t *testing.T) {
+		log := installFakeTerraform(t)
+		executor := newTerraformExecutor()
+
+		if _, err := executor.Execute(`resource "null_resource" "test" {}`, config); err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+
+		directory := executor.directory
+		defer os.RemoveAll(directory)
+
+		if err := executor.Teardown(TeardownOptions{PreserveResources: true}); err != nil {
+			t.Fatalf("Expected err to be nil, got %v", err)
+		}
+
+		for _, command := range readTerraformLog(t, log) {
+			if strings.HasPrefix(command, "destroy") {
+				t.Errorf("Expected destroy to be skipped")
+			}
+		}
+		if _, err := os.Stat(directory); err != nil {
+			t.Errorf("Expected the working directory to be kept, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,324 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+)
+
+// The attributes that IE sets on its spans.
+const (
+	AttributeScenario        = attribute.Key("ie.scenario")
+	AttributeMode            = attribute.Key("ie.mode")
+	AttributeCorrelationId   = attribute.Key("ie.correlation_id")
+	AttributePrerequisite    = attribute.Key("ie.prerequisite.source")
+	AttributeStep            = attribute.Key("ie.step")
+	AttributeCodeBlock       = attribute.Key("ie.code_block")
+	AttributeLanguage        = attribute.Key("ie.language")
+	AttributeFile            = attribute.Key("ie.file")
+	AttributeLine            = attribute.Key("ie.line")
+	AttributeExitCode        = attribute.Key("ie.exit_code")
+	AttributeSimilarityScore = attribute.Key("ie.similarity_score")
+	AttributePolls           = attribute.Key("ie.polls")
+	AttributeResourceGroup   = attribute.Key("azure.resource_group")
+)
+
+// Traces a scenario as it runs. The scenario has a span, with a span for each
+// step within it and a span for each code block within its step. The steps
+// that come from a prerequisite are grouped under a span for the
+// prerequisite, so that the time spent in the prerequisites is easy to tell
+// apart from the time spent in the scenario itself.
+//
+// The methods of a nil trace do nothing, so that code blocks can be executed
+// without one.
+type ScenarioTrace struct {
+	mutex sync.Mutex
+
+	scenario    trace.Span
+	scenarioCtx context.Context
+
+	// The titles of the prerequisites by their source, which is the file of
+	// the code blocks that come from them.
+	prerequisites      map[string]string
+	prerequisite       trace.Span
+	prerequisiteCtx    context.Context
+	prerequisiteSource string
+
+	step       trace.Span
+	stepCtx    context.Context
+	stepNumber int
+
+	block    trace.Span
+	blockCtx context.Context
+}
+
+// Starts the span of a scenario. The prerequisites are the titles of the
+// prerequisites of the scenario by their source.
+func StartScenario(
+	name string,
+	mode string,
+	correlationId string,
+	prerequisites map[string]string,
+) *ScenarioTrace {
+	attributes := []attribute.KeyValue{AttributeScenario.String(name), AttributeMode.String(mode)}
+	if correlationId != "" {
+		attributes = append(attributes, AttributeCorrelationId.String(correlationId))
+	}
+
+	// A scenario joins the trace of whatever launched IE, such as a pipeline
+	// that sets TRACEPARENT.
+	parent := propagation.TraceContext{}.Extract(
+		context.Background(),
+		propagation.MapCarrier{"traceparent": os.Getenv(lib.TraceparentVariable)},
+	)
+
+	ctx, span := tracer().Start(
+		parent,
+		name,
+		trace.WithAttributes(attributes...),
+	)
+
+	return &ScenarioTrace{
+		scenario:      span,
+		scenarioCtx:   ctx,
+		prerequisites: prerequisites,
+		stepNumber:    -1,
+	}
+}
+
+// Ends a span, marking it as failed when there is an error.
+func endSpan(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Ends the span of the code block that is executing, if any. The mutex must be
+// held.
+func (t *ScenarioTrace) endBlock(err error) {
+	endSpan(t.block, err)
+	t.block = nil
+	t.blockCtx = nil
+}
+
+// Ends the span of the step that is executing, if any. The mutex must be held.
+func (t *ScenarioTrace) endStep(err error) {
+	t.endBlock(err)
+	endSpan(t.step, err)
+	t.step = nil
+	t.stepCtx = nil
+	t.stepNumber = -1
+}
+
+// Ends the span of the prerequisite that is executing, if any. The mutex must
+// be held.
+func (t *ScenarioTrace) endPrerequisite(err error) {
+	t.endStep(err)
+	endSpan(t.prerequisite, err)
+	t.prerequisite = nil
+	t.prerequisiteCtx = nil
+	t.prerequisiteSource = ""
+}
+
+// Starts the span of a code block, along with the spans of its step and of
+// the prerequisite it comes from when it is the first of them to start.
+// Steps and code blocks are numbered from zero.
+func (t *ScenarioTrace) StartBlock(
+	step int,
+	stepName string,
+	codeBlock int,
+	block parsers.CodeBlock,
+) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.endBlock(nil)
+
+	// A step that comes from a prerequisite starts its span, and a step that
+	// doesn't ends the span of the last prerequisite.
+	source := ""
+	if _, ok := t.prerequisites[block.Position.File]; ok {
+		source = block.Position.File
+	}
+	if step != t.stepNumber && source != t.prerequisiteSource {
+		t.endPrerequisite(nil)
+		if source != "" {
+			t.prerequisiteCtx, t.prerequisite = tracer().Start(
+				t.scenarioCtx,
+				t.prerequisites[source],
+				trace.WithAttributes(AttributePrerequisite.String(source)),
+			)
+			t.prerequisiteSource = source
+		}
+	}
+
+	if step != t.stepNumber {
+		t.endStep(nil)
+
+		parent := t.scenarioCtx
+		if t.prerequisiteCtx != nil {
+			parent = t.prerequisiteCtx
+		}
+		t.stepCtx, t.step = tracer().Start(
+			parent,
+			stepName,
+			trace.WithAttributes(AttributeStep.Int(step)),
+		)
+		t.stepNumber = step
+	}
+
+	attributes := []attribute.KeyValue{
+		AttributeStep.Int(step),
+		AttributeCodeBlock.Int(codeBlock),
+		AttributeLanguage.String(block.Language),
+	}
+	if block.Position.StartLine != 0 {
+		attributes = append(
+			attributes,
+			AttributeFile.String(block.Position.File),
+			AttributeLine.Int(block.Position.StartLine),
+		)
+	}
+	t.blockCtx, t.block = tracer().Start(
+		t.stepCtx,
+		fmt.Sprintf("Code block %d", codeBlock+1),
+		trace.WithAttributes(attributes...),
+	)
+}
+
+// Records an unsuccessful poll of the code block that is executing as an
+// event of its span.
+func (t *ScenarioTrace) BlockRetried(poll int, err error) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.block == nil {
+		return
+	}
+
+	attributes := []attribute.KeyValue{AttributePolls.Int(poll)}
+	if err != nil {
+		attributes = append(attributes, attribute.String("error", err.Error()))
+	}
+	t.block.AddEvent("retry", trace.WithAttributes(attributes...))
+}
+
+// Ends the span of the code block that is executing with its result. A code
+// block that failed fails its step and prerequisite as well, since the
+// scenario stops there.
+func (t *ScenarioTrace) FinishBlock(exitCode int, similarityScore float64, polls int, err error) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.block == nil {
+		return
+	}
+
+	t.block.SetAttributes(
+		AttributeExitCode.Int(exitCode),
+		AttributeSimilarityScore.Float64(similarityScore),
+	)
+	if polls > 0 {
+		t.block.SetAttributes(AttributePolls.Int(polls))
+	}
+
+	if err != nil {
+		t.endPrerequisite(err)
+		return
+	}
+	t.endBlock(nil)
+}
+
+// Sets the resource group that the scenario deployed to on its span and on the
+// span of the step that created it.
+func (t *ScenarioTrace) SetResourceGroup(name string) {
+	if t == nil || name == "" {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.scenario.SetAttributes(AttributeResourceGroup.String(name))
+	if t.step != nil {
+		t.step.SetAttributes(AttributeResourceGroup.String(name))
+	}
+}
+
+// Starts the span of a cleanup task of the scenario, such as deleting the
+// resource group or stopping background processes, which happens once the
+// steps have ended. The returned function ends the span with the error of the
+// task, if any.
+func (t *ScenarioTrace) StartCleanup(name string) func(error) {
+	if t == nil {
+		return func(error) {}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.endPrerequisite(nil)
+	_, span := tracer().Start(t.scenarioCtx, name)
+	return func(err error) {
+		endSpan(span, err)
+	}
+}
+
+// Gets the traceparent of the code block that is executing, or of the
+// scenario between code blocks, so that the commands a code block runs can
+// join the trace.
+func (t *ScenarioTrace) Traceparent() string {
+	if t == nil {
+		return ""
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.blockCtx != nil {
+		return Traceparent(t.blockCtx)
+	}
+	return Traceparent(t.scenarioCtx)
+}
+
+// Ends the span of the scenario and everything still open within it, and
+// flushes the spans to the collector.
+func (t *ScenarioTrace) End(err error) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.endPrerequisite(nil)
+	endSpan(t.scenario, err)
+	Flush()
+}
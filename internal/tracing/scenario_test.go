@@ -0,0 +1,177 @@
+package tracing
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+)
+
+// Records the spans of the test instead of exporting them.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	SetSpanProcessor(recorder)
+	t.Cleanup(Shutdown)
+	return recorder
+}
+
+// Finds an ended span by its name.
+func findSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	t.Fatalf("no span named %q ended", name)
+	return nil
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attributes := make(map[attribute.Key]attribute.Value)
+	for _, keyValue := range span.Attributes() {
+		attributes[keyValue.Key] = keyValue.Value
+	}
+	return attributes
+}
+
+func codeBlockFrom(file string, line int) parsers.CodeBlock {
+	return parsers.CodeBlock{
+		Language: "bash",
+		Content:  "echo hello",
+		Position: parsers.SourcePosition{File: file, StartLine: line, EndLine: line + 2},
+	}
+}
+
+func TestScenarioTrace(t *testing.T) {
+	t.Run("Steps from prerequisites are grouped under them", func(t *testing.T) {
+		recorder := recordSpans(t)
+
+		trace := StartScenario(
+			"Deploy",
+			"test",
+			"correlation",
+			map[string]string{"prerequisite.md": "Create a resource group"},
+		)
+		trace.StartBlock(0, "Sign in", 0, codeBlockFrom("prerequisite.md", 5))
+		trace.FinishBlock(0, 1, 0, nil)
+		trace.StartBlock(1, "Create the group", 0, codeBlockFrom("prerequisite.md", 10))
+		trace.SetResourceGroup("myResourceGroup")
+		trace.FinishBlock(0, 1, 0, nil)
+		trace.StartBlock(2, "Deploy the app", 0, codeBlockFrom("scenario.md", 20))
+		trace.FinishBlock(0, 0.9, 0, nil)
+		trace.End(nil)
+
+		scenario := findSpan(t, recorder, "Deploy")
+		prerequisite := findSpan(t, recorder, "Create a resource group")
+		signIn := findSpan(t, recorder, "Sign in")
+		createGroup := findSpan(t, recorder, "Create the group")
+		deploy := findSpan(t, recorder, "Deploy the app")
+
+		assert.Equal(t, "correlation", spanAttributes(scenario)[AttributeCorrelationId].AsString())
+		assert.Equal(t, "myResourceGroup", spanAttributes(scenario)[AttributeResourceGroup].AsString())
+		assert.Equal(t, "myResourceGroup", spanAttributes(createGroup)[AttributeResourceGroup].AsString())
+
+		assert.Equal(t, scenario.SpanContext().SpanID(), prerequisite.Parent().SpanID())
+		assert.Equal(t, prerequisite.SpanContext().SpanID(), signIn.Parent().SpanID())
+		assert.Equal(t, prerequisite.SpanContext().SpanID(), createGroup.Parent().SpanID())
+		assert.Equal(t, scenario.SpanContext().SpanID(), deploy.Parent().SpanID())
+		assert.Equal(t, "prerequisite.md", spanAttributes(prerequisite)[AttributePrerequisite].AsString())
+	})
+
+	t.Run("Code blocks carry their result", func(t *testing.T) {
+		recorder := recordSpans(t)
+
+		trace := StartScenario("Deploy", "execute", "", nil)
+		trace.StartBlock(0, "Wait for the app", 0, codeBlockFrom("scenario.md", 3))
+		trace.BlockRetried(1, fmt.Errorf("not ready"))
+		trace.FinishBlock(0, 0.75, 2, nil)
+		trace.End(nil)
+
+		block := findSpan(t, recorder, "Code block 1")
+		attributes := spanAttributes(block)
+		assert.Equal(t, "bash", attributes[AttributeLanguage].AsString())
+		assert.Equal(t, int64(0), attributes[AttributeExitCode].AsInt64())
+		assert.Equal(t, 0.75, attributes[AttributeSimilarityScore].AsFloat64())
+		assert.Equal(t, int64(2), attributes[AttributePolls].AsInt64())
+		assert.Equal(t, "scenario.md", attributes[AttributeFile].AsString())
+		assert.Equal(t, int64(3), attributes[AttributeLine].AsInt64())
+		assert.Len(t, block.Events(), 1)
+		assert.Equal(t, "retry", block.Events()[0].Name)
+		assert.NotContains(t, spanAttributes(findSpan(t, recorder, "Deploy")), AttributeCorrelationId)
+	})
+
+	t.Run("A failed code block fails its step and prerequisite", func(t *testing.T) {
+		recorder := recordSpans(t)
+
+		trace := StartScenario("Deploy", "test", "", map[string]string{"prerequisite.md": "Prerequisite"})
+		trace.StartBlock(0, "Sign in", 0, codeBlockFrom("prerequisite.md", 5))
+		trace.FinishBlock(1, 0, 0, fmt.Errorf("exit status 1"))
+		trace.End(fmt.Errorf("exit status 1"))
+
+		for _, name := range []string{"Code block 1", "Sign in", "Prerequisite", "Deploy"} {
+			span := findSpan(t, recorder, name)
+			assert.Equal(t, codes.Error, span.Status().Code, name)
+		}
+		assert.Equal(t, int64(1), spanAttributes(findSpan(t, recorder, "Code block 1"))[AttributeExitCode].AsInt64())
+	})
+
+	t.Run("Cleanup is traced after the steps", func(t *testing.T) {
+		recorder := recordSpans(t)
+
+		trace := StartScenario("Deploy", "test", "", nil)
+		trace.StartBlock(0, "Create", 0, codeBlockFrom("scenario.md", 1))
+		finishCleanup := trace.StartCleanup("Teardown")
+		finishCleanup(nil)
+		trace.End(nil)
+
+		scenario := findSpan(t, recorder, "Deploy")
+		cleanup := findSpan(t, recorder, "Teardown")
+		assert.Equal(t, scenario.SpanContext().SpanID(), cleanup.Parent().SpanID())
+		assert.False(t, findSpan(t, recorder, "Create").EndTime().After(cleanup.StartTime()))
+	})
+
+	t.Run("The traceparent follows the executing code block", func(t *testing.T) {
+		recordSpans(t)
+
+		trace := StartScenario("Deploy", "test", "", nil)
+		scenarioTraceparent := trace.Traceparent()
+		assert.Regexp(t, `^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`, scenarioTraceparent)
+
+		trace.StartBlock(0, "Create", 0, codeBlockFrom("scenario.md", 1))
+		blockTraceparent := trace.Traceparent()
+		assert.NotEqual(t, scenarioTraceparent, blockTraceparent)
+		assert.Equal(t, scenarioTraceparent[:35], blockTraceparent[:35])
+
+		trace.FinishBlock(0, 0, 0, nil)
+		assert.Equal(t, scenarioTraceparent, trace.Traceparent())
+		trace.End(nil)
+	})
+
+	t.Run("A scenario joins the trace it was launched from", func(t *testing.T) {
+		recorder := recordSpans(t)
+		t.Setenv("TRACEPARENT", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+		StartScenario("Deploy", "test", "", nil).End(nil)
+
+		scenario := findSpan(t, recorder, "Deploy")
+		assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", scenario.SpanContext().TraceID().String())
+		assert.Equal(t, "b7ad6b7169203331", scenario.Parent().SpanID().String())
+	})
+
+	t.Run("A nil trace does nothing", func(t *testing.T) {
+		var trace *ScenarioTrace
+		trace.StartBlock(0, "Step", 0, parsers.CodeBlock{})
+		trace.BlockRetried(1, nil)
+		trace.FinishBlock(0, 0, 0, nil)
+		trace.SetResourceGroup("group")
+		trace.StartCleanup("Teardown")(nil)
+		assert.Equal(t, "", trace.Traceparent())
+		trace.End(nil)
+	})
+}
@@ -0,0 +1,146 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Azure/InnovationEngine/internal/logging"
+)
+
+// The name that IE reports its spans under.
+const ServiceName = "innovation-engine"
+
+// The path that OTLP collectors receive traces on over HTTP.
+const defaultTracesPath = "/v1/traces"
+
+// The time the spans that are still buffered have to reach the collector when
+// a scenario ends.
+const flushTimeout = 10 * time.Second
+
+// The provider of the spans of the current run. It is nil unless traces are
+// exported, in which case the global otel tracer is a no-op.
+var provider *sdktrace.TracerProvider = nil
+
+// Gets the options of the OTLP exporter for an endpoint, which is the URL of a
+// collector such as `http://localhost:4318`. The traces are sent to
+// /v1/traces unless the URL has a path of its own.
+func exporterOptions(endpoint string) ([]otlptracehttp.Option, error) {
+	endpointUrl, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("the OTLP endpoint %q is not a valid URL: %w", endpoint, err)
+	}
+
+	if (endpointUrl.Scheme != "http" && endpointUrl.Scheme != "https") || endpointUrl.Host == "" {
+		return nil, fmt.Errorf("the OTLP endpoint %q must be an http or https URL", endpoint)
+	}
+
+	path := endpointUrl.Path
+	if path == "" || path == "/" {
+		path = defaultTracesPath
+	}
+
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(endpointUrl.Host),
+		otlptracehttp.WithURLPath(path),
+	}
+	if endpointUrl.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+
+	return options, nil
+}
+
+// Exports the spans of the run to the OTLP collector at an endpoint over HTTP.
+// Nothing is exported when the endpoint is empty.
+func Init(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+
+	options, err := exporterOptions(endpoint)
+	if err != nil {
+		return err
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return fmt.Errorf("failed to create the OTLP exporter for %s: %w", endpoint, err)
+	}
+
+	// Failing to export a span shouldn't interrupt the scenario or write over
+	// its output.
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logging.GlobalLogger.Errorf("Failed to export the trace: %s", err)
+	}))
+
+	SetSpanProcessor(sdktrace.NewBatchSpanProcessor(exporter))
+	return nil
+}
+
+// Sends the spans of the run to a span processor. It is what Init uses to
+// export spans, and lets tests record them instead.
+func SetSpanProcessor(processor sdktrace.SpanProcessor) {
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+}
+
+// Sends the spans that are still buffered to the collector. Commands exit as
+// soon as a scenario fails, so the spans are flushed when each scenario ends
+// rather than only when IE shuts down.
+func Flush() {
+	if provider == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	if err := provider.ForceFlush(ctx); err != nil {
+		logging.GlobalLogger.Errorf("Failed to flush the trace: %s", err)
+	}
+}
+
+// Flushes the remaining spans and stops exporting them.
+func Shutdown() {
+	if provider == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	if err := provider.Shutdown(ctx); err != nil {
+		logging.GlobalLogger.Errorf("Failed to shut down the trace exporter: %s", err)
+	}
+	provider = nil
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(ServiceName)
+}
+
+// Formats the span of a context as the value of the W3C traceparent header,
+// which child processes read from the TRACEPARENT environment variable. It
+// is empty when the span isn't recorded anywhere.
+func Traceparent(ctx context.Context) string {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ""
+	}
+
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
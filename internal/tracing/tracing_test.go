@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExporterOptions(t *testing.T) {
+	t.Run("Endpoints must be http or https URLs", func(t *testing.T) {
+		for _, endpoint := range []string{"localhost:4318", "grpc://localhost:4317", "http://"} {
+			_, err := exporterOptions(endpoint)
+			assert.Error(t, err, endpoint)
+		}
+	})
+
+	t.Run("Paths are kept", func(t *testing.T) {
+		options, err := exporterOptions("https://collector.example.com/custom/traces")
+		assert.NoError(t, err)
+		assert.Len(t, options, 2)
+	})
+
+	t.Run("Plain http is insecure", func(t *testing.T) {
+		options, err := exporterOptions("http://localhost:4318")
+		assert.NoError(t, err)
+		assert.Len(t, options, 3)
+	})
+}
+
+func TestExportToCollector(t *testing.T) {
+	requests := make(chan *http.Request, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		requests <- r
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	assert.NoError(t, Init(collector.URL))
+	defer Shutdown()
+
+	trace := StartScenario("Deploy", "test", "correlation", nil)
+	trace.StartBlock(0, "Step", 0, codeBlockFrom("scenario.md", 1))
+	trace.FinishBlock(0, 1, 0, nil)
+	trace.End(nil)
+
+	select {
+	case request := <-requests:
+		assert.Equal(t, http.MethodPost, request.Method)
+		assert.Equal(t, defaultTracesPath, request.URL.Path)
+		assert.Equal(t, "application/x-protobuf", request.Header.Get("Content-Type"))
+	default:
+		t.Fatal("the collector didn't receive the trace when the scenario ended")
+	}
+}
+
+func TestTracesAreOnlyExportedToAnEndpoint(t *testing.T) {
+	assert.NoError(t, Init(""))
+	assert.Nil(t, provider)
+	assert.Equal(t, "", StartScenario("Deploy", "test", "", nil).Traceparent())
+}